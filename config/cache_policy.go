@@ -0,0 +1,103 @@
+package config
+
+import (
+	"sort"
+	"time"
+)
+
+// 缓存类型
+const (
+	CacheMovies        = "movies"
+	CacheShows         = "shows"
+	CacheEpisodes      = "episodes"
+	CacheEpisodeGroups = "episode_groups"
+)
+
+// 默认规则：1年以上的永久缓存，一年到半年的一礼拜，半年内的3天，最近两周播出的单集1天
+var defaultCacheRules = map[string][]*CacheRule{
+	CacheMovies:        {{AiredDays: 365, ExpireDays: 0}, {AiredDays: 180, ExpireDays: 7}, {AiredDays: 0, ExpireDays: 3}},
+	CacheShows:         {{AiredDays: 365, ExpireDays: 0}, {AiredDays: 180, ExpireDays: 7}, {AiredDays: 0, ExpireDays: 3}},
+	CacheEpisodes:      {{AiredDays: 365, ExpireDays: 0}, {AiredDays: 180, ExpireDays: 7}, {AiredDays: 14, ExpireDays: 3}, {AiredDays: 0, ExpireDays: 1}},
+	CacheEpisodeGroups: {{AiredDays: 365, ExpireDays: 0}, {AiredDays: 180, ExpireDays: 7}, {AiredDays: 0, ExpireDays: 3}},
+}
+
+// Expired 根据播出时间和缓存时间判断缓存是否过期
+func (p *CachePolicyConfig) Expired(kind string, modTime, airTime time.Time) bool {
+	ttl, forever := p.ttl(kind, airTime)
+	return !forever && time.Since(modTime) > ttl
+}
+
+// ShowExpired 剧集缓存是否过期，连载中和即将播出新集的剧集使用更短的缓存时间
+func (p *CachePolicyConfig) ShowExpired(modTime, lastAirTime time.Time, status string, nextAirTime time.Time) bool {
+	cacheSub := time.Since(modTime)
+	if !nextAirTime.IsZero() {
+		// 缓存之后新的一集已经播出
+		if nextAirTime.Before(time.Now()) && nextAirTime.After(modTime) {
+			return true
+		}
+
+		upcomingDays, upcomingHours := 7, 6
+		if p != nil && p.UpcomingDays > 0 {
+			upcomingDays = p.UpcomingDays
+		}
+		if p != nil && p.UpcomingHours > 0 {
+			upcomingHours = p.UpcomingHours
+		}
+		if time.Until(nextAirTime) <= time.Hour*24*time.Duration(upcomingDays) && cacheSub > time.Hour*time.Duration(upcomingHours) {
+			return true
+		}
+	}
+
+	ttl, forever := p.ttl(CacheShows, lastAirTime)
+	if status == "Returning Series" {
+		returningHours := 24
+		if p != nil && p.ReturningHours > 0 {
+			returningHours = p.ReturningHours
+		}
+		if forever || time.Hour*time.Duration(returningHours) < ttl {
+			ttl, forever = time.Hour*time.Duration(returningHours), false
+		}
+	}
+
+	return !forever && cacheSub > ttl
+}
+
+// 找到播出时间对应的规则，返回缓存时间和是否永久缓存
+func (p *CachePolicyConfig) ttl(kind string, airTime time.Time) (time.Duration, bool) {
+	var rules []*CacheRule
+	if p != nil {
+		switch kind {
+		case CacheMovies:
+			rules = p.Movies
+		case CacheShows:
+			rules = p.Shows
+		case CacheEpisodes:
+			rules = p.Episodes
+		case CacheEpisodeGroups:
+			rules = p.EpisodeGroups
+		}
+	}
+	if len(rules) == 0 {
+		rules = defaultCacheRules[kind]
+	}
+
+	rules = append([]*CacheRule{}, rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].AiredDays > rules[j].AiredDays
+	})
+
+	airSub := time.Since(airTime)
+	for _, rule := range rules {
+		if airSub >= time.Hour*24*time.Duration(rule.AiredDays) {
+			return time.Hour * 24 * time.Duration(rule.ExpireDays), rule.ExpireDays == 0
+		}
+	}
+
+	// 还没有播出
+	if len(rules) > 0 {
+		rule := rules[len(rules)-1]
+		return time.Hour * 24 * time.Duration(rule.ExpireDays), rule.ExpireDays == 0
+	}
+
+	return time.Hour * 24 * 3, false
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCachePolicyExpired(t *testing.T) {
+	day := time.Hour * 24
+	policy := &CachePolicyConfig{
+		Movies: []*CacheRule{{AiredDays: 30, ExpireDays: 0}, {AiredDays: 0, ExpireDays: 1}},
+	}
+
+	cases := []struct {
+		policy  *CachePolicyConfig
+		kind    string
+		cached  time.Duration
+		aired   time.Duration
+		expired bool
+	}{
+		{nil, CacheMovies, day * 100, day * 400, false},
+		{nil, CacheMovies, day * 8, day * 200, true},
+		{nil, CacheMovies, day * 5, day * 200, false},
+		{nil, CacheMovies, day * 4, day * 10, true},
+		{nil, CacheEpisodes, day * 2, day * 3, true},
+		{nil, CacheEpisodes, day * 2, -day * 3, true},
+		{policy, CacheMovies, day * 100, day * 40, false},
+		{policy, CacheMovies, day * 2, day * 10, true},
+		{policy, CacheShows, day * 2, day * 10, false},
+	}
+	for _, item := range cases {
+		give := item.policy.Expired(item.kind, time.Now().Add(-item.cached), time.Now().Add(-item.aired))
+		if give != item.expired {
+			t.Errorf("Expired(%s, cached %s, aired %s) give: %v, want: %v", item.kind, item.cached, item.aired, give, item.expired)
+		}
+	}
+}
+
+func TestCachePolicyShowExpired(t *testing.T) {
+	hour := time.Hour
+	day := hour * 24
+	cases := []struct {
+		cached  time.Duration
+		status  string
+		nextAir time.Duration // 距离下一集播出的时间，0表示没有下一集
+		expired bool
+	}{
+		{hour * 30, "Ended", 0, false},
+		{hour * 30, "Returning Series", 0, true},
+		{hour * 10, "Returning Series", 0, false},
+		{hour * 7, "Returning Series", day * 3, true},
+		{hour * 5, "Returning Series", day * 3, false},
+		{hour * 5, "Returning Series", -hour, true},
+	}
+	for _, item := range cases {
+		var nextAir time.Time
+		if item.nextAir != 0 {
+			nextAir = time.Now().Add(item.nextAir)
+		}
+		give := (*CachePolicyConfig)(nil).ShowExpired(time.Now().Add(-item.cached), time.Now().Add(-day*100), item.status, nextAir)
+		if give != item.expired {
+			t.Errorf("ShowExpired(cached %s, %s, next %s) give: %v, want: %v", item.cached, item.status, item.nextAir, give, item.expired)
+		}
+	}
+}
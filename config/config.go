@@ -20,3 +20,14 @@ func LoadConfig(file string) *Config {
 
 	return c
 }
+
+// LibraryLanguage 路径所在媒体库目录单独指定的语言，目录嵌套时使用最深的一个，没有时返回空
+func (c *CollectorConfig) LibraryLanguage(path string) string {
+	language, matched := "", ""
+	for dir, item := range c.Languages {
+		if dir = utils.InDirs(path, []string{dir}); dir != "" && len(dir) > len(matched) {
+			language, matched = item, dir
+		}
+	}
+	return language
+}
@@ -0,0 +1,27 @@
+package config
+
+import "testing"
+
+func TestLibraryLanguage(t *testing.T) {
+	c := &CollectorConfig{Languages: map[string]string{
+		"/volume1/anime":          "ja-JP,zh-CN",
+		"/volume1/anime/cartoon/": "zh-TW",
+	}}
+
+	cases := map[string]string{
+		"/volume1/anime/One Piece":     "ja-JP,zh-CN",
+		"/volume1/anime/cartoon/Tom":   "zh-TW",
+		"/volume1/anime":               "ja-JP,zh-CN",
+		"/volume1/animation/Toy Story": "",
+		"/volume1/movies/Fortress":     "",
+	}
+	for path, want := range cases {
+		if give := c.LibraryLanguage(path); give != want {
+			t.Errorf("LibraryLanguage(%s) want %s, give %s", path, want, give)
+		}
+	}
+
+	if give := (&CollectorConfig{}).LibraryLanguage("/volume1/anime"); give != "" {
+		t.Errorf("LibraryLanguage without config want empty, give %s", give)
+	}
+}
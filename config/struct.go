@@ -2,11 +2,18 @@ package config
 
 type Config struct {
 	Log       *LogConfig       `json:"log"`       // 日志配置
-	Ffmpeg    *FfmpegConfig    `json:"ffmpeg"`    // ffmpeg配置，给音乐视频使用的
+	Ffmpeg    *FfmpegConfig    `json:"ffmpeg"`    // ffmpeg配置，给音乐视频、电影和分集的音视频信息使用的
 	Tmdb      *TmdbConfig      `json:"tmdb"`      // TMDB 配置
 	Kodi      *KodiConfig      `json:"kodi"`      // kodi配置
 	WebDAV    *WebDAVConfig    `json:"webdav"`    //webdav配置
 	Collector *CollectorConfig `json:"collector"` // 刮削配置
+	Http      *HttpConfig      `json:"http"`      // 状态和控制接口配置
+}
+
+type HttpConfig struct {
+	Enable bool   `json:"enable"` // 是否开启状态和控制接口，只在常驻运行时开启
+	Listen string `json:"listen"` // 监听地址，默认 127.0.0.1:8899
+	Token  string `json:"token"`  // 访问令牌，配置后请求需要带 Authorization: Bearer <token>
 }
 
 type KodiConfig struct {
@@ -25,18 +32,29 @@ type LogConfig struct {
 }
 
 type FfmpegConfig struct {
-	MaxWorker   int    `json:"max_worker"`   // 最大进程数：建议为逻辑CPU个数
-	FfmpegPath  string `json:"ffmpeg_path"`  // ffmpeg 可执行文件路径
-	FfprobePath string `json:"ffprobe_path"` // ffprobe 可执行文件路径
+	MaxWorker     int    `json:"max_worker"`     // 最大进程数：建议为逻辑CPU个数
+	FfmpegPath    string `json:"ffmpeg_path"`    // ffmpeg 可执行文件路径
+	FfprobePath   string `json:"ffprobe_path"`   // ffprobe 可执行文件路径
+	StreamDetails bool   `json:"stream_details"` // 电影和分集的NFO是否写入 ffprobe 读取的视频、音频、字幕信息和实际片长
 }
 
 type TmdbConfig struct {
-	ApiHost   string `json:"api_host"`   // TMDB 接口地址
-	ApiKey    string `json:"api_key"`    // api key
-	ImageHost string `json:"image_host"` // 图片地址
-	Language  string `json:"language"`   // 语言
-	Rating    string `json:"rating"`     // 内容分级
-	Proxy     string `json:"proxy"`      // 请求TMDB经过代理，支持 http、https、socks5、socks5h
+	ApiHost           string   `json:"api_host"`            // TMDB 接口地址
+	ApiKey            string   `json:"api_key"`             // api key
+	AccessToken       string   `json:"access_token"`        // v4 API 读访问令牌，配置后通过 Authorization 头认证，不再使用 api_key
+	ImageHost         string   `json:"image_host"`          // 图片地址
+	Language          string   `json:"language"`            // 语言
+	Languages         []string `json:"languages"`           // 按顺序回退的语言列表，比如 ["zh-CN", "zh-TW", "en-US"]，第一个语言缺少标题、简介等字段时依次使用后面的语言，配置后忽略 language
+	Rating            string   `json:"rating"`              // 内容分级
+	Proxy             string   `json:"proxy"`               // 请求TMDB经过代理，支持 http、https、socks5、socks5h
+	RateLimit         float64  `json:"rate_limit"`          // 每秒最多请求次数，所有刮削共用，默认20，小于0不限制
+	RateBurst         int      `json:"rate_burst"`          // 允许的突发请求数，默认同 rate_limit
+	MaxRetries        int      `json:"max_retries"`         // 网络错误、5xx和429时的重试次数，默认3次
+	MatchThreshold    float64  `json:"match_threshold"`     // 搜索结果匹配度（0-1）阈值，低于阈值的不写入NFO，放入待确认列表，默认0.6，负数不检查
+	FixturesMode      string   `json:"fixtures_mode"`       // 接口录制回放：record 保存每次请求的返回，replay 只使用保存的返回，为空时不启用
+	FixturesDir       string   `json:"fixtures_dir"`        // 录制文件保存的目录
+	ResponseCacheDir  string   `json:"response_cache_dir"`  // 接口返回缓存目录，所有条目共用，默认为 state_dir 下的 tmdb
+	ResponseCacheDays int      `json:"response_cache_days"` // 接口返回缓存过期后超过多少天没有再请求就删除，默认30天，小于0不删除
 }
 
 type WebDAVConfig struct {
@@ -48,15 +66,42 @@ type WebDAVConfig struct {
 }
 
 type CollectorConfig struct {
-	Watcher               bool     `json:"watcher"`                  // 是否开启文件监听，比定时扫描及时
-	CronSeconds           int      `json:"cron_seconds"`             // 定时扫描频率
-	SkipFolders           []string `json:"skip_folders"`             // 跳过的目录，可多个
-	MoviesNfoMode         int      `json:"movies_nfo_mode"`          // 电影NFO写入模式：1 movie.nfo，2 <VideoFileName>.nfo
-	MoveToStorage         bool     `json:"move_to_storage"`          //刮削后是否需要迁移到存储目录
-	MoviesDir             []string `json:"movies_dir"`               // 需要监听的电影文件根目录，可多个
-	MoviesStorageDir      string   `json:"movies_storage_dir"`       //刮削后实际存放电影的文件夹, 仅为一个
-	ShowsDir              []string `json:"shows_dir"`                // 需要监听的电视剧文件根目录，可多个
-	ShowsStorageDir       string   `json:"shows_storage_dir"`        //刮削后实际存放电视剧的文件夹, 仅为一个
-	MusicVideosDir        []string `json:"music_videos_dir"`         //需要监听的音乐视频文件根目录，可多个
-	MusicVideosStorageDir string   `json:"music_videos_storage_dir"` //刮削后实际存放电视剧的文件夹, 仅为一个
+	Watcher               bool               `json:"watcher"`                  // 是否开启文件监听，比定时扫描及时
+	CronSeconds           int                `json:"cron_seconds"`             // 定时扫描频率
+	ShutdownSeconds       int                `json:"shutdown_seconds"`         // 收到退出信号后等待正在处理的任务完成的最长时间，默认30秒
+	StateDir              string             `json:"state_dir"`                // 持久化任务队列的目录，默认为配置文件所在目录下的state
+	CacheDir              string             `json:"cache_dir"`                // 统一的刮削信息缓存目录，为空时使用每个电影、剧集目录下的 tmdb 目录
+	RetryMaxAttempts      int                `json:"retry_max_attempts"`       // 处理失败后最多尝试的次数，默认5次
+	RetryBackoffSeconds   int                `json:"retry_backoff_seconds"`    // 第一次重试前等待的秒数，之后每次翻倍，默认60秒
+	SkipFolders           []string           `json:"skip_folders"`             // 跳过的目录，可多个
+	MoviesNfoMode         int                `json:"movies_nfo_mode"`          // 电影NFO写入模式：1 movie.nfo，2 <VideoFileName>.nfo
+	MoviesNfoRuntime      bool               `json:"movies_nfo_runtime"`       // 电影NFO是否写入TMDB的片长，默认由Kodi从视频文件读取
+	EpisodeExternalIds    bool               `json:"episode_external_ids"`     // 分集NFO是否写入imdb、tvdb id，整季详情中没有，开启后每个没有NFO的分集额外请求一次TMDB
+	ExistingNfo           string             `json:"existing_nfo"`             // 已有NFO（比如发布组附带的）的处理：overwrite 直接覆盖，backup 备份为 .bak 后再写入，默认overwrite
+	MoveToStorage         bool               `json:"move_to_storage"`          //刮削后是否需要迁移到存储目录
+	MoviesDir             []string           `json:"movies_dir"`               // 需要监听的电影文件根目录，可多个
+	MoviesStorageDir      string             `json:"movies_storage_dir"`       //刮削后实际存放电影的文件夹, 仅为一个
+	ShowsDir              []string           `json:"shows_dir"`                // 需要监听的电视剧文件根目录，可多个
+	ShowsStorageDir       string             `json:"shows_storage_dir"`        //刮削后实际存放电视剧的文件夹, 仅为一个
+	MusicVideosDir        []string           `json:"music_videos_dir"`         //需要监听的音乐视频文件根目录，可多个
+	MusicVideosStorageDir string             `json:"music_videos_storage_dir"` //刮削后实际存放电视剧的文件夹, 仅为一个
+	CachePolicy           *CachePolicyConfig `json:"cache_policy"`             // TMDB 详情缓存的过期规则
+	Languages             map[string]string  `json:"languages"`                // 媒体库目录单独指定的语言，键为 movies_dir、shows_dir 中的目录，值可以用逗号分隔多个语言，override.json 中的 language 优先
+}
+
+// CachePolicyConfig 缓存过期规则，没有配置的类型使用默认规则
+type CachePolicyConfig struct {
+	Movies         []*CacheRule `json:"movies"`
+	Shows          []*CacheRule `json:"shows"`
+	Episodes       []*CacheRule `json:"episodes"`
+	EpisodeGroups  []*CacheRule `json:"episode_groups"`
+	ReturningHours int          `json:"returning_hours"` // 连载中（Returning Series）的剧集最长缓存小时数，默认24
+	UpcomingDays   int          `json:"upcoming_days"`   // 下一集在这个天数内播出时，默认7天
+	UpcomingHours  int          `json:"upcoming_hours"`  // 使用这个缓存小时数，默认6
+}
+
+// CacheRule 首播或上映超过 AiredDays 天时，缓存 ExpireDays 天后过期，为0时永久缓存
+type CacheRule struct {
+	AiredDays  int `json:"aired_days"`
+	ExpireDays int `json:"expire_days"`
 }
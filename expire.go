@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/tmdb"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 手动标记电影或电视剧的缓存过期，下次处理时重新请求TMDB
+// kodi-tmdb -config config.json expire path...
+func runExpire(c *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("usage: expire path...")
+		return 2
+	}
+
+	failed := false
+	for _, path := range args {
+		if err := expirePath(c, path); err != nil {
+			fmt.Printf("expire %s err: %v\n", path, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func expirePath(c *config.Config, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	// 单文件电影的缓存在所在目录的tmdb下，以文件名区分
+	var cacheDir, marker, cacheFile, api string
+	switch {
+	case utils.InDirs(path, c.Collector.MoviesDir) != "":
+		marker, cacheFile, api = "expire", "movie.json", tmdb.ApiMovieDetail
+		cacheDir = utils.CacheDir(utils.CacheKindMovies, path, filepath.Join(path, "tmdb"))
+		if !info.IsDir() {
+			name := info.Name()
+			marker, cacheFile = name+".expire", name+".movie.json"
+			cacheDir = utils.CacheDir(utils.CacheKindMovies, path, filepath.Join(filepath.Dir(path), "tmdb"))
+		}
+	case utils.InDirs(path, c.Collector.ShowsDir) != "" && info.IsDir():
+		marker, cacheFile, api = "expire", "tv.json", tmdb.ApiTvDetail
+		cacheDir = utils.CacheDir(utils.CacheKindShows, path, filepath.Join(path, "tmdb"))
+	default:
+		return fmt.Errorf("not a movie or shows path")
+	}
+
+	if _, err = os.Stat(cacheDir); err != nil {
+		return fmt.Errorf("cache dir not found, nothing to expire")
+	}
+
+	err = utils.WriteFile(utils.ActionWriteMarker, filepath.Join(cacheDir, marker), []byte(time.Now().Format(time.RFC3339)), 0644)
+	if err != nil {
+		return err
+	}
+
+	// 同时删除共用的接口返回缓存，否则有效期内还会拿到旧的数据
+	removed := 0
+	if content, err := os.ReadFile(filepath.Join(cacheDir, cacheFile)); err == nil {
+		detail := &struct {
+			Id int `json:"id"`
+		}{}
+		if json.Unmarshal(content, detail) == nil && detail.Id > 0 {
+			removed = tmdb.Api.ExpireCache(fmt.Sprintf(api, detail.Id))
+		}
+	}
+
+	fmt.Printf("expired %s, removed %d response cache\n", path, removed)
+	return nil
+}
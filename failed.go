@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// 处理失败的任务：列出或者重新排队
+// kodi-tmdb -config config.json failed [list] [--json] [--reason review]
+// kodi-tmdb -config config.json failed retry [--reason review] [path...]
+func runFailed(c *config.Config, args []string) int {
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	var outputJson bool
+	var reason string
+	flagSet := flag.NewFlagSet("failed "+action, flag.ExitOnError)
+	flagSet.BoolVar(&outputJson, "json", false, "output as json")
+	flagSet.StringVar(&reason, "reason", "", "only failed jobs with reason: not_found, review, http, parse, other")
+	_ = flagSet.Parse(args)
+
+	store, err := queue.Open(filepath.Join(c.Collector.StateDir, "jobs.json"))
+	if err != nil {
+		fmt.Printf("open job queue err: %v\n", err)
+		return 1
+	}
+	jobs := store.List("", queue.StateFailed)
+	if reason != "" {
+		selected := make([]*queue.Job, 0)
+		for _, job := range jobs {
+			if job.Reason == reason {
+				selected = append(selected, job)
+			}
+		}
+		jobs = selected
+	}
+
+	switch action {
+	case "list":
+		if outputJson {
+			bytes, err := json.MarshalIndent(jobs, "", "    ")
+			if err != nil {
+				fmt.Printf("marshal failed jobs err: %v\n", err)
+				return 1
+			}
+			fmt.Println(string(bytes))
+			return 0
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "KIND\tREASON\tATTEMPTS\tUPDATED\tPATH\tERROR")
+		for _, job := range jobs {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", job.Kind, job.Reason, job.Attempts,
+				job.UpdatedAt.Local().Format("2006-01-02 15:04:05"), job.Key, job.LastError)
+		}
+		_ = w.Flush()
+		return 0
+
+	case "retry":
+		// 指定路径时只重新排队对应的任务
+		if flagSet.NArg() > 0 {
+			selected := make([]*queue.Job, 0)
+			for _, job := range jobs {
+				for _, path := range flagSet.Args() {
+					if abs, err := filepath.Abs(path); err == nil && filepath.Clean(job.Key) == abs {
+						selected = append(selected, job)
+						break
+					}
+				}
+			}
+			jobs = selected
+		}
+
+		if len(jobs) == 0 {
+			fmt.Println("no failed job to retry")
+			return 0
+		}
+
+		if err = queue.RequeueLater(c.Collector.StateDir, jobs); err != nil {
+			fmt.Printf("requeue failed jobs err: %v\n", err)
+			return 1
+		}
+		for _, job := range jobs {
+			fmt.Printf("requeue %s %s\n", job.Kind, job.Key)
+		}
+		return 0
+
+	default:
+		fmt.Printf("unknown failed action: %s\n", action)
+		return 2
+	}
+}
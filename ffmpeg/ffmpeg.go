@@ -1,11 +1,13 @@
 package ffmpeg
 
 import (
+	"context"
 	"fengqi/kodi-metadata-tmdb-cli/config"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 )
 
-func InitFfmpeg(config *config.FfmpegConfig) {
+func InitFfmpeg(parent context.Context, config *config.FfmpegConfig) {
+	ctx = parent
 	SetFfmpeg(config.FfmpegPath)
 	SetFfprobe(config.FfprobePath)
 }
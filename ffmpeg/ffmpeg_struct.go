@@ -1,4 +1,9 @@
 package ffmpeg
 
+import "context"
+
 var ffmpeg = "ffmpeg"
 var ffprobe = "ffprobe"
+
+// 取消后正在运行的 ffmpeg、ffprobe 子进程会被结束
+var ctx = context.Background()
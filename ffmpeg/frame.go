@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"fmt"
 	"os/exec"
 	"time"
@@ -24,27 +26,33 @@ func FrameWithTimeout(fileName, outfile string, timeout time.Duration, options .
 }
 
 func FrameWithTimeoutExec(filename, outfile string, timeout time.Duration, options ...string) error {
+	if utils.Planned(utils.ActionDrawThumb, outfile, filename) {
+		return nil
+	}
+
 	args := append([]string{
 		"-i", filename,
 	}, options...)
 	args = append(args, "-y")
 	args = append(args, outfile)
 
-	ctx := context.Background()
+	runCtx := ctx
 	if timeout > 0 {
 		var cancel func()
-		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
 	var outputBuf bytes.Buffer
 	var stdErr bytes.Buffer
 
-	cmd := exec.CommandContext(ctx, ffmpeg, args...)
+	cmd := exec.CommandContext(runCtx, ffmpeg, args...)
 	cmd.Stdout = &outputBuf
 	cmd.Stderr = &stdErr
 
+	start := time.Now()
 	err := cmd.Run()
+	metrics.Ffmpeg("ffmpeg", start, err)
 	if err != nil {
 		return errors.New(fmt.Sprintf("%s\n %s", err.Error(), stdErr.String()))
 	}
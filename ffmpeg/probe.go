@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
 	"fmt"
 	"os/exec"
 	"time"
@@ -28,21 +29,23 @@ func ProbeWithTimeout(filename string, timeout time.Duration, options ...string)
 func ProbeWithTimeoutExec(filename string, timeout time.Duration, options ...string) (*ProbeData, error) {
 	options = append(options, filename)
 
-	ctx := context.Background()
+	runCtx := ctx
 	if timeout > 0 {
 		var cancel func()
-		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
 	var outputBuf bytes.Buffer
 	var stdErr bytes.Buffer
 
-	cmd := exec.CommandContext(ctx, ffprobe, options...)
+	cmd := exec.CommandContext(runCtx, ffprobe, options...)
 	cmd.Stdout = &outputBuf
 	cmd.Stderr = &stdErr
 
+	start := time.Now()
 	err := cmd.Run()
+	metrics.Ffmpeg("ffprobe", start, err)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("%s\n %s", err.Error(), stdErr.String()))
 	}
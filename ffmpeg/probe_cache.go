@@ -0,0 +1,85 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"os"
+	"time"
+)
+
+// 网盘等挂载的目录读取较慢，单个文件最长等待时间
+const probeTimeout = 2 * time.Minute
+
+// 探测结果的缓存，视频文件的大小和修改时间都没变时直接使用
+type probeCache struct {
+	Size    int64      `json:"size"`
+	ModTime int64      `json:"mod_time"`
+	Data    *ProbeData `json:"data"`
+	Error   string     `json:"error,omitempty"` // 读取失败的原因，文件没变时不再重复读取，也不会每次都重新写入NFO
+}
+
+// ProbeCache 读取视频的音视频信息，结果缓存到 cacheFile，文件被替换后重新读取
+func ProbeCache(filename, cacheFile string) (*ProbeData, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := loadProbeCache(info, cacheFile)
+	metrics.CacheLookup("probe", cache != nil)
+	if cache != nil {
+		utils.Logger.DebugF("get video probe from cache: %s", cacheFile)
+		if cache.Error != "" {
+			return nil, errors.New(cache.Error)
+		}
+		return cache.Data, nil
+	}
+
+	data, err := ProbeWithTimeout(filename, probeTimeout)
+	if err != nil && ctx.Err() != nil {
+		return nil, err // 退出时中断的下次启动后重新读取
+	}
+
+	utils.Logger.DebugF("save video probe to cache: %s", cacheFile)
+	cache = &probeCache{Size: info.Size(), ModTime: info.ModTime().Unix(), Data: data}
+	if err != nil {
+		cache.Error = err.Error()
+	}
+	bytes, _ := json.MarshalIndent(cache, "", "    ")
+	if err := utils.WriteFile(utils.ActionWriteProbe, cacheFile, bytes, 0644); err != nil {
+		utils.Logger.WarningF("save probe cache: %s err: %v", cacheFile, err)
+	}
+
+	return data, err
+}
+
+// ProbeStale 视频文件还没有读取过或者已经被替换，需要重新读取并写入NFO，视频文件不存在时返回false
+func ProbeStale(filename, cacheFile string) bool {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+
+	return loadProbeCache(info, cacheFile) == nil
+}
+
+// 读取和视频文件大小、修改时间一致的缓存，没有或者已经过期时返回nil
+func loadProbeCache(info os.FileInfo, cacheFile string) *probeCache {
+	bytes, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return nil
+	}
+
+	cache := &probeCache{}
+	if err = json.Unmarshal(bytes, cache); err != nil {
+		utils.Logger.WarningF("parse probe cache: %s err: %v", cacheFile, err)
+		return nil
+	}
+	if cache.Data == nil && cache.Error == "" || cache.Size != info.Size() || cache.ModTime != info.ModTime().Unix() {
+		return nil
+	}
+
+	return cache
+}
@@ -86,11 +86,19 @@ type Stream struct {
 	Level              int               `json:"level,omitempty"`
 	ColorRange         string            `json:"color_range,omitempty"`
 	ColorSpace         string            `json:"color_space,omitempty"`
+	ColorTransfer      string            `json:"color_transfer,omitempty"`
+	ColorPrimaries     string            `json:"color_primaries,omitempty"`
 	SampleFmt          string            `json:"sample_fmt,omitempty"`
 	SampleRate         string            `json:"sample_rate,omitempty"`
 	Channels           int               `json:"channels,omitempty"`
 	ChannelLayout      string            `json:"channel_layout,omitempty"`
 	BitsPerSample      int               `json:"bits_per_sample,omitempty"`
+	SideDataList       []StreamSideData  `json:"side_data_list,omitempty"`
+}
+
+// StreamSideData is a json data structure to represent stream side data, like the Dolby Vision configuration
+type StreamSideData struct {
+	SideDataType string `json:"side_data_type"`
 }
 
 // StreamDisposition is a json data structure to represent stream dispositions
@@ -0,0 +1,170 @@
+package ffmpeg
+
+import (
+	"encoding/xml"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FileInfo NFO中的 <fileinfo>，电影和分集共用
+//
+// https://kodi.wiki/view/NFO_files/Movies#fileinfo
+type FileInfo struct {
+	XMLName       xml.Name      `xml:"fileinfo"`
+	StreamDetails StreamDetails `xml:"streamdetails"`
+}
+
+type StreamDetails struct {
+	Video    []VideoDetail    `xml:"video"`
+	Audio    []AudioDetail    `xml:"audio"`
+	Subtitle []SubtitleDetail `xml:"subtitle"`
+}
+
+type VideoDetail struct {
+	Codec             string `xml:"codec"`
+	Aspect            string `xml:"aspect"`
+	Width             int    `xml:"width"`
+	Height            int    `xml:"height"`
+	DurationInSeconds int    `xml:"durationinseconds"`
+	HdrType           string `xml:"hdrtype,omitempty"` // hdr10、dolbyvision、hlg，SDR 为空
+}
+
+type AudioDetail struct {
+	Codec    string `xml:"codec"`
+	Language string `xml:"language,omitempty"`
+	Channels int    `xml:"channels"`
+}
+
+type SubtitleDetail struct {
+	Language string `xml:"language,omitempty"`
+}
+
+// DTS 的扩展格式只能从 profile 区分，使用和 Kodi 相同的名称
+var dtsProfiles = map[string]string{
+	"DTS-HD MA":  "dtshd_ma",
+	"DTS-HD HRA": "dtshd_hra",
+	"DTS:X":      "dtshd_ma",
+}
+
+// FileInfo 转换为NFO中的视频、音频、字幕信息，没有视频流时返回nil
+func (p *ProbeData) FileInfo() *FileInfo {
+	if p == nil {
+		return nil
+	}
+
+	details := StreamDetails{}
+	for _, stream := range p.Streams {
+		if stream == nil {
+			continue
+		}
+
+		switch StreamType(stream.CodecType) {
+		case StreamVideo:
+			// mkv 中的封面图片也是视频流
+			if stream.Disposition.AttachedPic == 1 {
+				continue
+			}
+			details.Video = append(details.Video, VideoDetail{
+				Codec:             stream.CodecName,
+				Aspect:            stream.aspect(),
+				Width:             stream.Width,
+				Height:            stream.Height,
+				DurationInSeconds: p.DurationInSeconds(),
+				HdrType:           stream.hdrType(),
+			})
+		case StreamAudio:
+			codec := stream.CodecName
+			if profile, ok := dtsProfiles[stream.Profile]; ok && codec == "dts" {
+				codec = profile
+			}
+			details.Audio = append(details.Audio, AudioDetail{
+				Codec:    codec,
+				Language: stream.language(),
+				Channels: stream.Channels,
+			})
+		case StreamSubtitle:
+			details.Subtitle = append(details.Subtitle, SubtitleDetail{
+				Language: stream.language(),
+			})
+		}
+	}
+
+	if len(details.Video) == 0 {
+		return nil
+	}
+
+	return &FileInfo{StreamDetails: details}
+}
+
+// DurationInSeconds 视频的时长，容器中没有时使用第一个视频流的时长
+func (p *ProbeData) DurationInSeconds() int {
+	if p == nil {
+		return 0
+	}
+
+	seconds := 0.0
+	if p.Format != nil {
+		seconds = p.Format.DurationSeconds
+	}
+	if stream := p.FirstVideoStream(); seconds == 0 && stream != nil {
+		seconds, _ = strconv.ParseFloat(stream.Duration, 64)
+	}
+
+	return int(math.Round(seconds))
+}
+
+// RuntimeMinutes NFO中 <runtime> 使用的分钟数
+func (p *ProbeData) RuntimeMinutes() int {
+	return int(math.Round(float64(p.DurationInSeconds()) / 60))
+}
+
+// 显示比例，比如 16:9 => 1.777778，没有时按分辨率计算
+func (s *Stream) aspect() string {
+	ratio := 0.0
+	if w, h, ok := strings.Cut(s.DisplayAspectRatio, ":"); ok {
+		width, _ := strconv.ParseFloat(w, 64)
+		height, _ := strconv.ParseFloat(h, 64)
+		if width > 0 && height > 0 {
+			ratio = width / height
+		}
+	}
+	if ratio == 0 && s.Width > 0 && s.Height > 0 {
+		ratio = float64(s.Width) / float64(s.Height)
+	}
+	if ratio == 0 {
+		return ""
+	}
+
+	return strconv.FormatFloat(ratio, 'f', 6, 64)
+}
+
+// HDR 类型，杜比视界同时兼容 HDR10 时也优先使用 dolbyvision
+func (s *Stream) hdrType() string {
+	for _, item := range s.SideDataList {
+		if item.SideDataType == "DOVI configuration record" {
+			return "dolbyvision"
+		}
+	}
+	if tag := strings.ToLower(s.CodecTagString); tag == "dvh1" || tag == "dvhe" {
+		return "dolbyvision"
+	}
+
+	switch s.ColorTransfer {
+	case "smpte2084":
+		return "hdr10"
+	case "arib-std-b67":
+		return "hlg"
+	}
+
+	return ""
+}
+
+// 音轨和字幕的语言，ISO 639-2 三个字母的代码，未知的 und 不写入
+func (s *Stream) language() string {
+	language := strings.ToLower(s.Tags.Language)
+	if language == "und" {
+		return ""
+	}
+	return language
+}
@@ -0,0 +1,167 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const probeJson = `{
+	"streams": [
+		{"index": 0, "codec_name": "hevc", "codec_type": "video", "codec_tag_string": "[0][0][0][0]", "width": 3840, "height": 1608,
+			"display_aspect_ratio": "160:67", "color_transfer": "smpte2084", "color_primaries": "bt2020",
+			"side_data_list": [{"side_data_type": "DOVI configuration record"}]},
+		{"index": 1, "codec_name": "dts", "codec_type": "audio", "profile": "DTS-HD MA", "channels": 8, "tags": {"language": "eng"}},
+		{"index": 2, "codec_name": "ac3", "codec_type": "audio", "channels": 6, "tags": {"language": "chi"}},
+		{"index": 3, "codec_name": "subrip", "codec_type": "subtitle", "tags": {"language": "chi"}},
+		{"index": 4, "codec_name": "hdmv_pgs_subtitle", "codec_type": "subtitle", "tags": {"language": "und"}},
+		{"index": 5, "codec_name": "mjpeg", "codec_type": "video", "width": 600, "height": 882, "disposition": {"attached_pic": 1}}
+	],
+	"format": {"duration": "7245.312000"}
+}`
+
+func TestMain(m *testing.M) {
+	utils.InitLogger(utils.LogModeStdout, int(utils.FATAL), "")
+	m.Run()
+}
+
+func TestFileInfo(t *testing.T) {
+	probe := &ProbeData{}
+	if err := json.Unmarshal([]byte(probeJson), probe); err != nil {
+		t.Fatal(err)
+	}
+
+	info := probe.FileInfo()
+	if info == nil {
+		t.Fatal("FileInfo want stream details, give nil")
+	}
+
+	details := info.StreamDetails
+	if len(details.Video) != 1 {
+		t.Fatalf("FileInfo want 1 video without cover, give %+v", details.Video)
+	}
+	video := details.Video[0]
+	if video.Codec != "hevc" || video.Aspect != "2.388060" || video.Width != 3840 || video.Height != 1608 ||
+		video.DurationInSeconds != 7245 || video.HdrType != "dolbyvision" {
+		t.Errorf("FileInfo video give %+v", video)
+	}
+
+	if len(details.Audio) != 2 || details.Audio[0] != (AudioDetail{Codec: "dtshd_ma", Language: "eng", Channels: 8}) ||
+		details.Audio[1] != (AudioDetail{Codec: "ac3", Language: "chi", Channels: 6}) {
+		t.Errorf("FileInfo audio give %+v", details.Audio)
+	}
+	if len(details.Subtitle) != 2 || details.Subtitle[0].Language != "chi" || details.Subtitle[1].Language != "" {
+		t.Errorf("FileInfo subtitle give %+v", details.Subtitle)
+	}
+	if probe.RuntimeMinutes() != 121 {
+		t.Errorf("RuntimeMinutes want 121, give %d", probe.RuntimeMinutes())
+	}
+
+	var empty *ProbeData
+	if empty.FileInfo() != nil || empty.RuntimeMinutes() != 0 {
+		t.Errorf("nil ProbeData want empty")
+	}
+}
+
+func TestHdrType(t *testing.T) {
+	cases := []struct {
+		stream Stream
+		want   string
+	}{
+		{Stream{ColorTransfer: "smpte2084"}, "hdr10"},
+		{Stream{ColorTransfer: "arib-std-b67"}, "hlg"},
+		{Stream{ColorTransfer: "smpte2084", CodecTagString: "dvh1"}, "dolbyvision"},
+		{Stream{ColorTransfer: "bt709"}, ""},
+	}
+
+	for _, c := range cases {
+		if give := c.stream.hdrType(); give != c.want {
+			t.Errorf("hdrType %+v want %s, give %s", c.stream, c.want, give)
+		}
+	}
+}
+
+func TestProbeCache(t *testing.T) {
+	dir := t.TempDir()
+
+	// 用脚本代替 ffprobe，每次执行记录一行
+	counter := filepath.Join(dir, "count")
+	script := filepath.Join(dir, "ffprobe")
+	content := "#!/bin/sh\necho run >> " + counter + "\ncat <<'EOF'\n" + probeJson + "\nEOF\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { ffprobe = old }(ffprobe)
+	SetFfprobe(script)
+
+	runs := func() int {
+		bytes, _ := os.ReadFile(counter)
+		return strings.Count(string(bytes), "run")
+	}
+
+	video := filepath.Join(dir, "movie.mkv")
+	cacheFile := filepath.Join(dir, "movie.mkv.probe.json")
+	if err := os.WriteFile(video, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ProbeStale(video, cacheFile) {
+		t.Errorf("ProbeStale without cache want true")
+	}
+	for i := 0; i < 2; i++ {
+		probe, err := ProbeCache(video, cacheFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if probe.DurationInSeconds() != 7245 {
+			t.Errorf("ProbeCache want duration 7245, give %d", probe.DurationInSeconds())
+		}
+	}
+	if runs() != 1 {
+		t.Errorf("ProbeCache want ffprobe run once, give %d", runs())
+	}
+
+	if ProbeStale(video, cacheFile) {
+		t.Errorf("ProbeStale with cache want false")
+	}
+
+	// 文件被替换后重新读取
+	later := time.Now().Add(time.Hour)
+	if err := os.WriteFile(video, []byte("another video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(video, later, later)
+	if !ProbeStale(video, cacheFile) {
+		t.Errorf("ProbeStale after file changed want true")
+	}
+	if _, err := ProbeCache(video, cacheFile); err != nil {
+		t.Fatal(err)
+	}
+	if runs() != 2 {
+		t.Errorf("ProbeCache want ffprobe run again after file changed, give %d", runs())
+	}
+
+	if _, err := ProbeCache(filepath.Join(dir, "missing.mkv"), cacheFile); err == nil {
+		t.Errorf("ProbeCache missing file want error")
+	}
+
+	// 读取失败的结果也缓存，文件没变时不再重复读取
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho run >> "+counter+"\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.mkv")
+	brokenCache := filepath.Join(dir, "broken.mkv.probe.json")
+	_ = os.WriteFile(broken, []byte("broken"), 0644)
+	for i := 0; i < 2; i++ {
+		if _, err := ProbeCache(broken, brokenCache); err == nil {
+			t.Errorf("ProbeCache broken file want error")
+		}
+	}
+	if runs() != 3 || ProbeStale(broken, brokenCache) {
+		t.Errorf("ProbeCache failed probe want cached, give %d runs", runs())
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/kodi"
+	"fengqi/kodi-metadata-tmdb-cli/movies"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+	"fengqi/kodi-metadata-tmdb-cli/shows"
+	"fengqi/kodi-metadata-tmdb-cli/tmdb"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// 搜索结果中用于人工选择的信息
+type candidate struct {
+	Id            int
+	Year          string
+	Confidence    float64
+	Title         string
+	OriginalTitle string
+	Overview      string
+}
+
+// 手动识别单个电影或电视剧：列出搜索结果，选择后写入id，清理旧的缓存和NFO并立即重新刮削
+// kodi-tmdb -config config.json identify [--movie|--show] [--id 123] [--season 2] [--group id] path
+func runIdentify(ctx context.Context, c *config.Config, args []string) int {
+	var isMovie, isShow bool
+	var id, season int
+	var groupId string
+	flagSet := flag.NewFlagSet("identify", flag.ExitOnError)
+	flagSet.BoolVar(&isMovie, "movie", false, "identify as movie")
+	flagSet.BoolVar(&isShow, "show", false, "identify as show")
+	flagSet.IntVar(&id, "id", 0, "use this tmdb id without asking")
+	flagSet.IntVar(&season, "season", 0, "season of the show dir")
+	flagSet.StringVar(&groupId, "group", "", "tmdb episode group id of the show")
+	_ = flagSet.Parse(args)
+
+	if flagSet.NArg() != 1 {
+		fmt.Println("usage: identify [--movie|--show] [--id 123] [--season 2] [--group id] path")
+		return 2
+	}
+	path, err := filepath.Abs(flagSet.Arg(0))
+	if err != nil {
+		fmt.Printf("identify %s err: %v\n", flagSet.Arg(0), err)
+		return 1
+	}
+
+	// 不指定类型时根据所在的媒体库判断
+	if !isMovie && !isShow {
+		isShow = utils.InDirs(path, c.Collector.ShowsDir) != ""
+		isMovie = !isShow && utils.InDirs(path, c.Collector.MoviesDir) != ""
+	}
+	if isMovie == isShow {
+		fmt.Println("path not in movies or shows dir, use --movie or --show")
+		return 2
+	}
+
+	var movie *movies.Movie
+	var show *shows.Dir
+	var parsed any
+	if isMovie {
+		movie, err = movies.Identify(c, path)
+		parsed = movie
+	} else {
+		show, err = shows.Identify(c, path)
+		parsed = show
+	}
+	if err != nil {
+		fmt.Printf("identify %s err: %v\n", path, err)
+		return 1
+	}
+
+	bytes, _ := json.MarshalIndent(parsed, "", "    ")
+	fmt.Println(string(bytes))
+
+	if id == 0 {
+		var candidates []candidate
+		if isMovie {
+			candidates, err = movieCandidates(movie)
+		} else {
+			candidates, err = showCandidates(show)
+		}
+		if err != nil {
+			fmt.Printf("search err: %v\n", err)
+		}
+		printCandidates(candidates)
+
+		id = pickCandidate(candidates, isMovie)
+		if id == 0 {
+			return 0
+		}
+	}
+
+	if isMovie {
+		err = movie.SetMovieId(id)
+	} else {
+		err = show.SetTvId(id, season, groupId)
+	}
+	if err != nil {
+		fmt.Printf("save tmdb id %d err: %v\n", id, err)
+		return 1
+	}
+	fmt.Printf("use tmdb id %d, scraping %s\n", id, path)
+
+	summary := utils.NewSummary()
+	if isMovie {
+		movies.RunOnce(ctx, c, []string{path}, summary)
+	} else {
+		shows.RunOnce(ctx, c, []string{path}, summary)
+	}
+	kodi.Rpc.Flush()
+	summary.Print(os.Stdout)
+
+	// 常驻进程里处理失败的任务重新排队，刮削时会直接使用新的缓存
+	requeueFailed(c, path)
+
+	return summary.ExitCode()
+}
+
+func movieCandidates(movie *movies.Movie) ([]candidate, error) {
+	results, err := tmdb.Api.SearchMovieCandidates(movie.ChsTitle, movie.EngTitle, movie.Year)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]candidate, 0, len(results))
+	for _, item := range results {
+		candidates = append(candidates, candidate{
+			Id:            item.Id,
+			Year:          strings.SplitN(item.ReleaseDate, "-", 2)[0],
+			Confidence:    item.Confidence,
+			Title:         item.Title,
+			OriginalTitle: item.OriginalTitle,
+			Overview:      item.Overview,
+		})
+	}
+	return candidates, nil
+}
+
+func showCandidates(show *shows.Dir) ([]candidate, error) {
+	results, err := tmdb.Api.SearchShowsCandidates(show.ChsTitle, show.EngTitle, show.Year)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]candidate, 0, len(results))
+	for _, item := range results {
+		candidates = append(candidates, candidate{
+			Id:            item.Id,
+			Year:          strings.SplitN(item.FirstAirDate, "-", 2)[0],
+			Confidence:    item.Confidence,
+			Title:         item.Name,
+			OriginalTitle: item.OriginalName,
+			Overview:      item.Overview,
+		})
+	}
+	return candidates, nil
+}
+
+func printCandidates(candidates []candidate) {
+	if len(candidates) == 0 {
+		fmt.Println("no candidates found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "#\tID\tYEAR\tCONFIDENCE\tTITLE\tORIGINAL TITLE\tOVERVIEW")
+	for i, item := range candidates {
+		_, _ = fmt.Fprintf(w, "%d\t%d\t%s\t%.2f\t%s\t%s\t%s\n", i+1, item.Id, item.Year, item.Confidence,
+			item.Title, item.OriginalTitle, truncate(item.Overview, 40))
+	}
+	_ = w.Flush()
+}
+
+// 读取人工选择：序号、id:123 形式的TMDB id、IMDb id，输入q放弃
+func pickCandidate(candidates []candidate, isMovie bool) int {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("select #, tmdb id (id:123) or imdb id (tt123), q to quit: ")
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "q" || line == "" && err != nil {
+			return 0
+		}
+		if line == "" {
+			continue
+		}
+
+		if idStr, ok := strings.CutPrefix(line, "id:"); ok {
+			if id, _ := strconv.Atoi(strings.TrimSpace(idStr)); id > 0 {
+				return id
+			}
+		} else if imdbId := utils.MatchImdbId(line); imdbId != "" {
+			if id := findImdbId(imdbId, isMovie); id > 0 {
+				return id
+			}
+		} else if index, _ := strconv.Atoi(line); index > 0 && index <= len(candidates) {
+			return candidates[index-1].Id
+		}
+
+		fmt.Printf("invalid input: %s\n", line)
+		if err != nil {
+			return 0
+		}
+	}
+}
+
+// 通过IMDb id查找TMDB id
+func findImdbId(imdbId string, isMovie bool) int {
+	resp, err := tmdb.Api.FindByExternalId(imdbId, tmdb.ExternalImdb)
+	if err != nil {
+		fmt.Printf("find %s err: %v\n", imdbId, err)
+		return 0
+	}
+
+	if isMovie && len(resp.MovieResults) > 0 {
+		return resp.MovieResults[0].Id
+	}
+	if !isMovie && len(resp.TvResults) > 0 {
+		return resp.TvResults[0].Id
+	}
+
+	fmt.Printf("find %s: no matching result\n", imdbId)
+	return 0
+}
+
+// 常驻进程中这个路径有失败的任务时，通知它重新排队
+func requeueFailed(c *config.Config, path string) {
+	store, err := queue.Open(filepath.Join(c.Collector.StateDir, "jobs.json"))
+	if err != nil {
+		return
+	}
+
+	jobs := make([]*queue.Job, 0)
+	for _, job := range store.List("", queue.StateFailed) {
+		if filepath.Clean(job.Key) == path {
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	if err = queue.RequeueLater(c.Collector.StateDir, jobs); err != nil {
+		fmt.Printf("requeue failed jobs err: %v\n", err)
+	}
+}
+
+// 截断过长的文本，按字符计算
+func truncate(s string, size int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	runes := []rune(s)
+	if len(runes) <= size {
+		return s
+	}
+	return string(runes[:size]) + "..."
+}
@@ -2,9 +2,12 @@ package kodi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"io"
 	"net/http"
@@ -16,13 +19,16 @@ import (
 var Rpc *JsonRpc
 var httpClient *http.Client
 
-func InitKodi(config *config.KodiConfig) {
+func InitKodi(ctx context.Context, config *config.KodiConfig) {
 	Rpc = &JsonRpc{
+		ctx:          ctx,
 		config:       config,
 		refreshQueue: make(map[string]struct{}, 0),
 		scanQueue:    make(map[string]struct{}, 0),
 		refreshLock:  &sync.RWMutex{},
 		scanLock:     &sync.RWMutex{},
+		wake:         make(chan struct{}),
+		wakeLock:     &sync.Mutex{},
 		VideoLibrary: &VideoLibrary{
 			scanLimiter:   NewLimiter(300),
 			refreshMovie:  NewLimiter(60),
@@ -32,6 +38,14 @@ func InitKodi(config *config.KodiConfig) {
 		XBMC:  &XBMC{},
 	}
 
+	// 上次退出时没有执行的任务
+	for _, job := range queue.Jobs.Unfinished(queue.KindKodiRefresh) {
+		Rpc.refreshQueue[job.Key] = struct{}{}
+	}
+	for _, job := range queue.Jobs.Unfinished(queue.KindKodiScan) {
+		Rpc.scanQueue[job.Key] = struct{}{}
+	}
+
 	go Rpc.ConsumerRefreshTask()
 	go Rpc.ConsumerScanTask()
 
@@ -50,8 +64,69 @@ func (r *JsonRpc) Ping() bool {
 	return err == nil
 }
 
+// Flush 立即执行队列中剩余的刷新和扫描任务，用于单次运行模式退出前
+func (r *JsonRpc) Flush() {
+	if !r.config.Enable || r.ctx.Err() != nil || (len(r.refreshQueue) == 0 && len(r.scanQueue) == 0) {
+		return
+	}
+
+	if !r.Ping() {
+		utils.Logger.WarningF("kodi unreachable, drop %d refresh and %d scan tasks", len(r.refreshQueue), len(r.scanQueue))
+		return
+	}
+
+	r.consumeRefreshQueue()
+	r.consumeScanQueue()
+}
+
+// QueueLength 等待执行的刷新和扫描任务数量
+func (r *JsonRpc) QueueLength() (int, int) {
+	if r == nil {
+		return 0, 0
+	}
+
+	r.refreshLock.RLock()
+	refresh := len(r.refreshQueue)
+	r.refreshLock.RUnlock()
+
+	r.scanLock.RLock()
+	scan := len(r.scanQueue)
+	r.scanLock.RUnlock()
+
+	return refresh, scan
+}
+
+// Wake 唤醒正在等待的刷新和扫描任务，不用等到下次检查就执行队列中的任务
+func (r *JsonRpc) Wake() {
+	r.wakeLock.Lock()
+	defer r.wakeLock.Unlock()
+
+	close(r.wake)
+	r.wake = make(chan struct{})
+}
+
+// 等待一段时间，收到退出信号时提前返回false，被唤醒时提前返回true
+func (r *JsonRpc) sleep(d time.Duration) bool {
+	r.wakeLock.Lock()
+	wake := r.wake
+	r.wakeLock.Unlock()
+
+	select {
+	case <-r.ctx.Done():
+		return false
+	case <-wake:
+		return true
+	case <-time.After(d):
+		return true
+	}
+}
+
 // 发送json rpc请求
-func (r *JsonRpc) request(rpcReq *JsonRpcRequest) ([]byte, error) {
+func (r *JsonRpc) request(rpcReq *JsonRpcRequest) (body []byte, err error) {
+	defer func() {
+		metrics.KodiRequest(rpcReq.Method, err)
+	}()
+
 	if rpcReq.JsonRpc == "" {
 		rpcReq.JsonRpc = "2.0"
 	}
@@ -66,7 +141,7 @@ func (r *JsonRpc) request(rpcReq *JsonRpcRequest) ([]byte, error) {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, r.config.JsonRpc, bytes.NewReader(jsonBytes))
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodPost, r.config.JsonRpc, bytes.NewReader(jsonBytes))
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package kodi
 
 import (
+	"context"
 	"fengqi/kodi-metadata-tmdb-cli/config"
 	"sync"
 )
@@ -16,11 +17,14 @@ const (
 )
 
 type JsonRpc struct {
+	ctx          context.Context // 取消后停止消费任务
 	config       *config.KodiConfig
 	refreshQueue map[string]struct{}
 	refreshLock  *sync.RWMutex
 	scanQueue    map[string]struct{}
 	scanLock     *sync.RWMutex
+	wake         chan struct{} // 关闭后唤醒正在等待的消费任务，立即执行
+	wakeLock     *sync.Mutex
 	VideoLibrary *VideoLibrary
 	Files        *Files
 	XBMC         *XBMC
@@ -1,6 +1,7 @@
 package kodi
 
 import (
+	jobs "fengqi/kodi-metadata-tmdb-cli/queue"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"fmt"
 	"strconv"
@@ -10,7 +11,7 @@ import (
 
 // AddRefreshTask 添加刷新数据任务
 func (r *JsonRpc) AddRefreshTask(task TaskRefresh, value string) {
-	if !r.config.Enable {
+	if !r.config.Enable || utils.DryRun {
 		return
 	}
 
@@ -22,6 +23,7 @@ func (r *JsonRpc) AddRefreshTask(task TaskRefresh, value string) {
 	taskName := fmt.Sprintf("%.02d|-|%s", task, value)
 	if _, ok := r.refreshQueue[taskName]; !ok {
 		r.refreshQueue[taskName] = struct{}{}
+		jobs.Jobs.Enqueue(jobs.KindKodiRefresh, taskName)
 	}
 
 	return
@@ -35,33 +37,45 @@ func (r *JsonRpc) ConsumerRefreshTask() {
 
 	for {
 		if len(r.refreshQueue) == 0 || !r.Ping() || r.VideoLibrary.IsScanning() {
-			time.Sleep(time.Second * 30)
+			if !r.sleep(time.Second * 30) {
+				return
+			}
 			continue
 		}
 
-		for queue := range r.refreshQueue {
-			_task, _ := strconv.Atoi(queue[0:2])
-			task := TaskRefresh(_task)
-
-			r.refreshLock.Lock()
-
-			switch task {
-			case TaskRefreshTVShow:
-				r.RefreshShows(queue[5:])
-				break
-			case TaskRefreshEpisode:
-				r.RefreshEpisode(queue[5:])
-				break
-			case TaskRefreshMovie:
-				r.RefreshMovie(queue[5:])
-				break
-			case TaskRefreshMusicVideo:
-				r.RefreshMusicVideo(queue[5:])
-			}
+		r.consumeRefreshQueue()
+	}
+}
+
+// 执行当前队列中的所有刷新任务
+func (r *JsonRpc) consumeRefreshQueue() {
+	for queue := range r.refreshQueue {
+		if r.ctx.Err() != nil {
+			return
+		}
 
-			delete(r.refreshQueue, queue)
-			r.refreshLock.Unlock()
+		_task, _ := strconv.Atoi(queue[0:2])
+		task := TaskRefresh(_task)
+
+		r.refreshLock.Lock()
+
+		switch task {
+		case TaskRefreshTVShow:
+			r.RefreshShows(queue[5:])
+			break
+		case TaskRefreshEpisode:
+			r.RefreshEpisode(queue[5:])
+			break
+		case TaskRefreshMovie:
+			r.RefreshMovie(queue[5:])
+			break
+		case TaskRefreshMusicVideo:
+			r.RefreshMusicVideo(queue[5:])
 		}
+
+		delete(r.refreshQueue, queue)
+		r.refreshLock.Unlock()
+		jobs.Jobs.Finish(jobs.KindKodiRefresh, queue, true, nil)
 	}
 }
 
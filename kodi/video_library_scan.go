@@ -1,13 +1,14 @@
 package kodi
 
 import (
+	"fengqi/kodi-metadata-tmdb-cli/queue"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"strings"
 	"time"
 )
 
 func (r *JsonRpc) AddScanTask(directory string) {
-	if !r.config.Enable {
+	if !r.config.Enable || utils.DryRun {
 		return
 	}
 
@@ -30,6 +31,7 @@ func (r *JsonRpc) AddScanTask(directory string) {
 
 	if _, ok := r.scanQueue[directory]; !ok {
 		r.scanQueue[directory] = struct{}{}
+		queue.Jobs.Enqueue(queue.KindKodiScan, directory)
 	}
 
 	return
@@ -42,22 +44,36 @@ func (r *JsonRpc) ConsumerScanTask() {
 
 	for {
 		if len(r.scanQueue) == 0 || !r.Ping() || r.VideoLibrary.IsScanning() {
-			time.Sleep(time.Second * 30)
+			if !r.sleep(time.Second * 30) {
+				return
+			}
 			continue
 		}
 
 		if !r.VideoLibrary.scanLimiter.take() {
-			time.Sleep(time.Second * 30)
+			if !r.sleep(time.Second * 30) {
+				return
+			}
 			continue
 		}
 
-		for directory := range r.scanQueue {
-			r.scanLock.Lock()
-
-			r.VideoLibrary.Scan(directory, true)
+		r.consumeScanQueue()
+	}
+}
 
-			delete(r.scanQueue, directory)
-			r.scanLock.Unlock()
+// 执行当前队列中的所有扫描任务
+func (r *JsonRpc) consumeScanQueue() {
+	for directory := range r.scanQueue {
+		if r.ctx.Err() != nil {
+			return
 		}
+
+		r.scanLock.Lock()
+
+		r.VideoLibrary.Scan(directory, true)
+
+		delete(r.scanQueue, directory)
+		r.scanLock.Unlock()
+		queue.Jobs.Finish(queue.KindKodiScan, directory, true, nil)
 	}
 }
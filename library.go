@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// 查询条目索引中的条目
+// kodi-tmdb -config config.json list [--kind show] [--status failed] [--reason review] [--missing poster] [--since 7d] [--title name] [--json] [path]
+func runList(c *config.Config, args []string) int {
+	var outputJson bool
+	var since string
+	filter := library.Filter{}
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	flagSet.BoolVar(&outputJson, "json", false, "output as json")
+	flagSet.StringVar(&filter.Kind, "kind", "", "only items with kind: movie, show, episode, music_video")
+	flagSet.StringVar(&filter.Status, "status", "", "only items with status: ok, failed")
+	flagSet.StringVar(&filter.Reason, "reason", "", "only failed items with reason: not_found, review, http, parse, other")
+	flagSet.StringVar(&filter.Missing, "missing", "", "only items missing: nfo, poster, fanart, thumb")
+	flagSet.StringVar(&since, "since", "", "only items added since: 7d, 12h or 2006-01-02")
+	flagSet.StringVar(&filter.Title, "title", "", "only items whose title contains")
+	_ = flagSet.Parse(args)
+
+	if since != "" {
+		t, err := parseSince(since)
+		if err != nil {
+			fmt.Printf("invalid since: %s\n", since)
+			return 2
+		}
+		filter.Since = t
+	}
+	if flagSet.NArg() > 0 {
+		path, err := filepath.Abs(flagSet.Arg(0))
+		if err != nil {
+			fmt.Printf("invalid path: %s\n", flagSet.Arg(0))
+			return 2
+		}
+		filter.Under = path
+	}
+
+	store, err := library.Open(library.IndexFile(c.Collector.StateDir))
+	if err != nil {
+		fmt.Printf("open library index err: %v\n", err)
+		return 1
+	}
+	items := store.List(filter)
+
+	if outputJson {
+		return printJson(items)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KIND\tSTATUS\tTMDB\tYEAR\tSE\tARTWORK\tADDED\tSCRAPED\tTITLE\tPATH")
+	for _, item := range items {
+		se := ""
+		if item.Kind == library.KindEpisode {
+			se = fmt.Sprintf("S%02dE%02d", item.Season, item.Episode)
+		} else if item.Season > 0 {
+			se = fmt.Sprintf("S%02d", item.Season)
+		}
+		status := item.Status
+		if item.Reason != "" {
+			status += "(" + item.Reason + ")"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", item.Kind, status, item.TmdbId, item.Year, se,
+			strings.Join(item.Artwork, ","), formatTime(item.AddedAt), formatTime(item.ScrapedAt), item.Title, item.Path)
+	}
+	_ = w.Flush()
+	fmt.Printf("total: %d\n", len(items))
+
+	return 0
+}
+
+// 显示单个条目的详情，剧集同时显示索引中的分集
+// kodi-tmdb -config config.json show path
+func runShow(c *config.Config, args []string) int {
+	if len(args) != 1 {
+		fmt.Println("usage: show path")
+		return 2
+	}
+
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		fmt.Printf("invalid path: %s\n", args[0])
+		return 2
+	}
+
+	store, err := library.Open(library.IndexFile(c.Collector.StateDir))
+	if err != nil {
+		fmt.Printf("open library index err: %v\n", err)
+		return 1
+	}
+
+	item := store.Get(path)
+	if item == nil {
+		fmt.Printf("%s not in library index\n", path)
+		return 1
+	}
+
+	detail := struct {
+		*library.Item
+		Episodes []*library.Item `json:"episodes,omitempty"`
+	}{Item: item}
+	if item.Kind == library.KindShow {
+		detail.Episodes = store.List(library.Filter{Kind: library.KindEpisode, Under: path})
+	}
+
+	return printJson(detail)
+}
+
+// 按类型统计条目索引，指定路径时只统计路径下的条目
+// kodi-tmdb -config config.json stats [--json] [path]
+func runStats(c *config.Config, args []string) int {
+	var outputJson bool
+	flagSet := flag.NewFlagSet("stats", flag.ExitOnError)
+	flagSet.BoolVar(&outputJson, "json", false, "output as json")
+	_ = flagSet.Parse(args)
+
+	filter := library.Filter{}
+	if flagSet.NArg() > 0 {
+		path, err := filepath.Abs(flagSet.Arg(0))
+		if err != nil {
+			fmt.Printf("invalid path: %s\n", flagSet.Arg(0))
+			return 2
+		}
+		filter.Under = path
+	}
+
+	store, err := library.Open(library.IndexFile(c.Collector.StateDir))
+	if err != nil {
+		fmt.Printf("open library index err: %v\n", err)
+		return 1
+	}
+	stats := store.Stats(filter)
+
+	if outputJson {
+		return printJson(stats)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KIND\tTOTAL\tFAILED\tNO NFO\tNO POSTER\tNO FANART\tNO THUMB\tADDED 7D\tLAST UPDATE")
+	for _, stat := range stats {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", stat.Kind, stat.Total, stat.Failed, stat.NoNfo,
+			stat.NoArtwork[library.ArtworkPoster], stat.NoArtwork[library.ArtworkFanart], stat.NoArtwork[library.ArtworkThumb],
+			stat.AddedWeek, formatTime(stat.LastUpdate))
+	}
+	_ = w.Flush()
+
+	return 0
+}
+
+// 退出前把条目索引写入文件
+func flushLibrary() {
+	if err := library.Index.Flush(); err != nil {
+		utils.Logger.ErrorF("save library index err: %v", err)
+	}
+}
+
+// 解析时间范围：7d、12h 等表示从现在往前，或者具体日期 2006-01-02
+func parseSince(since string) (time.Time, error) {
+	if days, ok := strings.CutSuffix(since, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Now().AddDate(0, 0, -n), nil
+	}
+
+	if duration, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	return time.ParseInLocation("2006-01-02", since, time.Local)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func printJson(v any) int {
+	bytes, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		fmt.Printf("marshal json err: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(bytes))
+	return 0
+}
@@ -0,0 +1,418 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Index 已刮削条目的索引，未初始化时所有操作都是空操作
+var Index *Store
+
+// 各类条目应该有的图片
+var expectedArtwork = map[string][]string{
+	KindMovie:      {ArtworkPoster, ArtworkFanart},
+	KindShow:       {ArtworkPoster, ArtworkFanart},
+	KindEpisode:    {ArtworkThumb},
+	KindMusicVideo: {ArtworkThumb},
+}
+
+// InitLibrary 从状态目录加载索引，并定时把修改写入文件
+func InitLibrary(ctx context.Context, config *config.CollectorConfig) {
+	store, err := Open(IndexFile(config.StateDir))
+	if err != nil {
+		utils.Logger.ErrorF("open library index in %s err: %v", config.StateDir, err)
+		return
+	}
+
+	Index = store
+	go func() {
+		ticker := time.NewTicker(time.Second * 10)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := store.Flush(); err != nil {
+					utils.Logger.WarningF("save library index err: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// IndexFile 索引文件
+func IndexFile(stateDir string) string {
+	return filepath.Join(stateDir, "library.json")
+}
+
+// Open 加载索引文件，不存在时创建目录
+func Open(file string) (*Store, error) {
+	s := &Store{
+		lock:    &sync.Mutex{},
+		file:    file,
+		items:   make(map[string]*Item, 0),
+		removed: make(map[string]bool, 0),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+
+	items, err := readItems(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		s.items[item.Path] = item
+	}
+
+	return s, nil
+}
+
+// Update 记录条目的处理结果，err 不为空时只更新状态，保留上次成功时的信息，和已经记录的一致时不修改
+func (s *Store) Update(item *Item, scraped bool, err error) {
+	if s == nil || item == nil || item.Path == "" {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	item.Path = filepath.Clean(item.Path)
+	if item.Artwork == nil {
+		item.Artwork = make([]string, 0)
+	}
+
+	old, ok := s.items[item.Path]
+	if err != nil {
+		// 和上次失败的原因一样时不需要重新写入
+		if ok && old.Status == StatusFailed && old.Reason == queue.Reason(err) && old.Error == err.Error() {
+			return
+		}
+		if !ok {
+			old = item
+			old.AddedAt = now
+			s.items[item.Path] = old
+		}
+		old.Status = StatusFailed
+		old.Reason = queue.Reason(err)
+		old.Error = err.Error()
+		old.UpdatedAt = now
+		delete(s.removed, item.Path)
+		s.dirty = true
+		return
+	}
+
+	item.Status = StatusOk
+	item.Reason, item.Error = "", ""
+	// 定时扫描时大部分条目都没有变化，不修改索引，避免每次都重写文件
+	if ok && !scraped && old.equal(item) {
+		return
+	}
+	item.AddedAt, item.ScrapedAt = now, now
+	if ok {
+		item.AddedAt, item.ScrapedAt = old.AddedAt, old.ScrapedAt
+	}
+	if scraped {
+		item.ScrapedAt = now
+	} else if !ok && item.NfoFile != "" {
+		// 第一次加入索引时NFO已经存在，使用NFO的修改时间
+		if info, err := os.Stat(item.NfoFile); err == nil {
+			item.ScrapedAt = info.ModTime()
+		}
+	}
+	item.UpdatedAt = now
+
+	s.items[item.Path] = item
+	delete(s.removed, item.Path)
+	s.dirty = true
+}
+
+// 除了时间以外的信息是否一致
+func (i *Item) equal(other *Item) bool {
+	return i.Path == other.Path && i.Kind == other.Kind && i.Title == other.Title && i.Year == other.Year &&
+		i.TmdbId == other.TmdbId && i.Show == other.Show && i.Season == other.Season && i.Episode == other.Episode &&
+		i.NfoFile == other.NfoFile && slices.Equal(i.Artwork, other.Artwork) &&
+		i.Status == other.Status && i.Reason == other.Reason && i.Error == other.Error
+}
+
+// Remove 删除路径和它下面的所有条目，用于处理对象已经不存在的情况
+func (s *Store) Remove(path string) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	path = filepath.Clean(path)
+	for key := range s.items {
+		if key == path || strings.HasPrefix(key, path+string(filepath.Separator)) {
+			delete(s.items, key)
+			s.removed[key] = true
+			s.dirty = true
+		}
+	}
+}
+
+// Move 条目移动到新的路径后，路径和它下面的所有条目跟着移动
+func (s *Store) Move(oldPath, newPath string) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	moved := make(map[string]*Item, 0)
+	for key, item := range s.items {
+		if key == oldPath || strings.HasPrefix(key, oldPath+string(filepath.Separator)) {
+			moved[key] = item
+		}
+	}
+
+	for key, item := range moved {
+		item.Path = movePath(item.Path, oldPath, newPath)
+		item.Show = movePath(item.Show, oldPath, newPath)
+		item.NfoFile = movePath(item.NfoFile, oldPath, newPath)
+		item.UpdatedAt = time.Now()
+		delete(s.items, key)
+		s.removed[key] = true
+		s.items[item.Path] = item
+		delete(s.removed, item.Path)
+		s.dirty = true
+	}
+}
+
+// Get 返回单个条目，不存在时返回nil
+func (s *Store) Get(path string) *Item {
+	if s == nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	item, ok := s.items[filepath.Clean(path)]
+	if !ok {
+		return nil
+	}
+	copied := *item
+	return &copied
+}
+
+// List 按路径顺序返回符合条件的条目
+func (s *Store) List(filter Filter) []*Item {
+	items := make([]*Item, 0)
+	if s == nil {
+		return items
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, item := range s.items {
+		if filter.Match(item) {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Path < items[j].Path
+	})
+
+	return items
+}
+
+// Stats 按类型统计符合条件的条目数量、失败和缺少NFO、图片的数量
+func (s *Store) Stats(filter Filter) []*Stats {
+	stats := make([]*Stats, 0)
+	if s == nil {
+		return stats
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	week := time.Now().Add(-time.Hour * 24 * 7)
+	kinds := make(map[string]*Stats, 0)
+	for _, kind := range []string{KindMovie, KindShow, KindEpisode, KindMusicVideo} {
+		kinds[kind] = &Stats{Kind: kind, NoArtwork: make(map[string]int, 0)}
+		stats = append(stats, kinds[kind])
+	}
+
+	for _, item := range s.items {
+		stat, ok := kinds[item.Kind]
+		if !ok || !filter.Match(item) {
+			continue
+		}
+
+		stat.Total++
+		if item.Status == StatusFailed {
+			stat.Failed++
+		}
+		if item.MissingNfo() {
+			stat.NoNfo++
+		}
+		for _, artwork := range expectedArtwork[item.Kind] {
+			if item.Missing(artwork) {
+				stat.NoArtwork[artwork]++
+			}
+		}
+		if item.AddedAt.After(week) {
+			stat.AddedWeek++
+		}
+		if item.UpdatedAt.After(stat.LastUpdate) {
+			stat.LastUpdate = item.UpdatedAt
+		}
+	}
+
+	return stats
+}
+
+// Flush 把修改写入文件，先合并其他进程（常驻进程和单次扫描）写入的条目，
+// 再写临时文件后重命名，避免退出时写坏
+func (s *Store) Flush() error {
+	if s == nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	saved, err := readItems(s.file)
+	if err != nil {
+		return err
+	}
+	for _, item := range saved {
+		if s.removed[item.Path] {
+			continue
+		}
+		if old, ok := s.items[item.Path]; !ok || item.UpdatedAt.After(old.UpdatedAt) {
+			s.items[item.Path] = item
+		}
+	}
+
+	items := make([]*Item, 0, len(s.items))
+	for _, item := range s.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Path < items[j].Path
+	})
+
+	bytes, err := json.MarshalIndent(items, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+	if err = os.WriteFile(tmp, bytes, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.file); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	s.removed = make(map[string]bool, 0)
+	s.dirty = false
+	return nil
+}
+
+// Match 是否符合查询条件
+func (f Filter) Match(item *Item) bool {
+	switch {
+	case f.Kind != "" && item.Kind != f.Kind:
+		return false
+	case f.Status != "" && item.Status != f.Status:
+		return false
+	case f.Reason != "" && item.Reason != f.Reason:
+		return false
+	case f.Missing == "nfo" && !item.MissingNfo():
+		return false
+	case f.Missing != "" && f.Missing != "nfo" && !item.Missing(f.Missing):
+		return false
+	case !f.Since.IsZero() && item.AddedAt.Before(f.Since):
+		return false
+	case f.Under != "" && item.Path != filepath.Clean(f.Under) && !strings.HasPrefix(item.Path, filepath.Clean(f.Under)+string(filepath.Separator)):
+		return false
+	case f.Title != "" && !strings.Contains(strings.ToLower(item.Title), strings.ToLower(f.Title)):
+		return false
+	}
+	return true
+}
+
+// Missing 是否缺少这类条目应该有的图片
+func (i *Item) Missing(artwork string) bool {
+	return utils.InArray(expectedArtwork[i.Kind], artwork) && !utils.InArray(i.Artwork, artwork)
+}
+
+// MissingNfo 是否缺少NFO
+func (i *Item) MissingNfo() bool {
+	return i.NfoFile == ""
+}
+
+// ExistingNfo NFO存在时返回文件路径，否则返回空
+func ExistingNfo(file string) string {
+	if file != "" && utils.FileExist(file) {
+		return file
+	}
+	return ""
+}
+
+// ExistingArtwork 返回已经存在的图片，files 为图片类型和对应的文件
+func ExistingArtwork(files map[string]string) []string {
+	artwork := make([]string, 0)
+	for kind, file := range files {
+		if file != "" && utils.FileExist(file) {
+			artwork = append(artwork, kind)
+		}
+	}
+	sort.Strings(artwork)
+	return artwork
+}
+
+func readItems(file string) ([]*Item, error) {
+	items := make([]*Item, 0)
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return items, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(bytes, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func movePath(path, oldPath, newPath string) string {
+	if path == oldPath {
+		return newPath
+	}
+	if strings.HasPrefix(path, oldPath+string(filepath.Separator)) {
+		return newPath + strings.TrimPrefix(path, oldPath)
+	}
+	return path
+}
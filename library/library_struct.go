@@ -0,0 +1,78 @@
+package library
+
+import (
+	"sync"
+	"time"
+)
+
+// 条目类型
+const (
+	KindMovie      = "movie"
+	KindShow       = "show"
+	KindEpisode    = "episode"
+	KindMusicVideo = "music_video"
+)
+
+// 条目状态
+const (
+	StatusOk     = "ok"
+	StatusFailed = "failed"
+)
+
+// 图片类型
+const (
+	ArtworkPoster    = "poster"
+	ArtworkFanart    = "fanart"
+	ArtworkClearlogo = "clearlogo"
+	ArtworkThumb     = "thumb"
+)
+
+type Store struct {
+	lock    *sync.Mutex
+	file    string
+	items   map[string]*Item
+	removed map[string]bool // 删除后还没有写入文件的条目，合并文件时不再加回来
+	dirty   bool            // 有修改还没有写入文件
+}
+
+// Item 已经刮削的条目
+type Item struct {
+	Path      string    `json:"path"` // 电影目录或文件、剧集目录、分集文件、音乐视频文件的完整路径
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title"`
+	Year      int       `json:"year,omitempty"`
+	TmdbId    int       `json:"tmdb_id,omitempty"` // 分集为所属剧集的id
+	Show      string    `json:"show,omitempty"`    // 分集所属的剧集目录
+	Season    int       `json:"season,omitempty"`
+	Episode   int       `json:"episode,omitempty"`
+	NfoFile   string    `json:"nfo_file,omitempty"` // 已经存在的NFO，为空表示没有NFO
+	Artwork   []string  `json:"artwork"`            // 已经存在的图片：poster、fanart、clearlogo、thumb
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"` // 失败原因，和任务队列一致
+	Error     string    `json:"error,omitempty"`
+	ScrapedAt time.Time `json:"scraped_at"` // 最后一次写入NFO的时间
+	AddedAt   time.Time `json:"added_at"`   // 第一次加入索引的时间
+	UpdatedAt time.Time `json:"updated_at"` // 最后一次处理后有变化的时间
+}
+
+// Filter 查询条件，空值表示不限制
+type Filter struct {
+	Kind    string
+	Status  string
+	Reason  string
+	Missing string    // 缺少的图片，nfo 表示缺少NFO
+	Since   time.Time // 在这个时间之后加入索引
+	Under   string    // 在这个目录下
+	Title   string    // 标题包含，不区分大小写
+}
+
+// Stats 按类型统计
+type Stats struct {
+	Kind       string         `json:"kind"`
+	Total      int            `json:"total"`
+	Failed     int            `json:"failed"`
+	NoNfo      int            `json:"no_nfo"`
+	NoArtwork  map[string]int `json:"no_artwork"` // 缺少各类图片的数量
+	AddedWeek  int            `json:"added_week"` // 最近7天加入
+	LastUpdate time.Time      `json:"last_update"`
+}
@@ -0,0 +1,125 @@
+package library
+
+import (
+	"fengqi/kodi-metadata-tmdb-cli/tmdb"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "library.json")
+	s, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Update(&Item{Path: "/shows/a", Kind: KindShow, Title: "A", TmdbId: 1, NfoFile: "/shows/a/tvshow.nfo", Artwork: []string{ArtworkFanart}}, true, nil)
+	s.Update(&Item{Path: "/shows/a/S01E01.mkv", Kind: KindEpisode, Show: "/shows/a", Season: 1, Episode: 1}, false, nil)
+	s.Update(&Item{Path: "/movies/b", Kind: KindMovie, Title: "B"}, false, fmt.Errorf("search movie %w", tmdb.ErrLowConfidence))
+	if err = s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他进程写入的条目在写入文件时合并
+	other, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Update(&Item{Path: "/movies/c", Kind: KindMovie, Title: "C", Artwork: []string{ArtworkPoster, ArtworkFanart}}, true, nil)
+	if err = other.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 失败时保留上次成功的信息
+	time.Sleep(time.Millisecond)
+	s.Update(&Item{Path: "/shows/a", Kind: KindShow}, false, fmt.Errorf("get tv detail %w", tmdb.ErrNotFound))
+	if err = s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := s.List(Filter{}); len(items) != 4 {
+		t.Fatalf("list all want 4 items, give %d", len(items))
+	}
+
+	show := s.Get("/shows/a/")
+	if show == nil || show.Title != "A" || show.TmdbId != 1 || show.Status != StatusFailed || show.Reason != "not_found" || show.ScrapedAt.IsZero() {
+		t.Errorf("failed show want previous info, give %+v", show)
+	}
+
+	noPoster := s.List(Filter{Missing: ArtworkPoster})
+	if len(noPoster) != 2 || noPoster[0].Path != "/movies/b" || noPoster[1].Path != "/shows/a" {
+		t.Errorf("missing poster want /movies/b /shows/a, give %+v", noPoster)
+	}
+	if review := s.List(Filter{Reason: "review"}); len(review) != 1 || review[0].Path != "/movies/b" {
+		t.Errorf("reason review want /movies/b, give %+v", review)
+	}
+	if recent := s.List(Filter{Since: time.Now().Add(-time.Hour), Kind: KindMovie}); len(recent) != 2 {
+		t.Errorf("added since want 2 movies, give %+v", recent)
+	}
+
+	s.Move("/shows/a", "/storage/A (2020)")
+	episodes := s.List(Filter{Kind: KindEpisode, Under: "/storage/A (2020)"})
+	if len(episodes) != 1 || episodes[0].Show != "/storage/A (2020)" || s.Get("/shows/a") != nil {
+		t.Errorf("move show want episodes moved, give %+v", episodes)
+	}
+
+	s.Remove("/storage/A (2020)")
+	stats := s.Stats(Filter{})
+	if stats[0].Kind != KindMovie || stats[0].Total != 2 || stats[0].Failed != 1 || stats[0].NoArtwork[ArtworkPoster] != 1 || stats[1].Total != 0 {
+		t.Errorf("stats after remove give %+v %+v", stats[0], stats[1])
+	}
+	if err = s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ = Open(file); len(s.List(Filter{})) != 2 {
+		t.Errorf("removed items want not merged back, give %+v", s.List(Filter{}))
+	}
+}
+
+func TestStoreUpdateUnchanged(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "library.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := func() *Item {
+		return &Item{Path: "/movies/a", Kind: KindMovie, Title: "A", TmdbId: 1, Artwork: []string{ArtworkFanart, ArtworkPoster}}
+	}
+	s.Update(item(), true, nil)
+	if err = s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	updated := s.Get("/movies/a").UpdatedAt
+
+	// 没有变化时不修改，不需要重写文件
+	time.Sleep(time.Millisecond)
+	s.Update(item(), false, nil)
+	if s.dirty || !s.Get("/movies/a").UpdatedAt.Equal(updated) {
+		t.Errorf("unchanged update want not dirty, give %+v", s.Get("/movies/a"))
+	}
+
+	changed := item()
+	changed.Artwork = []string{ArtworkPoster}
+	s.Update(changed, false, nil)
+	if !s.dirty {
+		t.Errorf("changed artwork want dirty")
+	}
+	_ = s.Flush()
+
+	// 同样的失败只记录一次
+	s.Update(item(), false, fmt.Errorf("get movie detail %w", tmdb.ErrNotFound))
+	if !s.dirty {
+		t.Errorf("first failure want dirty")
+	}
+	_ = s.Flush()
+	s.Update(item(), false, fmt.Errorf("get movie detail %w", tmdb.ErrNotFound))
+	if s.dirty {
+		t.Errorf("same failure want not dirty")
+	}
+}
@@ -1,54 +1,169 @@
 package main
 
 import (
+	"context"
 	"fengqi/kodi-metadata-tmdb-cli/config"
 	"fengqi/kodi-metadata-tmdb-cli/ffmpeg"
 	"fengqi/kodi-metadata-tmdb-cli/kodi"
+	"fengqi/kodi-metadata-tmdb-cli/library"
 	"fengqi/kodi-metadata-tmdb-cli/movies"
 	"fengqi/kodi-metadata-tmdb-cli/music_videos"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+	"fengqi/kodi-metadata-tmdb-cli/server"
 	"fengqi/kodi-metadata-tmdb-cli/shows"
 	"fengqi/kodi-metadata-tmdb-cli/tmdb"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"fengqi/kodi-metadata-tmdb-cli/webdav"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"sync"
+	"syscall"
+	"time"
 )
 
 var (
 	configFile   string
 	version      bool
+	planFormat   string
 	buildVersion = "dev-master"
 )
 
 func init() {
 	flag.StringVar(&configFile, "config", "./config.json", "config file")
 	flag.BoolVar(&version, "version", false, "display version")
-	flag.Parse()
+	flag.BoolVar(&utils.DryRun, "dry-run", false, "only print planned file changes, implies scan")
+	flag.StringVar(&planFormat, "plan-format", "table", "dry run plan format: table or json")
 }
 
 func main() {
+	flag.Parse()
 	if version {
 		fmt.Printf("version: %s, build with: %s\n", buildVersion, runtime.Version())
 		return
 	}
 
 	c := config.LoadConfig(configFile)
-
 	utils.InitLogger(c.Log.Mode, c.Log.Level, c.Log.File)
-	tmdb.InitTmdb(c.Tmdb)
-	kodi.InitKodi(c.Kodi)
-	ffmpeg.InitFfmpeg(c.Ffmpeg)
+
+	// 收到退出信号后不再接收新的任务，正在处理的任务在超时前可以继续完成，
+	// 超时后取消TMDB请求并结束ffmpeg子进程
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	shutdownTimeout := time.Second * time.Duration(c.Collector.ShutdownSeconds)
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = time.Second * 30
+	}
+	context.AfterFunc(ctx, func() {
+		utils.Logger.InfoF("receive shutdown signal, waiting at most %s for running tasks", shutdownTimeout)
+		time.AfterFunc(shutdownTimeout, cancelWork)
+	})
+
+	// 演习模式只支持单次扫描
+	command, args := flag.Arg(0), flag.Args()
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	if utils.DryRun && command == "" {
+		command = "scan"
+	}
+
+	// 任务队列和接口缓存默认保存在配置文件所在目录
+	if c.Collector.StateDir == "" {
+		c.Collector.StateDir = filepath.Join(filepath.Dir(configFile), "state")
+	}
+	if c.Tmdb.ResponseCacheDir == "" {
+		c.Tmdb.ResponseCacheDir = filepath.Join(c.Collector.StateDir, "tmdb")
+	}
+
+	// 配置了统一缓存目录时不再在每个条目下创建 tmdb 目录
+	utils.CacheRoot = c.Collector.CacheDir
+
+	// 持久化队列只在常驻运行时使用，避免和同时运行的单次扫描互相覆盖
+	if command == "" {
+		queue.InitQueue(workCtx, c.Collector)
+	}
+
+	// 条目索引由刮削的命令更新，演习模式不写入
+	if (command == "" || command == "scan" || command == "identify") && !utils.DryRun {
+		library.InitLibrary(workCtx, c.Collector)
+	}
+
+	tmdb.InitTmdb(workCtx, c.Tmdb)
+	kodi.InitKodi(ctx, c.Kodi)
+	ffmpeg.InitFfmpeg(workCtx, c.Ffmpeg)
 	webdav.InitWebDAV(c.WebDAV)
 
+	switch command {
+	case "scan":
+		code := runScan(ctx, c, args)
+		flushLibrary()
+		utils.Logger.Close()
+		os.Exit(code)
+	case "failed":
+		os.Exit(runFailed(c, args))
+	case "review":
+		// 匹配度太低需要人工确认的条目
+		os.Exit(runFailed(c, append([]string{"list", "-reason", queue.ReasonReview}, args...)))
+	case "expire":
+		os.Exit(runExpire(c, args))
+	case "migrate":
+		os.Exit(runMigrate(c, args))
+	case "list":
+		os.Exit(runList(c, args))
+	case "show":
+		os.Exit(runShow(c, args))
+	case "stats":
+		os.Exit(runStats(c, args))
+	case "identify":
+		code := runIdentify(ctx, c, args)
+		flushLibrary()
+		utils.Logger.Close()
+		os.Exit(code)
+	case "":
+	default:
+		fmt.Printf("unknown command: %s\n", command)
+		os.Exit(2)
+	}
+
 	wg := &sync.WaitGroup{}
 	wg.Add(3)
 	// 刮削电影
-	go movies.RunCollector(c, wg)
+	go movies.RunCollector(ctx, c, wg)
 	//刮削剧集
-	go shows.RunCollector(c, wg)
+	go shows.RunCollector(ctx, c, wg)
 	// 刮削音乐剧
-	go music_videos.RunCollector(c, wg)
-	wg.Wait()
+	go music_videos.RunCollector(ctx, c, wg)
+	// 状态和控制接口
+	server.InitServer(ctx, c)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-workCtx.Done():
+		// 已经超时，给被取消的任务一点时间清理临时文件
+		select {
+		case <-done:
+		case <-time.After(time.Second * 5):
+			utils.Logger.Warning("shutdown timeout, some tasks are not finished")
+		}
+	}
+
+	if err := queue.Jobs.Flush(); err != nil {
+		utils.Logger.ErrorF("save job queue err: %v", err)
+	}
+	flushLibrary()
+
+	utils.Logger.Info("bye")
+	utils.Logger.Close()
 }
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Namespace 指标名称的前缀
+const Namespace = "kodi_tmdb"
+
+// 成功、失败等结果标签
+const (
+	ResultOk    = "ok"
+	ResultError = "error"
+	ResultHit   = "hit"
+	ResultMiss  = "miss"
+)
+
+// 耗时直方图的分桶，单位秒，ffmpeg 截图可能需要几十秒
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	TmdbRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "tmdb_requests_total",
+		Help:      "TMDB API requests by endpoint and http status, status is error when the request failed",
+	}, []string{"endpoint", "status"})
+	TmdbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "tmdb_request_duration_seconds",
+		Help:      "TMDB API request duration by endpoint",
+		Buckets:   durationBuckets,
+	}, []string{"endpoint"})
+	DetailCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "detail_cache_total",
+		Help:      "Detail cache lookups by kind and result",
+	}, []string{"kind", "result"})
+	ImagesDownloaded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "images_downloaded_total",
+		Help:      "Images downloaded by result",
+	}, []string{"result"})
+	ImageBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "image_bytes_total",
+		Help:      "Bytes of images downloaded",
+	})
+	FfmpegDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "ffmpeg_duration_seconds",
+		Help:      "ffprobe and ffmpeg run duration by command and result",
+		Buckets:   durationBuckets,
+	}, []string{"command", "result"})
+	WatcherEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "watcher_events_total",
+		Help:      "File watcher events by library and operation",
+	}, []string{"library", "op"})
+	KodiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "kodi_rpc_requests_total",
+		Help:      "Kodi JSON-RPC calls by method and result",
+	}, []string{"method", "result"})
+	MovedToStorage = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "moved_to_storage_total",
+		Help:      "Items moved to storage dir by library and result",
+	}, []string{"library", "result"})
+	ItemsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "items_processed_total",
+		Help:      "Items processed by kind and result",
+	}, []string{"kind", "result"})
+
+	// 最后一次处理条目的时间，用于监控处理是否卡住
+	LastProcessed = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "last_processed_timestamp_seconds",
+		Help:      "Unix time of the last processed item",
+	})
+)
+
+// 接口路径中的id，比如 /3/movie/42、/3/tv/1405/season/1
+var numericSegment = regexp.MustCompile(`^\d+$`)
+
+// Processed 记录一个处理过的条目
+func Processed(kind string, err error) {
+	ItemsProcessed.WithLabelValues(kind, Result(err)).Inc()
+	LastProcessed.SetToCurrentTime()
+}
+
+// CacheLookup 记录详情缓存是否命中
+func CacheLookup(kind string, hit bool) {
+	result := ResultMiss
+	if hit {
+		result = ResultHit
+	}
+	DetailCache.WithLabelValues(kind, result).Inc()
+}
+
+// TmdbRequest 记录一次TMDB接口请求，code 为0表示请求没有完成
+func TmdbRequest(api string, code int, duration time.Duration) {
+	endpoint := Endpoint(api)
+	status := ResultError
+	if code > 0 {
+		status = strconv.Itoa(code)
+	}
+	TmdbRequests.WithLabelValues(endpoint, status).Inc()
+	TmdbDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+}
+
+// ImageDownload 记录一次图片下载
+func ImageDownload(size int64, err error) {
+	if err != nil {
+		ImagesDownloaded.WithLabelValues(ResultError).Inc()
+		return
+	}
+	ImagesDownloaded.WithLabelValues(ResultOk).Inc()
+	ImageBytes.Add(float64(max(size, 0)))
+}
+
+// Ffmpeg 记录一次 ffprobe 或 ffmpeg 执行
+func Ffmpeg(command string, start time.Time, err error) {
+	FfmpegDuration.WithLabelValues(command, Result(err)).Observe(time.Since(start).Seconds())
+}
+
+// KodiRequest 记录一次Kodi的JSON-RPC调用
+func KodiRequest(method string, err error) {
+	KodiRequests.WithLabelValues(method, Result(err)).Inc()
+}
+
+// MoveToStorage 记录一次移动到存储目录
+func MoveToStorage(library string, err error) {
+	MovedToStorage.WithLabelValues(library, Result(err)).Inc()
+}
+
+// WatcherEvent 记录一个文件监听事件，同时包含多个操作时分别计数
+func WatcherEvent(library string, event fsnotify.Event) {
+	for _, op := range []fsnotify.Op{fsnotify.Create, fsnotify.Write, fsnotify.Remove, fsnotify.Rename, fsnotify.Chmod} {
+		if event.Has(op) {
+			WatcherEvents.WithLabelValues(library, strings.ToLower(op.String())).Inc()
+		}
+	}
+}
+
+// Result 按错误返回结果标签
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOk
+}
+
+// Endpoint 去掉接口路径中的id，避免标签值过多：/3/movie/42 => /3/movie/{id}
+func Endpoint(api string) string {
+	if i := strings.IndexByte(api, '?'); i >= 0 {
+		api = api[:i]
+	}
+
+	segments := strings.Split(api, "/")
+	for i, segment := range segments {
+		if numericSegment.MatchString(segment) && i > 1 {
+			segments[i] = "{id}"
+			continue
+		}
+		// 外部id和剧集组id不是数字
+		if i > 0 && (segments[i-1] == "find" || segments[i-1] == "episode_group") && segment != "" {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"/3/movie/42":                        "/3/movie/{id}",
+		"/3/tv/1405/season/1/episode/2?a=b":  "/3/tv/{id}/season/{id}/episode/{id}",
+		"/3/find/tt0903747":                  "/3/find/{id}",
+		"/3/tv/episode_group/5acf93e60e0a26": "/3/tv/episode_group/{id}",
+		"/3/search/movie":                    "/3/search/movie",
+	}
+	for api, want := range cases {
+		if give := Endpoint(api); give != want {
+			t.Errorf("Endpoint(%s) want %s, give %s", api, want, give)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	TmdbRequest("/3/movie/42", 200, time.Millisecond)
+	TmdbRequest("/3/movie/42", 0, time.Second)
+	MoveToStorage("movies", errors.New("failed"))
+	ImageDownload(1024, nil)
+	Ffmpeg("ffprobe", time.Now(), nil)
+	Processed("movie", nil)
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	text := w.Body.String()
+
+	for _, want := range []string{
+		"# TYPE kodi_tmdb_tmdb_requests_total counter\n",
+		`kodi_tmdb_tmdb_requests_total{endpoint="/3/movie/{id}",status="200"} 1` + "\n",
+		`kodi_tmdb_tmdb_requests_total{endpoint="/3/movie/{id}",status="error"} 1` + "\n",
+		`kodi_tmdb_tmdb_request_duration_seconds_bucket{endpoint="/3/movie/{id}",le="60"} 2` + "\n",
+		`kodi_tmdb_tmdb_request_duration_seconds_count{endpoint="/3/movie/{id}"} 2` + "\n",
+		`kodi_tmdb_moved_to_storage_total{library="movies",result="error"} 1` + "\n",
+		`kodi_tmdb_images_downloaded_total{result="ok"} 1` + "\n",
+		"kodi_tmdb_image_bytes_total 1024\n",
+		`kodi_tmdb_ffmpeg_duration_seconds_count{command="ffprobe",result="ok"} 1` + "\n",
+		`kodi_tmdb_items_processed_total{kind="movie",result="ok"} 1` + "\n",
+		"# TYPE kodi_tmdb_last_processed_timestamp_seconds gauge\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics text want %q\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "kodi_tmdb_last_processed_timestamp_seconds 0\n") {
+		t.Errorf("last processed timestamp want updated")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/movies"
+	"fengqi/kodi-metadata-tmdb-cli/shows"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+	"os"
+)
+
+// 迁移旧版本的文件
+// kodi-tmdb -config config.json migrate overrides [path...]
+// kodi-tmdb -config config.json migrate cache [path...]
+func runMigrate(c *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Println("usage: migrate overrides|cache [path...]")
+		return 2
+	}
+
+	target, args := args[0], args[1:]
+	switch target {
+	case "overrides":
+		return migrateOverrides(c, args)
+	case "cache":
+		return migrateCache(c, args)
+	default:
+		fmt.Printf("unknown migrate target: %s\n", target)
+		return 2
+	}
+}
+
+// 把旧的 id.txt、season.txt、group.txt、part.txt 合并成 override.json
+func migrateOverrides(c *config.Config, paths []string) int {
+	report := &migrateReport{}
+
+	// 不指定路径时处理全部电影和剧集目录
+	moviesPaths, showsPaths := make([]string, 0), make([]string, 0)
+	for _, path := range paths {
+		switch {
+		case utils.InDirs(path, c.Collector.MoviesDir) != "":
+			moviesPaths = append(moviesPaths, path)
+		case utils.InDirs(path, c.Collector.ShowsDir) != "":
+			showsPaths = append(showsPaths, path)
+		default:
+			report.add(path, false, fmt.Errorf("path not in movies or shows dir"))
+		}
+	}
+	if len(paths) == 0 || len(moviesPaths) > 0 {
+		movies.MigrateOverride(c, moviesPaths, report.add)
+	}
+	if len(paths) == 0 || len(showsPaths) > 0 {
+		shows.MigrateOverride(c, showsPaths, report.add)
+	}
+
+	return report.finish()
+}
+
+// 把每个条目下的 tmdb 目录移动到统一缓存目录
+func migrateCache(c *config.Config, paths []string) int {
+	if utils.CacheRoot == "" {
+		fmt.Println("cache_dir not configured, nothing to migrate")
+		return 2
+	}
+
+	report := &migrateReport{}
+	libraries := map[string][]string{
+		utils.CacheKindMovies:      c.Collector.MoviesDir,
+		utils.CacheKindShows:       c.Collector.ShowsDir,
+		utils.CacheKindMusicVideos: c.Collector.MusicVideosDir,
+	}
+	kinds := []string{utils.CacheKindMovies, utils.CacheKindShows, utils.CacheKindMusicVideos}
+
+	// 不指定路径时处理全部媒体库
+	if len(paths) == 0 {
+		for _, kind := range kinds {
+			for _, dir := range libraries[kind] {
+				if utils.FileExist(dir) {
+					utils.MigrateCacheDir(kind, dir, report.add)
+				}
+			}
+		}
+		return report.finish()
+	}
+
+	for _, path := range paths {
+		found := false
+		for _, kind := range kinds {
+			if utils.InDirs(path, libraries[kind]) != "" {
+				utils.MigrateCacheDir(kind, path, report.add)
+				found = true
+				break
+			}
+		}
+		if !found {
+			report.add(path, false, fmt.Errorf("path not in any library"))
+		}
+	}
+
+	return report.finish()
+}
+
+// 迁移结果统计
+type migrateReport struct {
+	migrated int
+	failed   int
+}
+
+func (r *migrateReport) add(name string, migrated bool, err error) {
+	switch {
+	case err != nil:
+		r.failed++
+		fmt.Printf("failed   %s: %v\n", name, err)
+	case migrated:
+		r.migrated++
+		fmt.Printf("migrated %s\n", name)
+	}
+}
+
+// 输出汇总，存在失败时返回非0
+func (r *migrateReport) finish() int {
+	fmt.Printf("migrated: %d, failed: %d\n", r.migrated, r.failed)
+	if utils.DryRun {
+		if err := utils.Plan.Print(os.Stdout, planFormat); err != nil {
+			utils.Logger.ErrorF("print dry run plan err: %v", err)
+		}
+	}
+
+	if r.failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,8 +1,13 @@
 package movies
 
 import (
+	"context"
+	"errors"
 	"fengqi/kodi-metadata-tmdb-cli/config"
 	"fengqi/kodi-metadata-tmdb-cli/kodi"
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"fmt"
 	"os"
@@ -14,17 +19,55 @@ import (
 
 var collector *Collector
 
-func RunCollector(config *config.Config, wg *sync.WaitGroup) {
+func RunCollector(ctx context.Context, config *config.Config, wg *sync.WaitGroup) {
 	defer wg.Done()
 	collector = &Collector{
+		ctx:     ctx,
 		config:  config,
 		channel: make(chan *Movie, 100),
 	}
 
 	collector.initWatcher()
 	go collector.runWatcher()
-	go collector.runMoviesProcess()
-	collector.runCronScan()
+	queue.Jobs.Handle(queue.KindMovie, collector.replay)
+	go func() {
+		collector.replayJobs()
+		collector.runCronScan()
+	}()
+	collector.runMoviesProcess()
+
+	_ = watcher.Close()
+	utils.Logger.Info("movies collector stopped")
+}
+
+// RunOnce 单次运行：扫描指定路径（为空时扫描配置的全部电影目录）并处理完成后返回
+func RunOnce(ctx context.Context, config *config.Config, paths []string, summary *utils.Summary) {
+	collector = &Collector{
+		ctx:    ctx,
+		config: config,
+	}
+
+	if len(paths) == 0 {
+		paths = config.Collector.MoviesDir
+	}
+
+	for _, item := range paths {
+		movieDirs, err := collector.scanPath(item)
+		if err != nil {
+			summary.Add(item, false, err)
+			continue
+		}
+
+		for _, movieDir := range movieDirs {
+			if ctx.Err() != nil {
+				return
+			}
+
+			scraped, err := collector.moviesProcess(movieDir)
+			metrics.Processed(library.KindMovie, err)
+			summary.Add(movieDir.GetFullDir(), scraped, err)
+		}
+	}
 }
 
 // 电影信息处理：来源包括cron和inotify监听的
@@ -32,32 +75,142 @@ func (c *Collector) runMoviesProcess() {
 	utils.Logger.Debug("run movies process")
 
 	for {
+		// 收到退出信号后不再处理新的任务
+		if c.ctx.Err() != nil {
+			return
+		}
+
 		select {
+		case <-c.ctx.Done():
+			return
+
 		case dir := <-c.channel:
 			utils.Logger.DebugF("receive movies task: %v", dir)
 
-			dir.checkCacheDir()
-			detail, err := dir.getMovieDetail()
-			if err != nil || detail == nil {
-				continue
+			queue.Jobs.Start(queue.KindMovie, dir.GetFullDir())
+			scraped, err := c.moviesProcess(dir)
+			metrics.Processed(library.KindMovie, err)
+			if err != nil {
+				utils.Logger.ErrorF("process movie: %s err: %v", dir.OriginTitle, err)
 			}
-
-			if !detail.FromCache || !dir.NfoExist(c.config.Collector.MoviesNfoMode) {
-				_ = dir.saveToNfo(detail, c.config.Collector.MoviesNfoMode)
-				kodi.Rpc.AddRefreshTask(kodi.TaskRefreshMovie, detail.OriginalTitle)
+			if delay, retry := queue.Jobs.Finish(queue.KindMovie, dir.GetFullDir(), scraped, err); retry {
+				utils.Logger.InfoF("retry movie: %s after %s", dir.OriginTitle, delay)
+				go c.pushAfter(dir, delay)
 			}
-			err = dir.downloadImage(detail)
-			moviesStorageDir := c.config.Collector.MoviesStorageDir
-			if c.config.Collector.MoveToStorage && err == nil && moviesStorageDir != "" {
-				err = dir.MoveToStorage(moviesStorageDir, detail.BelongsToCollection.Name, fmt.Sprintf("%s (%s)",
-					utils.SanitizeFileName(detail.Title),
-					strings.SplitN(detail.ReleaseDate, "-", 2)[0]))
-				if err != nil {
-					utils.Logger.ErrorF("移动电影: %s 到存储目录失败: %v", dir.OriginTitle, err)
+		}
+	}
+}
+
+// 添加到处理队列，已经在队列中的直接跳过，收到退出信号时放弃并返回false
+func (c *Collector) enqueue(dir *Movie) bool {
+	if !queue.Jobs.Enqueue(queue.KindMovie, dir.GetFullDir()) {
+		return true
+	}
+
+	return c.push(dir)
+}
+
+// 放入处理队列，收到退出信号时返回false，任务保留在持久化队列中下次启动时继续
+func (c *Collector) push(dir *Movie) bool {
+	select {
+	case <-c.ctx.Done():
+		return false
+	case c.channel <- dir:
+		return true
+	}
+}
+
+// 等待一段时间后放入处理队列，用于失败重试
+func (c *Collector) pushAfter(dir *Movie, delay time.Duration) {
+	select {
+	case <-c.ctx.Done():
+	case <-time.After(delay):
+		c.push(dir)
+	}
+}
+
+// 重新放入上次退出时没有处理完的任务，等待重试的任务到时间后再放入
+func (c *Collector) replayJobs() {
+	for _, job := range queue.Jobs.Unfinished(queue.KindMovie) {
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		utils.Logger.InfoF("replay unfinished movie job: %s", job.Key)
+		if delay := time.Until(job.NextRetry); delay > 0 {
+			go func(key string) {
+				select {
+				case <-c.ctx.Done():
+				case <-time.After(delay):
+					c.replay(key)
 				}
-			}
+			}(job.Key)
+			continue
+		}
+		c.replay(job.Key)
+	}
+}
+
+// 重新解析任务路径并放入处理队列，路径已经不存在时删除任务
+func (c *Collector) replay(key string) {
+	movieDirs, err := c.scanPath(key)
+	if err != nil {
+		utils.Logger.WarningF("drop movie job: %s err: %v", key, err)
+		queue.Jobs.Remove(queue.KindMovie, key)
+		if !utils.FileExist(key) {
+			library.Index.Remove(key)
+		}
+		return
+	}
+
+	for _, movieDir := range movieDirs {
+		if !c.push(movieDir) {
+			return
+		}
+	}
+}
+
+// 单个电影处理，返回是否写入了新的NFO
+func (c *Collector) moviesProcess(dir *Movie) (bool, error) {
+	dir.checkCacheDir()
+	detail, err := dir.getMovieDetail()
+	if err == nil && detail == nil {
+		err = errors.New("movie detail empty")
+	}
+	if err != nil {
+		dir.updateIndex(nil, false, err)
+		return false, err
+	}
+
+	scraped := false
+	nfoMode := c.config.Collector.MoviesNfoMode
+	// 开启 stream_details 或者视频文件被替换后也需要重新写入
+	if !detail.FromCache || !dir.NfoExist(nfoMode) || utils.ForeignNfo(dir.getNfoFile(nfoMode), detail.Id) || dir.probeStale() {
+		if err = dir.saveToNfo(detail, nfoMode); err != nil {
+			err = fmt.Errorf("save movie nfo err: %v", err)
+			dir.updateIndex(detail, false, err)
+			return false, err
+		}
+		kodi.Rpc.AddRefreshTask(kodi.TaskRefreshMovie, detail.OriginalTitle)
+		scraped = true
+	}
+
+	err = dir.downloadImage(detail)
+	dir.updateIndex(detail, scraped, nil)
+	moviesStorageDir := c.config.Collector.MoviesStorageDir
+	if c.config.Collector.MoveToStorage && err == nil && moviesStorageDir != "" {
+		err = dir.MoveToStorage(moviesStorageDir, detail.BelongsToCollection.Name, fmt.Sprintf("%s (%s)",
+			utils.SanitizeFileName(detail.Title),
+			strings.SplitN(detail.ReleaseDate, "-", 2)[0]))
+		metrics.MoveToStorage("movies", err)
+		if err != nil {
+			utils.Logger.ErrorF("移动电影: %s 到存储目录失败: %v", dir.OriginTitle, err)
+			dir.updateIndex(detail, scraped, err)
+			return scraped, err
 		}
 	}
+
+	return scraped, nil
 }
 
 // 运行定时扫描
@@ -76,7 +229,9 @@ func (c *Collector) runCronScan() {
 			}
 
 			for _, movieDir := range movieDirs {
-				c.channel <- movieDir
+				if !c.enqueue(movieDir) {
+					return
+				}
 			}
 		}
 
@@ -87,14 +242,41 @@ func (c *Collector) runCronScan() {
 
 	task()
 	ticker := time.NewTicker(time.Second * time.Duration(c.config.Collector.CronSeconds))
+	defer ticker.Stop()
 	for {
 		select {
+		case <-c.ctx.Done():
+			return
 		case <-ticker.C:
 			task()
 		}
 	}
 }
 
+// 扫描单个路径：可以是电影根目录、合集目录，也可以是单个电影目录或文件
+func (c *Collector) scanPath(path string) ([]*Movie, error) {
+	path = filepath.Clean(path)
+	if utils.InDirs(path, c.config.Collector.MoviesDir) == path {
+		return c.scanDir(path)
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if utils.IsYearRangeLike(fileInfo.Name()) != "" {
+		return c.scanDir(path)
+	}
+
+	movieDir := parseMoviesDir(filepath.Dir(path), fileInfo)
+	if movieDir == nil {
+		return nil, fmt.Errorf("parse movie: %s failed", path)
+	}
+
+	return []*Movie{movieDir}, nil
+}
+
 // 扫描普通目录，返回其中的电影
 func (c *Collector) scanDir(dir string) ([]*Movie, error) {
 	movieDirs := make([]*Movie, 0)
@@ -161,3 +343,12 @@ func (c *Collector) listFilesAndFolders(path string) []os.FileInfo {
 
 	return list
 }
+
+// 媒体库根目录，包括存储目录，用于判断缓存目录记录的原路径是不是真的不存在了
+func (c *Collector) libraryRoots() []string {
+	roots := append([]string{}, c.config.Collector.MoviesDir...)
+	if c.config.Collector.MoviesStorageDir != "" {
+		roots = append(roots, c.config.Collector.MoviesStorageDir)
+	}
+	return roots
+}
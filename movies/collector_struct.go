@@ -1,10 +1,12 @@
 package movies
 
 import (
+	"context"
 	"fengqi/kodi-metadata-tmdb-cli/config"
 )
 
 type Collector struct {
+	ctx     context.Context // 取消后不再接收新的任务
 	config  *config.Config
 	tmdb    *config.TmdbConfig
 	webdav  *config.WebDAVConfig
@@ -22,12 +24,15 @@ type Movie struct {
 	ChsTitle        string `json:"chs_title"`      // 分离出来的中午名称 鹰眼
 	EngTitle        string `json:"eng_title"`      // 分离出来的英文名称 Hawkeye
 	MovieId         int    `json:"tv_id"`          // 电影id
+	ImdbId          string `json:"imdb_id"`        // 目录名、id文件或NFO中的IMDb id
+	TvdbId          string `json:"tvdb_id"`        // 目录名、id文件或NFO中的TVDB id
 	Year            int    `json:"year"`           // 年份：2020、2021
 	IsFile          bool   `json:"is_file"`        // 是否是单文件，而不是目录
 	Suffix          string `json:"suffix"`         // 单文件时，文件的后缀
 	IsBluRay        bool   `json:"is_bluray"`      // 蓝光目录
 	IsDvd           bool   `json:"is_dvd"`         // DVD目录
 	IsSingleFile    bool   `json:"is_single_file"` // 普通的单文件视频
+	Language        string `json:"language"`       // override.json 指定的语言，为空时使用配置的语言
 	IdCacheFile     string `json:"id_cache_file"`
 	DetailCacheFile string `json:"detail_cache_file"`
 }
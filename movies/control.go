@@ -0,0 +1,35 @@
+package movies
+
+import (
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+)
+
+// QueueLength 常驻运行时处理队列中等待的电影数量
+func QueueLength() int {
+	if collector == nil || collector.channel == nil {
+		return 0
+	}
+	return len(collector.channel)
+}
+
+// Rescan 常驻运行时重新处理路径下的电影，返回放入队列的数量，已经在队列中的不计算
+func Rescan(path string) (int, error) {
+	if collector == nil || collector.channel == nil {
+		return 0, errors.New("movies collector not running")
+	}
+
+	return queue.Rescan(queue.KindMovie, path, collector.scanPath, (*Movie).GetFullDir, collector.push)
+}
+
+// Reidentify 常驻运行时手动指定电影id，写入 override.json 后重新放入处理队列，返回是否放入了队列
+func Reidentify(path string, id int) (bool, error) {
+	if collector == nil || collector.channel == nil {
+		return false, errors.New("movies collector not running")
+	}
+
+	set := func(movie *Movie) error {
+		return movie.SetMovieId(id)
+	}
+	return queue.Reidentify(queue.KindMovie, path, collector.scanPath, (*Movie).GetFullDir, set, collector.push)
+}
@@ -0,0 +1,59 @@
+package movies
+
+import (
+	"context"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+)
+
+// Identify 解析单个电影路径，用于手动识别
+func Identify(config *config.Config, path string) (*Movie, error) {
+	collector = &Collector{
+		ctx:    context.Background(),
+		config: config,
+	}
+
+	movieDirs, err := collector.scanPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(movieDirs) != 1 {
+		return nil, fmt.Errorf("path: %s contains %d movies, identify one at a time", path, len(movieDirs))
+	}
+
+	return movieDirs[0], nil
+}
+
+// SetMovieId 手动指定电影id，写入 override.json 并删除旧的缓存、NFO和图片，下次处理时重新刮削
+func (d *Movie) SetMovieId(id int) error {
+	d.checkCacheDir()
+	overrideFile := d.getOverrideFile()
+	override := utils.LoadOverride(overrideFile, d.getLegacyOverride())
+	if override == nil {
+		override = &utils.Override{}
+	}
+	override.Id = id
+	if err := utils.SaveOverride(overrideFile, override); err != nil {
+		return fmt.Errorf("save movieId %d to %s err: %w", id, overrideFile, err)
+	}
+	d.MovieId = id
+
+	stale := []string{
+		d.getDetailCacheFile(),
+		d.getNfoFile(collector.config.Collector.MoviesNfoMode),
+		d.getImageFile("poster"),
+		d.getImageFile("fanart"),
+		d.getImageFile("clearlogo"),
+	}
+	for _, file := range stale {
+		if file == "" || !utils.FileExist(file) {
+			continue
+		}
+		if err := utils.Remove(file); err != nil {
+			return fmt.Errorf("remove stale file: %s err: %w", file, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package movies
+
+import (
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/tmdb"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"strings"
+)
+
+// 把处理结果写入条目索引，detail 为空时只记录失败
+func (d *Movie) updateIndex(detail *tmdb.MovieDetail, scraped bool, err error) {
+	item := &library.Item{
+		Path:  d.GetFullDir(),
+		Kind:  library.KindMovie,
+		Title: d.Title,
+		Year:  d.Year,
+	}
+
+	if detail != nil {
+		item.Title, item.TmdbId = detail.Title, detail.Id
+		if year := utils.IsYear(strings.SplitN(detail.ReleaseDate, "-", 2)[0]); year > 0 {
+			item.Year = year
+		}
+		item.NfoFile = library.ExistingNfo(d.getNfoFile(collector.config.Collector.MoviesNfoMode))
+		item.Artwork = library.ExistingArtwork(map[string]string{
+			library.ArtworkPoster:    d.getImageFile("poster"),
+			library.ArtworkFanart:    d.getImageFile("fanart"),
+			library.ArtworkClearlogo: d.getImageFile("clearlogo"),
+		})
+	}
+
+	library.Index.Update(item, scraped, err)
+}
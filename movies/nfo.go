@@ -3,10 +3,14 @@ package movies
 import (
 	"fengqi/kodi-metadata-tmdb-cli/tmdb"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"slices"
 	"strconv"
 	"strings"
 )
 
+// Kodi 通过 YouTube 插件播放预告片
+const youtubeTrailer = "plugin://plugin.video.youtube/?action=play_video&videoid="
+
 func (d *Movie) saveToNfo(detail *tmdb.MovieDetail, mode int) error {
 	nfoFile := d.getNfoFile(mode)
 	if nfoFile == "" {
@@ -16,6 +20,14 @@ func (d *Movie) saveToNfo(detail *tmdb.MovieDetail, mode int) error {
 
 	utils.Logger.InfoF("save movie nfo to: %s", nfoFile)
 
+	// Kodi 会优先读取 <VideoFileName>.nfo，使用 movie.nfo 时发布组附带的同名NFO也需要备份
+	if collector.config.Collector.ExistingNfo == utils.NfoBackup {
+		utils.BackupNfo(nfoFile, detail.Id)
+		if name := d.VideoFileNameWithoutSuffix(); mode == 1 && name != "" {
+			utils.BackupNfo(name+".nfo", detail.Id)
+		}
+	}
+
 	genre := make([]string, 0)
 	for _, item := range detail.Genres {
 		genre = append(genre, item.Name)
@@ -89,30 +101,80 @@ func (d *Movie) saveToNfo(detail *tmdb.MovieDetail, mode int) error {
 		languages = append(languages, item.Name) // todo 使用 iso_639_1 匹配中文
 	}
 
+	// 导演和编剧，同一个人可能有多个职位
+	director := make([]string, 0)
+	credits := make([]string, 0)
+	if detail.Credits != nil {
+		for _, item := range detail.Credits.Crew {
+			if item.Job == "Director" && !slices.Contains(director, item.Name) {
+				director = append(director, item.Name)
+			}
+			if item.Department == "Writing" && !slices.Contains(credits, item.Name) {
+				credits = append(credits, item.Name)
+			}
+		}
+	}
+
+	// 旧的缓存中没有外部id，使用详情中的 imdb_id
+	uniqueId := []UniqueId{{Default: true, Type: "tmdb", Value: strconv.Itoa(detail.Id)}}
+	imdbId := detail.ExternalIds.GetImdbId()
+	if imdbId == "" {
+		imdbId = detail.ImdbId
+	}
+	if imdbId != "" {
+		uniqueId = append(uniqueId, UniqueId{Type: "imdb", Value: imdbId})
+	}
+	if tvdbId := detail.ExternalIds.GetTvdbId(); tvdbId > 0 {
+		uniqueId = append(uniqueId, UniqueId{Type: "tvdb", Value: strconv.Itoa(tvdbId)})
+	}
+
+	var set *Set
+	if detail.BelongsToCollection.Name != "" {
+		set = &Set{Name: detail.BelongsToCollection.Name, Overview: detail.BelongsToCollection.Overview}
+	}
+
+	trailer := ""
+	if video := detail.Videos.Trailer(tmdb.Api.WithLanguage(d.Language).Languages()); video != nil {
+		trailer = youtubeTrailer + video.Key
+	}
+
+	// 读取到视频文件的实际时长时优先使用
+	runtime := 0
+	if collector.config.Collector.MoviesNfoRuntime {
+		runtime = detail.Runtime
+	}
+	probe := d.getProbe()
+	if minutes := probe.RuntimeMinutes(); minutes > 0 {
+		runtime = minutes
+	}
+
 	top := &MovieNfo{
 		Title:         detail.Title,
 		OriginalTitle: detail.OriginalTitle,
 		SortTitle:     detail.Title,
 		Plot:          detail.Overview,
-		UniqueId: UniqueId{
-			Default: true,
-			Type:    "tmdb",
-			Value:   strconv.Itoa(detail.Id),
-		},
-		Id:         detail.Id,
-		Premiered:  detail.ReleaseDate,
-		Ratings:    Ratings{Rating: rating},
-		MPaa:       mpaa,
-		Year:       year,
-		Status:     detail.Status,
-		Genre:      genre,
-		Tag:        genre,
-		Country:    country,
-		Languages:  languages,
-		Studio:     studio,
-		UserRating: detail.VoteAverage,
-		Actor:      actor,
-		FanArt:     fanArt,
+		Tagline:       detail.Tagline,
+		Runtime:       runtime,
+		UniqueId:      uniqueId,
+		Id:            detail.Id,
+		Premiered:     detail.ReleaseDate,
+		Ratings:       Ratings{Rating: rating},
+		MPaa:          mpaa,
+		Year:          year,
+		Status:        detail.Status,
+		Genre:         genre,
+		Tag:           genre,
+		Country:       country,
+		Languages:     languages,
+		Studio:        studio,
+		UserRating:    detail.VoteAverage,
+		Actor:         actor,
+		FanArt:        fanArt,
+		Set:           set,
+		Credits:       credits,
+		Director:      director,
+		Trailer:       trailer,
+		FileInfo:      probe.FileInfo(),
 	}
 
 	return utils.SaveNfo(nfoFile, top)
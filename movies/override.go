@@ -0,0 +1,87 @@
+package movies
+
+import (
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"path/filepath"
+	"strings"
+)
+
+// 读取 override.json 或旧的 id.txt，需要跳过这个电影时返回false
+func (d *Movie) readOverride() bool {
+	d.Language = collector.config.Collector.LibraryLanguage(d.Dir)
+	override := utils.LoadOverride(d.getOverrideFile(), d.getLegacyOverride())
+	if override == nil {
+		return true
+	}
+
+	if override.Ignore {
+		utils.Logger.InfoF("ignore movie: %s by override", d.OriginTitle)
+		return false
+	}
+	if override.MediaType == utils.MediaTv {
+		utils.Logger.WarningF("movie: %s is tv by override, skip", d.OriginTitle)
+		return false
+	}
+
+	if override.Id > 0 {
+		d.MovieId = override.Id
+	}
+	if override.ImdbId != "" {
+		d.ImdbId = override.ImdbId
+	}
+	if override.TvdbId != "" {
+		d.TvdbId = override.TvdbId
+	}
+	if override.Title != "" {
+		d.Title, d.AliasTitle = override.Title, ""
+		d.ChsTitle, d.EngTitle = utils.SplitChsEngTitle(override.Title)
+	}
+	if override.Year > 0 {
+		d.Year = override.Year
+	}
+	if override.Language != "" {
+		d.Language = override.Language
+	}
+
+	return true
+}
+
+// 手动指定刮削信息的文件
+func (d *Movie) getOverrideFile() string {
+	if d.IsFile {
+		return filepath.Join(d.GetCacheDir(), d.OriginTitle+".override.json")
+	}
+	return filepath.Join(d.GetCacheDir(), "override.json")
+}
+
+// 旧版本手动指定id的文件，单文件电影更早的版本放在 tmdb/<文件名>/id.txt
+func (d *Movie) getLegacyOverride() utils.LegacyOverride {
+	idFiles := []string{d.getIdFile()}
+	if d.IsFile {
+		idFiles = append(idFiles, filepath.Join(d.GetCacheDir(), strings.Replace(d.OriginTitle, "."+d.Suffix, "", 1), "id.txt"))
+	}
+	return utils.LegacyOverride{IdFiles: idFiles}
+}
+
+// MigrateOverride 把旧的 id.txt 合并成 override.json，paths 为空时处理配置的全部电影目录
+// 每个电影处理完成后调用 fn，migrated 表示写入了新的 override.json
+func MigrateOverride(config *config.Config, paths []string, fn func(name string, migrated bool, err error)) {
+	collector = &Collector{config: config}
+	if len(paths) == 0 {
+		paths = config.Collector.MoviesDir
+	}
+
+	for _, item := range paths {
+		movieDirs, err := collector.scanPath(item)
+		if err != nil {
+			fn(item, false, err)
+			continue
+		}
+
+		for _, movieDir := range movieDirs {
+			migrated, err := utils.MigrateOverride(movieDir.getOverrideFile(), movieDir.getLegacyOverride())
+			fn(movieDir.GetFullDir(), migrated, err)
+		}
+	}
+}
@@ -2,13 +2,11 @@ package movies
 
 import (
 	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
 	"fengqi/kodi-metadata-tmdb-cli/tmdb"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
-	"io/fs"
 	"os"
-	"path/filepath"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -17,10 +15,7 @@ func (d *Movie) getMovieDetail() (*tmdb.MovieDetail, error) {
 	var detail = new(tmdb.MovieDetail)
 
 	// 从缓存读取
-	cacheFile := filepath.Join(d.GetCacheDir(), "movie.json")
-	if d.IsFile {
-		cacheFile = filepath.Join(d.GetCacheDir(), d.OriginTitle+".movie.json")
-	}
+	cacheFile := d.getDetailCacheFile()
 	cacheExpire := false
 	if cf, err := os.Stat(cacheFile); err == nil {
 		utils.Logger.DebugF("get movie detail from cache: %s", cacheFile)
@@ -36,45 +31,47 @@ func (d *Movie) getMovieDetail() (*tmdb.MovieDetail, error) {
 		}
 
 		airTime, _ := time.Parse("2006-01-02", detail.ReleaseDate)
-		cacheExpire = utils.CacheExpire(cf.ModTime(), airTime)
+		// 手动指定了其他id时缓存也失效
+		cacheExpire = collector.config.Collector.CachePolicy.Expired(config.CacheMovies, cf.ModTime(), airTime) ||
+			utils.ForceExpired(d.GetExpireMarker(), cf.ModTime()) ||
+			d.MovieId > 0 && detail.Id != d.MovieId
 		detail.FromCache = true
 	}
 
+	metrics.CacheLookup("movie", detail.Id != 0 && !cacheExpire)
+
 	// 缓存失效，重新搜索
 	if detail.Id == 0 || cacheExpire {
 		detail.FromCache = false
 		movieId := detail.Id
-		idFile := filepath.Join(d.GetCacheDir(), "id.txt")
-		if d.IsFile {
-			idFile = filepath.Join(d.Dir, "tmdb", d.OriginTitle+".id.txt")
-		}
-		if _, err = os.Stat(idFile); err == nil {
-			bytes, err := os.ReadFile(idFile)
-			if err != nil {
-				utils.Logger.WarningF("id file: %s read err: %v", idFile, err)
-			} else {
-				movieId, _ = strconv.Atoi(strings.Trim(string(bytes), "\r\n "))
-			}
+		if d.MovieId > 0 {
+			movieId = d.MovieId
 		}
 
 		if movieId == 0 {
-			SearchResults, err := tmdb.Api.SearchMovie(d.ChsTitle, d.EngTitle, d.Year)
-			if err != nil || SearchResults == nil {
-				utils.Logger.ErrorF("search title: %s or %s, year: %d failed", d.ChsTitle, d.EngTitle, d.Year)
-				return detail, err
-			}
-
-			movieId = SearchResults.Id
+			movieId = d.readNfoIds()
+		}
+		if movieId == 0 {
+			movieId = d.findByExternalId()
+			if movieId == 0 {
+				SearchResults, err := tmdb.Api.WithLanguage(d.Language).SearchMovie(d.ChsTitle, d.EngTitle, d.Year)
+				if err != nil || SearchResults == nil {
+					utils.Logger.ErrorF("search title: %s or %s, year: %d failed", d.ChsTitle, d.EngTitle, d.Year)
+					return detail, err
+				}
 
-			// 保存movieId
-			err = os.WriteFile(idFile, []byte(strconv.Itoa(movieId)), fs.FileMode(0664))
-			if err != nil {
-				utils.Logger.ErrorF("save movieId %d to %s err: %v", movieId, idFile, err)
+				movieId = SearchResults.Id
 			}
+			// 搜索到的id只保存在详情缓存和 item.json 中，不写入 id.txt，避免和手动指定的id混淆
+		}
+
+		// 改名后重新识别到的条目，使用原来的缓存
+		if detail.Id == 0 && utils.RelinkCacheDir(utils.CacheKindMovies, d.GetFullDir(), movieId, collector.libraryRoots()) {
+			return d.getMovieDetail()
 		}
 
 		// 获取详情
-		detail, err = tmdb.Api.GetMovieDetail(movieId)
+		detail, err = tmdb.Api.WithLanguage(d.Language).GetMovieDetail(movieId)
 		if err != nil {
 			utils.Logger.ErrorF("get movie: %d detail err: %v", movieId, err)
 			return nil, err
@@ -83,6 +80,7 @@ func (d *Movie) getMovieDetail() (*tmdb.MovieDetail, error) {
 		// 保存到缓存
 		d.checkCacheDir()
 		detail.SaveToCache(cacheFile)
+		utils.SaveCacheItem(utils.CacheKindMovies, d.GetFullDir(), detail.Id)
 	}
 
 	if detail.Id == 0 || d.Title == "" {
@@ -91,3 +89,49 @@ func (d *Movie) getMovieDetail() (*tmdb.MovieDetail, error) {
 
 	return detail, err
 }
+
+// 从已有的NFO中读取id，有TMDB电影id时直接返回，IMDb、TVDB id留给 findByExternalId 使用
+func (d *Movie) readNfoIds() int {
+	for _, nfo := range d.getExistingNfoFiles() {
+		bytes, err := os.ReadFile(nfo)
+		if err != nil {
+			continue
+		}
+
+		ids := utils.ParseNfoIds(bytes)
+		utils.Logger.DebugF("read ids from nfo: %s %+v", nfo, ids)
+		if d.ImdbId == "" {
+			d.ImdbId = ids.Imdb
+		}
+		if d.TvdbId == "" {
+			d.TvdbId = ids.Tvdb
+		}
+		if ids.Tmdb > 0 && ids.TmdbType != "tv" {
+			utils.Logger.InfoF("use tmdb id: %d from nfo: %s", ids.Tmdb, nfo)
+			return ids.Tmdb
+		}
+	}
+
+	return 0
+}
+
+// 目录名、id文件或已有的NFO中有IMDb、TVDB id时直接通过id查找，找不到返回0再按标题搜索
+func (d *Movie) findByExternalId() int {
+	externalIds := [][2]string{{d.ImdbId, tmdb.ExternalImdb}, {d.TvdbId, tmdb.ExternalTvdb}}
+	for _, item := range externalIds {
+		if item[0] == "" {
+			continue
+		}
+
+		resp, err := tmdb.Api.WithLanguage(d.Language).FindByExternalId(item[0], item[1])
+		if err != nil || len(resp.MovieResults) == 0 {
+			utils.Logger.WarningF("find movie by %s: %s failed, err: %v", item[1], item[0], err)
+			continue
+		}
+
+		utils.Logger.InfoF("find movie by %s: %s, use: %d %s", item[1], item[0], resp.MovieResults[0].Id, resp.MovieResults[0].Title)
+		return resp.MovieResults[0].Id
+	}
+
+	return 0
+}
@@ -2,6 +2,8 @@ package movies
 
 import (
 	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/ffmpeg"
+	"fengqi/kodi-metadata-tmdb-cli/library"
 	"fengqi/kodi-metadata-tmdb-cli/tmdb"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"fengqi/kodi-metadata-tmdb-cli/webdav"
@@ -10,7 +12,6 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 )
 
@@ -92,24 +93,18 @@ func parseMoviesDir(baseDir string, file fs.FileInfo) *Movie {
 
 	movieDir.Title, movieDir.AliasTitle = utils.SplitTitleAlias(movieDir.Title)
 	movieDir.ChsTitle, movieDir.EngTitle = utils.SplitChsEngTitle(movieDir.Title)
-	if len(movieDir.Title) == 0 {
-		utils.Logger.WarningF("file: %s parse title empty: %v", file.Name(), movieDir)
+
+	// 目录名中的IMDb、TVDB id，比如 Iron.Man.2008.tt0371746.1080p
+	movieDir.readExternalId(file.Name())
+
+	// 手动指定的id、标题等
+	if !movieDir.readOverride() {
 		return nil
 	}
 
-	// 通过文件指定id
-	// todo all use baseDir + "/tmdb/"
-	idFile := filepath.Join(baseDir, file.Name(), "tmdb", "id.txt")
-	if !file.IsDir() {
-		idFile = filepath.Join(baseDir, "tmdb", movieName, "id.txt")
-	}
-	if _, err := os.Stat(idFile); err == nil {
-		bytes, err := os.ReadFile(idFile)
-		if err == nil {
-			movieDir.MovieId, _ = strconv.Atoi(strings.Trim(string(bytes), "\r\n "))
-		} else {
-			utils.Logger.WarningF("read movies id specially file: %s err: %v", idFile, err)
-		}
+	if len(movieDir.Title) == 0 {
+		utils.Logger.WarningF("file: %s parse title empty: %v", file.Name(), movieDir)
+		return nil
 	}
 
 	//识别是否是蓝光或dvd目录
@@ -147,23 +142,58 @@ func parseMoviesDir(baseDir string, file fs.FileInfo) *Movie {
 	return movieDir
 }
 
+// 从目录名、id文件或NFO内容中提取IMDb、TVDB id，已经有的不覆盖
+func (d *Movie) readExternalId(content string) {
+	if d.ImdbId == "" {
+		d.ImdbId = utils.MatchImdbId(content)
+	}
+	if d.TvdbId == "" {
+		d.TvdbId = utils.MatchTvdbId(content)
+	}
+}
+
 // tmdb 缓存目录
-// TODO 统一使用一个目录
 func (d *Movie) checkCacheDir() {
 	dir := d.GetCacheDir()
 	if _, err := os.Stat(dir); err != nil && os.IsNotExist(err) {
-		err := os.Mkdir(dir, 0755)
+		err := utils.MkdirAll(dir, 0755)
 		if err != nil {
 			utils.Logger.ErrorF("create cache: %s dir err: %v", dir, err)
 		}
 	}
 }
 
+// GetCacheDir 缓存目录，没有配置统一缓存目录时在电影目录下，单文件电影在所在目录下
 func (d *Movie) GetCacheDir() string {
+	legacy := filepath.Join(d.GetFullDir(), "tmdb")
 	if d.IsFile {
-		return filepath.Join(d.Dir, "tmdb")
+		legacy = filepath.Join(d.Dir, "tmdb")
 	}
-	return filepath.Join(d.GetFullDir(), "tmdb")
+	return utils.CacheDir(utils.CacheKindMovies, d.GetFullDir(), legacy)
+}
+
+// 详情缓存文件
+func (d *Movie) getDetailCacheFile() string {
+	if d.IsFile {
+		return filepath.Join(d.GetCacheDir(), d.OriginTitle+".movie.json")
+	}
+	return filepath.Join(d.GetCacheDir(), "movie.json")
+}
+
+// 手动指定或搜索到的电影id
+func (d *Movie) getIdFile() string {
+	if d.IsFile {
+		return filepath.Join(d.GetCacheDir(), d.OriginTitle+".id.txt")
+	}
+	return filepath.Join(d.GetCacheDir(), "id.txt")
+}
+
+// GetExpireMarker 手动标记缓存过期的文件
+func (d *Movie) GetExpireMarker() string {
+	if d.IsFile {
+		return filepath.Join(d.GetCacheDir(), d.OriginTitle+".expire")
+	}
+	return filepath.Join(d.GetCacheDir(), "expire")
 }
 
 func (d *Movie) GetFullDir() string {
@@ -179,30 +209,57 @@ func (m *Movie) VideoFileNameWithoutSuffix() string {
 	return filepath.Join(m.GetFullDir(), strings.Replace(m.VideoFileName, "."+suffix, "", 1))
 }
 
+// 视频文件的完整路径，蓝光、DVD和有多个视频的目录返回空
+func (d *Movie) getVideoFile() string {
+	if d.IsFile {
+		return filepath.Join(d.Dir, d.OriginTitle)
+	}
+	if d.IsSingleFile && d.VideoFileName != "" {
+		return filepath.Join(d.GetFullDir(), d.VideoFileName)
+	}
+	return ""
+}
+
+// 读取视频文件的音视频信息，没有开启或读取失败时返回nil
+func (d *Movie) getProbe() *ffmpeg.ProbeData {
+	file := d.getVideoFile()
+	if !collector.config.Ffmpeg.StreamDetails || file == "" {
+		return nil
+	}
+
+	probe, err := ffmpeg.ProbeCache(file, d.getProbeCacheFile(file))
+	if err != nil {
+		utils.Logger.WarningF("probe movie: %s err: %v", file, err)
+		return nil
+	}
+
+	return probe
+}
+
+// 开启了 stream_details 并且视频文件还没有读取过或者已经被替换，NFO中的音视频信息需要更新
+func (d *Movie) probeStale() bool {
+	file := d.getVideoFile()
+	if !collector.config.Ffmpeg.StreamDetails || file == "" {
+		return false
+	}
+
+	return ffmpeg.ProbeStale(file, d.getProbeCacheFile(file))
+}
+
+func (d *Movie) getProbeCacheFile(file string) string {
+	return filepath.Join(d.GetCacheDir(), filepath.Base(file)+".probe.json")
+}
+
 func (d *Movie) downloadImage(detail *tmdb.MovieDetail) error {
 	utils.Logger.DebugF("download %s images", d.Title)
 
 	var err error
 	if len(detail.PosterPath) > 0 {
-		posterFile := filepath.Join(d.GetFullDir(), "poster.jpg")
-		if d.IsFile {
-			suffix := utils.IsVideo(d.OriginTitle)
-			posterFile = filepath.Join(d.Dir, strings.Replace(d.OriginTitle, "."+suffix, "", 1)+"-poster.jpg")
-		} else if name := d.VideoFileNameWithoutSuffix(); name != "" {
-			posterFile = name + "-poster.jpg"
-		}
-		err = tmdb.DownloadFile(tmdb.Api.GetImageOriginal(detail.PosterPath), posterFile)
+		err = tmdb.DownloadFile(tmdb.Api.GetImageOriginal(detail.PosterPath), d.getImageFile("poster"))
 	}
 
 	if len(detail.BackdropPath) > 0 {
-		fanArtFile := filepath.Join(d.GetFullDir(), "fanart.jpg")
-		if d.IsFile {
-			suffix := utils.IsVideo(d.OriginTitle)
-			fanArtFile = filepath.Join(d.Dir, strings.Replace(d.OriginTitle, "."+suffix, "", 1)+"-fanart.jpg")
-		} else if name := d.VideoFileNameWithoutSuffix(); name != "" {
-			fanArtFile = name + "-fanart.jpg"
-		}
-		err = tmdb.DownloadFile(tmdb.Api.GetImageOriginal(detail.BackdropPath), fanArtFile)
+		err = tmdb.DownloadFile(tmdb.Api.GetImageOriginal(detail.BackdropPath), d.getImageFile("fanart"))
 	}
 
 	if detail.Images != nil && len(detail.Images.Logos) > 0 {
@@ -221,20 +278,33 @@ func (d *Movie) downloadImage(detail *tmdb.MovieDetail) error {
 			}
 		}
 		if image.FilePath != "" {
-			logoFile := filepath.Join(d.GetFullDir(), "clearlogo.jpg")
-			if d.IsFile {
-				suffix := utils.IsVideo(d.OriginTitle)
-				logoFile = filepath.Join(d.Dir, strings.Replace(d.OriginTitle, "."+suffix, "", 1)+"-clearlogo.png")
-			} else if name := d.VideoFileNameWithoutSuffix(); name != "" {
-				logoFile = name + "-clearlogo.png"
-			}
-			_ = tmdb.DownloadFile(tmdb.Api.GetImageOriginal(image.FilePath), logoFile)
+			_ = tmdb.DownloadFile(tmdb.Api.GetImageOriginal(image.FilePath), d.getImageFile("clearlogo"))
 		}
 	}
 
 	return err
 }
 
+// 图片保存路径，kind 为 poster、fanart、clearlogo
+// 单文件和目录中只有一个视频时使用 <VideoFileName>-<kind>，否则使用 <kind>
+func (d *Movie) getImageFile(kind string) string {
+	ext := ".jpg"
+	if kind == "clearlogo" {
+		ext = ".png"
+	}
+
+	if d.IsFile {
+		suffix := utils.IsVideo(d.OriginTitle)
+		return filepath.Join(d.Dir, strings.Replace(d.OriginTitle, "."+suffix, "", 1)+"-"+kind+ext)
+	}
+	if name := d.VideoFileNameWithoutSuffix(); name != "" {
+		return name + "-" + kind + ext
+	}
+
+	// 目录模式的 clearlogo 一直是 .jpg，保持不变避免重复下载
+	return filepath.Join(d.GetFullDir(), kind+".jpg")
+}
+
 // maybe <VideoFileName>.nfo
 // Kodi比较推荐 <VideoFileName>.nfo 但是存在一种情况就是，使用inotify监听文件变动，可能电影目录先创建
 // 里面的视频文件会迟一点，这个时候 VideoFileName 就会为空，导致NFO写入失败
@@ -266,6 +336,31 @@ func (m *Movie) getNfoFile(mode int) string {
 	}
 }
 
+// 已有的NFO：单文件电影同名的NFO，目录中的所有NFO（发布组附带的NFO通常以发布名命名），蓝光和DVD目录中的NFO
+func (m *Movie) getExistingNfoFiles() []string {
+	files := make([]string, 0)
+	if m.IsFile || m.IsBluRay || m.IsDvd {
+		if nfo := m.getNfoFile(1); utils.FileExist(nfo) {
+			files = append(files, nfo)
+		}
+		if m.IsFile {
+			return files
+		}
+	}
+
+	entries, err := os.ReadDir(m.GetFullDir())
+	if err != nil {
+		return files
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.ToLower(filepath.Ext(entry.Name())) == ".nfo" {
+			files = append(files, filepath.Join(m.GetFullDir(), entry.Name()))
+		}
+	}
+
+	return files
+}
+
 func (m *Movie) NfoExist(mode int) bool {
 	nfo := m.getNfoFile(mode)
 
@@ -284,15 +379,15 @@ func (m *Movie) MoveToStorage(moviesStorageDir string, collection string, tmdbNa
 	newMovieDir := filepath.Join(moviesStorageDir, collection, tmdbName)
 	if _, err := os.Stat(newMovieDir); err != nil && os.IsNotExist(err) {
 		// 电影集文件夹不存在 则新建
-		os.MkdirAll(newMovieDir, 0755)
+		_ = utils.MkdirAll(newMovieDir, 0755)
 	} else {
 		if _, err := os.Stat(newMovieDir); err == nil {
 			// 新电影文件夹如果存在则删除 覆盖策略
-			err := os.RemoveAll(newMovieDir)
+			err := utils.RemoveAll(newMovieDir)
 			if err != nil {
 				return err
 			}
-			os.MkdirAll(newMovieDir, 0755)
+			_ = utils.MkdirAll(newMovieDir, 0755)
 		}
 	}
 	dirEntry, _ := os.ReadDir(oldPathDir)
@@ -314,24 +409,29 @@ func (m *Movie) MoveToStorage(moviesStorageDir string, collection string, tmdbNa
 				}
 			} else {
 				// 直接移动
-				os.Rename(filepath.Join(oldPathDir, entry.Name()), filepath.Join(newMovieDir, entry.Name()))
+				_ = utils.Rename(filepath.Join(oldPathDir, entry.Name()), filepath.Join(newMovieDir, entry.Name()))
 			}
 		} else {
 			// 直接移动
-			os.Rename(filepath.Join(oldPathDir, entry.Name()), filepath.Join(newMovieDir, entry.Name()))
+			_ = utils.Rename(filepath.Join(oldPathDir, entry.Name()), filepath.Join(newMovieDir, entry.Name()))
 		}
 	}
 	if maxMovieVideo == nil {
-		os.RemoveAll(newMovieDir)
+		_ = utils.RemoveAll(newMovieDir)
 		return errors.New(fmt.Sprintf("电影目录: %s未找到任何视频文件!", m.OriginTitle))
 	}
 	// 处理最大的视频文件移动 以及 字幕文件重命名
-	os.Rename(filepath.Join(oldPathDir, maxMovieVideo.Name()), filepath.Join(newMovieDir, maxMovieVideo.Name()))
+	_ = utils.Rename(filepath.Join(oldPathDir, maxMovieVideo.Name()), filepath.Join(newMovieDir, maxMovieVideo.Name()))
 	movieVideoName := strings.TrimSuffix(maxMovieVideo.Name(), filepath.Ext(maxMovieVideo.Name()))
 	for _, sub := range subtitles {
 		//外挂字幕
-		os.Rename(filepath.Join(oldPathDir, sub), filepath.Join(newMovieDir, movieVideoName+filepath.Ext(sub)))
+		_ = utils.Rename(filepath.Join(oldPathDir, sub), filepath.Join(newMovieDir, movieVideoName+filepath.Ext(sub)))
+	}
+	// 统一缓存目录跟着电影目录移动
+	if err := utils.MoveCacheDir(utils.CacheKindMovies, oldPathDir, newMovieDir); err != nil {
+		utils.Logger.WarningF("move movie: %s cache dir err: %v", m.OriginTitle, err)
 	}
+	library.Index.Move(oldPathDir, newMovieDir)
 	// 移除整个源电影文件夹
 	webdav.RemoveMovie(m.OriginTitle)
 	// os.RemoveAll(oldPathDir)
@@ -1,6 +1,8 @@
 package movies
 
 import (
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"os"
 	"path/filepath"
@@ -29,11 +31,21 @@ func (c *Collector) runWatcher() {
 
 	for {
 		select {
+		case <-c.ctx.Done():
+			return
+
 		// 接受事件，增删改查都会收到，需要过滤，部分情况下可能收不到create而是chmod
 		case event, ok := <-watcher.Events:
 			if !ok {
 				return
 			}
+			metrics.WatcherEvent("movies", event)
+
+			// 删除或移走的条目从索引中删除
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				library.Index.Remove(event.Name)
+				continue
+			}
 
 			if !event.Has(fsnotify.Create) {
 				continue
@@ -48,7 +60,7 @@ func (c *Collector) runWatcher() {
 
 			moviesDir := parseMoviesDir(filepath.Dir(event.Name), fileInfo)
 			if moviesDir != nil {
-				c.channel <- moviesDir
+				c.enqueue(moviesDir)
 			}
 
 		case err, ok := <-watcher.Errors:
@@ -63,7 +75,7 @@ func (c *Collector) runWatcher() {
 
 // 监听目录
 func (c *Collector) watchDir(name string) {
-	if !c.config.Collector.Watcher {
+	if !c.config.Collector.Watcher || watcher == nil {
 		return
 	}
 
@@ -1,9 +1,14 @@
 package music_videos
 
 import (
+	"context"
 	"fengqi/kodi-metadata-tmdb-cli/config"
 	"fengqi/kodi-metadata-tmdb-cli/kodi"
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -14,75 +19,217 @@ import (
 )
 
 type Collector struct {
+	ctx     context.Context // 取消后不再接收新的任务
 	config  *config.Config
 	channel chan *MusicVideo
 }
 
 var collector *Collector
 
-func RunCollector(config *config.Config, wg *sync.WaitGroup) {
+func RunCollector(ctx context.Context, config *config.Config, wg *sync.WaitGroup) {
 	defer wg.Done()
 	collector = &Collector{
+		ctx:     ctx,
 		config:  config,
 		channel: make(chan *MusicVideo, runtime.NumCPU()),
 	}
 
 	collector.initWatcher()
 	go collector.runWatcher()
-	go collector.runProcessor()
-	collector.runScanner()
+	queue.Jobs.Handle(queue.KindMusicVideo, collector.replay)
+	go func() {
+		collector.replayJobs()
+		collector.runScanner()
+	}()
+	collector.runProcessor()
+
+	_ = watcher.Close()
+	utils.Logger.Info("music videos collector stopped")
+}
+
+// RunOnce 单次运行：扫描指定路径（为空时扫描配置的全部音乐视频目录）并处理完成后返回
+func RunOnce(ctx context.Context, config *config.Config, paths []string, summary *utils.Summary) {
+	collector = &Collector{
+		ctx:    ctx,
+		config: config,
+	}
+
+	if len(paths) == 0 {
+		paths = config.Collector.MusicVideosDir
+	}
+
+	wg := &sync.WaitGroup{}
+	limiter := make(chan struct{}, max(config.Ffmpeg.MaxWorker, 1))
+	for _, item := range paths {
+		videos, err := collector.scanPath(item)
+		if err != nil {
+			summary.Add(item, false, err)
+			continue
+		}
+
+		for _, video := range videos {
+			if ctx.Err() != nil {
+				break
+			}
+
+			limiter <- struct{}{}
+			wg.Add(1)
+			go func(video *MusicVideo) {
+				defer wg.Done()
+				scraped, err := collector.videoProcessor(video)
+				metrics.Processed(library.KindMusicVideo, err)
+				video.updateIndex(scraped, err)
+				summary.Add(video.getFullPath(), scraped, err)
+				<-limiter
+			}(video)
+		}
+	}
+	wg.Wait()
 }
 
-// 处理扫描队列
+// 处理扫描队列，收到退出信号后等待正在处理的视频完成再返回
 func (c *Collector) runProcessor() {
 	utils.Logger.Debug("run music videos processor")
 
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
 	limiter := make(chan struct{}, c.config.Ffmpeg.MaxWorker)
 	for {
+		if c.ctx.Err() != nil {
+			return
+		}
+
 		select {
+		case <-c.ctx.Done():
+			return
+
 		case video := <-c.channel:
 			utils.Logger.DebugF("receive music video task: %v", video)
 
 			limiter <- struct{}{}
+			wg.Add(1)
 			go func() {
-				c.videoProcessor(video)
+				defer wg.Done()
+				queue.Jobs.Start(queue.KindMusicVideo, video.getFullPath())
+				scraped, err := c.videoProcessor(video)
+				metrics.Processed(library.KindMusicVideo, err)
+				video.updateIndex(scraped, err)
+				if err != nil {
+					utils.Logger.WarningF("process music video err: %v", err)
+				}
+				if delay, retry := queue.Jobs.Finish(queue.KindMusicVideo, video.getFullPath(), scraped, err); retry {
+					utils.Logger.InfoF("retry music video: %s after %s", video.OriginTitle, delay)
+					go c.pushAfter(video, delay)
+				}
 				<-limiter
 			}()
 		}
 	}
 }
 
-// 视频文件处理
-func (c *Collector) videoProcessor(video *MusicVideo) {
-	if video == nil || (video.NfoExist() && video.ThumbExist()) {
+// 添加到处理队列，已经在队列中的直接跳过，收到退出信号时放弃并返回false
+func (c *Collector) enqueue(video *MusicVideo) bool {
+	if video == nil {
+		return true
+	}
+	if !queue.Jobs.Enqueue(queue.KindMusicVideo, video.getFullPath()) {
+		return true
+	}
+
+	return c.push(video)
+}
+
+// 放入处理队列，收到退出信号时返回false，任务保留在持久化队列中下次启动时继续
+func (c *Collector) push(video *MusicVideo) bool {
+	select {
+	case <-c.ctx.Done():
+		return false
+	case c.channel <- video:
+		return true
+	}
+}
+
+// 等待一段时间后放入处理队列，用于失败重试
+func (c *Collector) pushAfter(video *MusicVideo, delay time.Duration) {
+	select {
+	case <-c.ctx.Done():
+	case <-time.After(delay):
+		c.push(video)
+	}
+}
+
+// 重新放入上次退出时没有处理完的任务，等待重试的任务到时间后再放入
+func (c *Collector) replayJobs() {
+	for _, job := range queue.Jobs.Unfinished(queue.KindMusicVideo) {
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		utils.Logger.InfoF("replay unfinished music video job: %s", job.Key)
+		if delay := time.Until(job.NextRetry); delay > 0 {
+			go func(key string) {
+				select {
+				case <-c.ctx.Done():
+				case <-time.After(delay):
+					c.replay(key)
+				}
+			}(job.Key)
+			continue
+		}
+		c.replay(job.Key)
+	}
+}
+
+// 重新解析任务路径并放入处理队列，路径已经不存在时删除任务
+func (c *Collector) replay(key string) {
+	videos, err := c.scanPath(key)
+	if err != nil || len(videos) == 0 {
+		utils.Logger.WarningF("drop music video job: %s err: %v", key, err)
+		queue.Jobs.Remove(queue.KindMusicVideo, key)
+		if !utils.FileExist(key) {
+			library.Index.Remove(key)
+		}
 		return
 	}
 
+	for _, video := range videos {
+		if !c.push(video) {
+			return
+		}
+	}
+}
+
+// 视频文件处理，返回是否写入了新的NFO
+func (c *Collector) videoProcessor(video *MusicVideo) (bool, error) {
+	if video == nil || (video.NfoExist() && video.ThumbExist()) {
+		return false, nil
+	}
+
 	probe, err := video.getProbe()
 	if err != nil {
-		utils.Logger.WarningF("parse video %s probe err: %v", filepath.Join(video.Dir, video.OriginTitle), err)
-		return
+		return false, fmt.Errorf("parse video %s probe err: %v", filepath.Join(video.Dir, video.OriginTitle), err)
 	}
 
 	video.VideoStream = probe.FirstVideoStream()
 	video.AudioStream = probe.FirstAudioStream()
 	if video.VideoStream == nil || video.AudioStream == nil {
-		return
+		return false, nil
 	}
 
 	err = video.drawThumb()
 	if err != nil {
-		utils.Logger.WarningF("draw thumb err: %v", err)
-		return
+		return false, fmt.Errorf("draw thumb err: %v", err)
 	}
 
 	err = video.saveToNfo()
 	if err != nil {
-		utils.Logger.WarningF("save to NFO err: %v", err)
-		return
+		return false, fmt.Errorf("save to NFO err: %v", err)
 	}
 
 	kodi.Rpc.AddScanTask(video.BaseDir)
+
+	return true, nil
 }
 
 // 运行扫描器
@@ -98,28 +245,78 @@ func (c *Collector) runScanner() {
 				continue
 			}
 
-			// 刮削信息缓存目录
-			cacheDir := filepath.Join(item, "tmdb")
-			if _, err := os.Stat(cacheDir); err != nil && os.IsNotExist(err) {
-				err := os.Mkdir(cacheDir, 0755)
-				if err != nil {
-					utils.Logger.ErrorF("create probe cache: %s dir err: %v", cacheDir, err)
-					continue
-				}
+			if err = checkCacheDir(item); err != nil {
+				continue
 			}
 
 			for _, video := range videos {
-				c.channel <- video
+				if !c.enqueue(video) {
+					return
+				}
 			}
 		}
 	}
 
 	task()
 	ticker := time.NewTicker(time.Second * time.Duration(c.config.Collector.CronSeconds))
-	for range ticker.C {
-		task()
-		utils.Logger.Debug("run music video scanner finished")
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			task()
+			utils.Logger.Debug("run music video scanner finished")
+		}
+	}
+}
+
+// 扫描单个路径：可以是音乐视频根目录、子目录，也可以是单个视频文件
+func (c *Collector) scanPath(path string) ([]*MusicVideo, error) {
+	path = filepath.Clean(path)
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		// 配置的根目录不存在时同定时扫描一样跳过
+		if os.IsNotExist(err) && utils.InDirs(path, c.config.Collector.MusicVideosDir) == path {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var videos []*MusicVideo
+	if fileInfo.IsDir() {
+		videos, err = c.scanDir(path)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		video := c.parseVideoFile(filepath.Dir(path), fileInfo)
+		if video == nil {
+			return nil, fmt.Errorf("parse music video: %s failed", path)
+		}
+		videos = []*MusicVideo{video}
+	}
+
+	if len(videos) > 0 {
+		if err = checkCacheDir(videos[0].BaseDir); err != nil {
+			return nil, err
+		}
+	}
+
+	return videos, nil
+}
+
+// 刮削信息缓存目录
+func checkCacheDir(baseDir string) error {
+	cacheDir := utils.CacheDir(utils.CacheKindMusicVideos, baseDir, filepath.Join(baseDir, "tmdb"))
+	if _, err := os.Stat(cacheDir); err != nil && os.IsNotExist(err) {
+		err := utils.MkdirAll(cacheDir, 0755)
+		if err != nil {
+			utils.Logger.ErrorF("create probe cache: %s dir err: %v", cacheDir, err)
+			return err
+		}
 	}
+	return nil
 }
 
 func (c *Collector) scanDir(dir string) ([]*MusicVideo, error) {
@@ -0,0 +1,23 @@
+package music_videos
+
+import (
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+)
+
+// QueueLength 常驻运行时处理队列中等待的音乐视频数量
+func QueueLength() int {
+	if collector == nil || collector.channel == nil {
+		return 0
+	}
+	return len(collector.channel)
+}
+
+// Rescan 常驻运行时重新处理路径下的音乐视频，返回放入队列的数量，已经在队列中的不计算
+func Rescan(path string) (int, error) {
+	if collector == nil || collector.channel == nil {
+		return 0, errors.New("music videos collector not running")
+	}
+
+	return queue.Rescan(queue.KindMusicVideo, path, collector.scanPath, (*MusicVideo).getFullPath, collector.push)
+}
@@ -0,0 +1,18 @@
+package music_videos
+
+import (
+	"fengqi/kodi-metadata-tmdb-cli/library"
+)
+
+// 把处理结果写入条目索引
+func (m *MusicVideo) updateIndex(scraped bool, err error) {
+	library.Index.Update(&library.Item{
+		Path:    m.getFullPath(),
+		Kind:    library.KindMusicVideo,
+		Title:   m.Title,
+		NfoFile: library.ExistingNfo(m.getNfoFile()),
+		Artwork: library.ExistingArtwork(map[string]string{
+			library.ArtworkThumb: m.getNfoThumb(),
+		}),
+	}, scraped, err)
+}
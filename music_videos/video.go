@@ -47,7 +47,8 @@ func (m *MusicVideo) getProbe() (*ffmpeg.ProbeData, error) {
 	var probe = new(ffmpeg.ProbeData)
 
 	fileMd5 := m.GetNameMd5()
-	cacheFile := filepath.Join(m.BaseDir, "tmdb", fileMd5+".json")
+	cacheDir := utils.CacheDir(utils.CacheKindMusicVideos, m.BaseDir, filepath.Join(m.BaseDir, "tmdb"))
+	cacheFile := filepath.Join(cacheDir, fileMd5+".json")
 	if _, err := os.Stat(cacheFile); err == nil {
 		utils.Logger.DebugF("get video probe from cache: %s", cacheFile)
 		if bytes, err := os.ReadFile(cacheFile); err == nil {
@@ -61,12 +62,8 @@ func (m *MusicVideo) getProbe() (*ffmpeg.ProbeData, error) {
 	probe, err := ffmpeg.Probe(filepath.Join(m.Dir, m.OriginTitle))
 	if err == nil {
 		utils.Logger.DebugF("save video probe to cache: %s", cacheFile)
-		f, err := os.OpenFile(cacheFile, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
-		if err == nil {
-			bytes, _ := json.MarshalIndent(probe, "", "    ")
-			_, err = f.Write(bytes)
-			_ = f.Close()
-		}
+		bytes, _ := json.MarshalIndent(probe, "", "    ")
+		_ = utils.WriteFile(utils.ActionWriteProbe, cacheFile, bytes, 0644)
 	}
 
 	return probe, err
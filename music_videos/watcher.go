@@ -1,6 +1,8 @@
 package music_videos
 
 import (
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"os"
 	"path/filepath"
@@ -29,9 +31,18 @@ func (c *Collector) runWatcher() {
 
 	for {
 		select {
+		case <-c.ctx.Done():
+			return
+
 		case event, ok := <-watcher.Events:
 			if !ok {
-				continue
+				return
+			}
+			metrics.WatcherEvent("music_videos", event)
+
+			// 删除或移走的条目从索引中删除
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				library.Index.Remove(event.Name)
 			}
 
 			fileInfo, err := os.Stat(event.Name)
@@ -69,7 +80,7 @@ func (c *Collector) runWatcher() {
 				}
 
 				for _, video := range videos {
-					c.channel <- video
+					c.enqueue(video)
 				}
 
 				continue
@@ -78,7 +89,7 @@ func (c *Collector) runWatcher() {
 			// 单个文件
 			if utils.IsVideo(event.Name) != "" {
 				video := c.parseVideoFile(filepath.Dir(event.Name), fileInfo)
-				c.channel <- video
+				c.enqueue(video)
 				continue
 			}
 
@@ -94,7 +105,7 @@ func (c *Collector) runWatcher() {
 
 // 监听目录
 func (c *Collector) watchDir(name string) {
-	if !c.config.Collector.Watcher {
+	if !c.config.Collector.Watcher || watcher == nil {
 		return
 	}
 
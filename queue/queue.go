@@ -0,0 +1,465 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/tmdb"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Jobs 持久化的任务队列，未初始化时所有操作都是空操作
+var Jobs *Store
+
+const (
+	doneExpire  = time.Hour * 24 * 7 // 已完成的任务保留时间
+	maxBackoff  = time.Hour          // 重试等待的最长时间
+	requeueFile = "requeue.txt"      // 命令行重新排队的任务，由常驻进程读取
+)
+
+// InitQueue 从状态目录加载任务，并定时把修改写入文件
+func InitQueue(ctx context.Context, config *config.CollectorConfig) {
+	store, err := Open(filepath.Join(config.StateDir, "jobs.json"))
+	if err != nil {
+		utils.Logger.ErrorF("open job queue in %s err: %v", config.StateDir, err)
+		return
+	}
+
+	if config.RetryMaxAttempts > 0 {
+		store.maxAttempts = config.RetryMaxAttempts
+	}
+	if config.RetryBackoffSeconds > 0 {
+		store.backoff = time.Second * time.Duration(config.RetryBackoffSeconds)
+	}
+
+	Jobs = store
+	store.takeRequeue()
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				store.takeRequeue()
+				if err := store.Flush(); err != nil {
+					utils.Logger.WarningF("save job queue err: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Open 加载任务文件，不存在时创建目录
+func Open(file string) (*Store, error) {
+	s := &Store{
+		lock:        &sync.Mutex{},
+		file:        file,
+		jobs:        make(map[string]*Job, 0),
+		maxAttempts: 5,
+		backoff:     time.Minute,
+		handlers:    make(map[string]func(key string), 0),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0)
+	if err = json.Unmarshal(bytes, &jobs); err != nil {
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		if job.State == StateDone && time.Since(job.UpdatedAt) > doneExpire {
+			continue
+		}
+		s.jobs[jobKey(job.Kind, job.Key)] = job
+	}
+
+	return s, nil
+}
+
+// Enqueue 添加任务，已经在排队（包括等待重试）或正在处理的任务返回false，调用方不需要再次处理；
+// 失败（包括待确认）的任务只有在文件或目录修改后才重新排队，比如新增了分集、手动指定了id，
+// 否则保留失败状态和重试次数，需要通过 failed retry 命令或者 Requeue 重新排队
+func (s *Store) Enqueue(kind, key string) bool {
+	return s.add(kind, key, false)
+}
+
+// Requeue 失败的任务重新排队，并清空重试次数，返回false表示任务已经在队列中
+func (s *Store) Requeue(kind, key string) bool {
+	return s.add(kind, key, true)
+}
+
+func (s *Store) add(kind, key string, retryFailed bool) bool {
+	if s == nil {
+		return true
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	job, ok := s.jobs[jobKey(kind, key)]
+	if ok && (job.State == StateQueued || job.State == StateRunning) {
+		return false
+	}
+	if ok && job.State == StateFailed && !retryFailed && !modifiedAfter(key, job.UpdatedAt) {
+		return false
+	}
+
+	s.queue(kind, key)
+	return true
+}
+
+// Handle 注册命令行重新排队的任务的处理函数，一般是重新解析路径后放入处理队列
+func (s *Store) Handle(kind string, fn func(key string)) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.handlers[kind] = fn
+}
+
+// Start 标记任务开始处理
+func (s *Store) Start(kind, key string) {
+	s.update(kind, key, func(job *Job) {
+		job.State = StateRunning
+		job.Attempts++
+	})
+}
+
+// Finish 根据处理结果标记任务完成或失败，可以重试时返回需要等待的时间和true，
+// 任务保持排队状态，调用方需要在等待后重新放入处理队列；
+// 成功但没有任何修改（缓存有效、NFO已存在）的任务直接删除，定时扫描时不会把整个媒体库写入任务文件
+func (s *Store) Finish(kind, key string, changed bool, err error) (time.Duration, bool) {
+	if err == nil && !changed {
+		s.Remove(kind, key)
+		return 0, false
+	}
+
+	var delay time.Duration
+	s.update(kind, key, func(job *Job) {
+		if err == nil {
+			job.State = StateDone
+			job.LastError = ""
+			job.Reason = ""
+			return
+		}
+
+		job.LastError = err.Error()
+		job.Reason = Reason(err)
+		if job.Reason == ReasonNotFound || job.Reason == ReasonReview || job.Attempts >= s.maxAttempts {
+			job.State = StateFailed
+			return
+		}
+
+		delay = Backoff(s.backoff, job.Attempts)
+		job.State = StateQueued
+		job.NextRetry = time.Now().Add(delay)
+	})
+
+	return delay, delay > 0
+}
+
+// Backoff 第attempts次失败后的等待时间，指数增长并加入随机抖动，避免同时重试
+func Backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Reason 失败原因分类
+func Reason(err error) string {
+	var netErr net.Error
+	var apiErr *tmdb.ApiError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, tmdb.ErrNotFound):
+		return ReasonNotFound
+	case errors.Is(err, tmdb.ErrLowConfidence):
+		return ReasonReview
+	case errors.As(err, &netErr), errors.As(err, &apiErr), errors.Is(err, context.DeadlineExceeded):
+		return ReasonHttp
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ReasonParse
+	default:
+		return ReasonOther
+	}
+}
+
+// Remove 删除任务，用于处理对象已经不存在的情况
+func (s *Store) Remove(kind, key string) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.jobs, jobKey(kind, key))
+	s.dirty = true
+}
+
+// Unfinished 返回上次退出时还在排队或正在处理的任务，用于启动后重新放入队列
+func (s *Store) Unfinished(kind string) []*Job {
+	return s.List(kind, StateQueued, StateRunning)
+}
+
+// List 按创建时间返回指定类型和状态的任务，类型为空时返回所有类型
+func (s *Store) List(kind string, states ...string) []*Job {
+	jobs := make([]*Job, 0)
+	if s == nil {
+		return jobs
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, job := range s.jobs {
+		if kind != "" && job.Kind != kind {
+			continue
+		}
+		if len(states) > 0 && !utils.InArray(states, job.State) {
+			continue
+		}
+		item := *job
+		jobs = append(jobs, &item)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	return jobs
+}
+
+// Rescan 供常驻运行时的控制接口使用：解析路径下的条目并重新排队，返回放入队列的数量，
+// 已经在队列中或者正在处理的不再放入，避免同时处理两次
+func Rescan[T any](kind, path string, parse func(path string) ([]T, error), key func(T) string, push func(T) bool) (int, error) {
+	items, err := parse(path)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, item := range items {
+		if Jobs.Requeue(kind, key(item)) {
+			queued++
+			go push(item)
+		}
+	}
+
+	return queued, nil
+}
+
+// Reidentify 供常驻运行时的控制接口使用：路径只能包含一个条目，set 写入手动指定的id后重新排队，返回是否放入了队列，
+// 已经在队列中或者正在处理的不再放入，下次定时扫描时使用新的id
+func Reidentify[T any](kind, path string, parse func(path string) ([]T, error), key func(T) string, set func(T) error, push func(T) bool) (bool, error) {
+	items, err := parse(path)
+	if err != nil {
+		return false, err
+	}
+	if len(items) != 1 {
+		return false, fmt.Errorf("path: %s contains %d %ss, identify one at a time", path, len(items), kind)
+	}
+
+	if err = set(items[0]); err != nil {
+		return false, err
+	}
+	if !Jobs.Requeue(kind, key(items[0])) {
+		return false, nil
+	}
+	go push(items[0])
+
+	return true, nil
+}
+
+// RequeueLater 供命令行使用：把任务写入状态目录，由常驻进程读取后重新排队，
+// 常驻进程没有运行时下次启动读取
+func RequeueLater(stateDir string, jobs []*Job) error {
+	f, err := os.OpenFile(filepath.Join(stateDir, requeueFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if _, err = fmt.Fprintf(f, "%s\t%s\n", job.Kind, job.Key); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+// 读取命令行重新排队的任务
+func (s *Store) takeRequeue() {
+	file := filepath.Join(filepath.Dir(s.file), requeueFile)
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+
+	jobs := make([][2]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kind, key, ok := strings.Cut(scanner.Text(), "\t")
+		if ok && key != "" {
+			jobs = append(jobs, [2]string{kind, key})
+		}
+	}
+	_ = f.Close()
+	if err = os.Remove(file); err != nil {
+		utils.Logger.WarningF("remove requeue file: %s err: %v", file, err)
+		return
+	}
+
+	for _, item := range jobs {
+		if !s.Requeue(item[0], item[1]) {
+			continue
+		}
+
+		utils.Logger.InfoF("requeue %s job: %s", item[0], item[1])
+		s.lock.Lock()
+		handler := s.handlers[item[0]]
+		s.lock.Unlock()
+		if handler != nil {
+			go handler(item[1])
+		}
+	}
+}
+
+// Flush 把修改写入文件，先写临时文件再重命名，避免退出时写坏
+func (s *Store) Flush() error {
+	if s == nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	bytes, err := json.MarshalIndent(jobs, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+	if err = os.WriteFile(tmp, bytes, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.file); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// 标记为排队中，调用方需要持有锁
+func (s *Store) queue(kind, key string) {
+	job, ok := s.jobs[jobKey(kind, key)]
+	if !ok {
+		job = &Job{Kind: kind, Key: key, CreatedAt: time.Now()}
+		s.jobs[jobKey(kind, key)] = job
+	}
+
+	job.State = StateQueued
+	job.Attempts = 0
+	job.NextRetry = time.Time{}
+	job.UpdatedAt = time.Now()
+	s.dirty = true
+}
+
+func (s *Store) update(kind, key string, fn func(job *Job)) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	job, ok := s.jobs[jobKey(kind, key)]
+	if !ok {
+		job = &Job{Kind: kind, Key: key, CreatedAt: time.Now()}
+		s.jobs[jobKey(kind, key)] = job
+	}
+
+	fn(job)
+	job.UpdatedAt = time.Now()
+	s.dirty = true
+}
+
+// 文件或目录（包括直接下级的文件和目录，比如新增分集的季目录）的修改时间是否晚于t
+func modifiedAfter(path string, t time.Time) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if info.ModTime().After(t) {
+		return true
+	}
+	if !info.IsDir() {
+		return false
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.ModTime().After(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func jobKey(kind, key string) string {
+	return kind + ":" + key
+}
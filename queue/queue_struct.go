@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// 任务类型
+const (
+	KindMovie       = "movie"
+	KindShow        = "show"
+	KindMusicVideo  = "music_video"
+	KindKodiRefresh = "kodi_refresh"
+	KindKodiScan    = "kodi_scan"
+)
+
+// 失败原因
+const (
+	ReasonNotFound = "not_found" // 搜索不到，不会自动重试
+	ReasonReview   = "review"    // 搜索结果匹配度太低，需要人工确认，不会自动重试
+	ReasonHttp     = "http"      // 网络或者接口错误
+	ReasonParse    = "parse"     // 解析返回数据失败
+	ReasonOther    = "other"
+)
+
+// 任务状态
+const (
+	StateQueued  = "queued"
+	StateRunning = "running"
+	StateDone    = "done"
+	StateFailed  = "failed"
+)
+
+type Store struct {
+	lock        *sync.Mutex
+	file        string
+	jobs        map[string]*Job
+	dirty       bool // 有修改还没有写入文件
+	maxAttempts int
+	backoff     time.Duration
+	handlers    map[string]func(key string) // 命令行重新排队的任务交给对应类型的处理函数
+}
+
+type Job struct {
+	Kind      string    `json:"kind"`
+	Key       string    `json:"key"` // 电影、剧集、音乐视频为完整路径，kodi任务为任务内容
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"` // 开始处理的次数
+	LastError string    `json:"last_error,omitempty"`
+	Reason    string    `json:"reason,omitempty"` // 最后一次失败的原因
+	NextRetry time.Time `json:"next_retry"`       // 失败后等待重试的时间
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,213 @@
+package queue
+
+import (
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/tmdb"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "jobs.json")
+	s, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Enqueue(KindMovie, "/movies/a") {
+		t.Errorf("enqueue new job want true")
+	}
+	if s.Enqueue(KindMovie, "/movies/a") {
+		t.Errorf("enqueue queued job want false")
+	}
+	if !s.Enqueue(KindShow, "/movies/a") {
+		t.Errorf("enqueue same key with other kind want true")
+	}
+
+	s.Start(KindMovie, "/movies/a")
+	if s.Enqueue(KindMovie, "/movies/a") {
+		t.Errorf("enqueue running job want false")
+	}
+
+	s.Enqueue(KindMovie, "/movies/b")
+	s.Start(KindMovie, "/movies/b")
+	s.Finish(KindMovie, "/movies/b", false, fmt.Errorf("search movie %w", tmdb.ErrNotFound))
+
+	// 没有修改的任务完成后不再保留，有修改的保留为已完成
+	s.Enqueue(KindMovie, "/movies/c")
+	s.Start(KindMovie, "/movies/c")
+	s.Finish(KindMovie, "/movies/c", false, nil)
+	s.Enqueue(KindMovie, "/movies/d")
+	s.Start(KindMovie, "/movies/d")
+	s.Finish(KindMovie, "/movies/d", true, nil)
+	if err = s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unfinished := s.Unfinished(KindMovie)
+	if len(unfinished) != 1 || unfinished[0].Key != "/movies/a" || unfinished[0].State != StateRunning {
+		t.Errorf("unfinished want /movies/a running, give %+v", unfinished)
+	}
+
+	failed := s.List("", StateFailed)
+	if len(failed) != 1 || failed[0].Reason != ReasonNotFound || failed[0].Attempts != 1 {
+		t.Errorf("failed want /movies/b not found, give %+v", failed)
+	}
+
+	done := s.List(KindMovie, StateDone)
+	if len(done) != 1 || done[0].Key != "/movies/d" || len(s.List(KindMovie)) != 3 {
+		t.Errorf("done want only changed /movies/d, give %+v", s.List(KindMovie))
+	}
+
+	if s.Enqueue(KindMovie, "/movies/b") {
+		t.Errorf("enqueue unchanged failed job want false")
+	}
+	if !s.Requeue(KindMovie, "/movies/b") {
+		t.Errorf("requeue failed job want true")
+	}
+	if s.Requeue(KindMovie, "/movies/b") {
+		t.Errorf("requeue queued job want false")
+	}
+	if job := s.List(KindMovie, StateQueued); len(job) != 1 || job[0].Attempts != 0 {
+		t.Errorf("requeue failed job want queued with attempts reset, give %+v", job)
+	}
+}
+
+func TestStoreEnqueueModified(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	season := filepath.Join(dir, "Season 1")
+	if err = os.Mkdir(season, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Enqueue(KindShow, dir)
+	s.Start(KindShow, dir)
+	s.Finish(KindShow, dir, false, fmt.Errorf("search tv %w", tmdb.ErrLowConfidence))
+	if s.Enqueue(KindShow, dir) {
+		t.Errorf("enqueue unchanged review job want false")
+	}
+
+	// 季目录中新增了分集
+	later := time.Now().Add(time.Minute)
+	if err = os.Chtimes(season, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Enqueue(KindShow, dir) {
+		t.Errorf("enqueue modified review job want true")
+	}
+}
+
+func TestStoreRetry(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.maxAttempts = 3
+
+	s.Enqueue(KindShow, "/shows/a")
+	for i := 1; i <= 3; i++ {
+		s.Start(KindShow, "/shows/a")
+		delay, retry := s.Finish(KindShow, "/shows/a", false, errors.New("timeout"))
+		if retry != (i < 3) {
+			t.Errorf("attempt %d retry want %v, give %v", i, i < 3, retry)
+		}
+		if retry && (delay <= 0 || delay > s.backoff*time.Duration(i)) {
+			t.Errorf("attempt %d delay %s out of range", i, delay)
+		}
+	}
+
+	failed := s.List(KindShow, StateFailed)
+	if len(failed) != 1 || failed[0].Reason != ReasonOther || failed[0].LastError != "timeout" {
+		t.Errorf("failed want /shows/a timeout, give %+v", failed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		min, max time.Duration
+	}{
+		{1, time.Second * 30, time.Minute},
+		{2, time.Minute, time.Minute * 2},
+		{3, time.Minute * 2, time.Minute * 4},
+		{10, time.Minute * 30, time.Hour},
+	}
+	for _, item := range cases {
+		for i := 0; i < 10; i++ {
+			give := Backoff(time.Minute, item.attempts)
+			if give < item.min || give > item.max {
+				t.Errorf("Backoff(%d) give %s, want in [%s, %s]", item.attempts, give, item.min, item.max)
+			}
+		}
+	}
+}
+
+func TestReason(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("search movie %w", tmdb.ErrNotFound), ReasonNotFound},
+		{fmt.Errorf("search movie best match: 1 x confidence 0.30 %w", tmdb.ErrLowConfidence), ReasonReview},
+		{&tmdb.ApiError{HttpStatus: http.StatusBadGateway}, ReasonHttp},
+		{errors.New("save nfo err"), ReasonOther},
+	}
+	for _, item := range cases {
+		if give := Reason(item.err); give != item.want {
+			t.Errorf("Reason(%v) give %s, want %s", item.err, give, item.want)
+		}
+	}
+}
+
+func TestRescanReidentify(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Jobs = s
+	defer func() { Jobs = nil }()
+
+	pushed := make(chan string, 4)
+	parse := func(path string) ([]string, error) {
+		if path == "/movies" {
+			return []string{"/movies/a", "/movies/b"}, nil
+		}
+		return []string{path}, nil
+	}
+	key := func(item string) string { return item }
+	push := func(item string) bool {
+		pushed <- item
+		return true
+	}
+
+	s.Enqueue(KindMovie, "/movies/a")
+	queued, err := Rescan(KindMovie, "/movies", parse, key, push)
+	if err != nil || queued != 1 || <-pushed != "/movies/b" {
+		t.Errorf("rescan want only /movies/b queued, give %d %v", queued, err)
+	}
+
+	set := func(item string) error { return nil }
+	if ok, err := Reidentify(KindMovie, "/movies", parse, key, set, push); ok || err == nil {
+		t.Errorf("reidentify multiple items want error")
+	}
+	if ok, _ := Reidentify(KindMovie, "/movies/a", parse, key, set, push); ok {
+		t.Errorf("reidentify queued item want false")
+	}
+	if ok, err := Reidentify(KindMovie, "/movies/c", parse, key, set, push); !ok || err != nil || <-pushed != "/movies/c" {
+		t.Errorf("reidentify new item want queued, give %v %v", ok, err)
+	}
+}
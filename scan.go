@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/kodi"
+	"fengqi/kodi-metadata-tmdb-cli/movies"
+	"fengqi/kodi-metadata-tmdb-cli/music_videos"
+	"fengqi/kodi-metadata-tmdb-cli/shows"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// 单次扫描：处理完所有条目后输出汇总并退出，存在失败时返回非0
+// kodi-tmdb -config config.json scan [--movies] [--shows] [--music-videos] [path...]
+func runScan(ctx context.Context, c *config.Config, args []string) int {
+	var scanMovies, scanShows, scanMusicVideos bool
+	flagSet := flag.NewFlagSet("scan", flag.ExitOnError)
+	flagSet.BoolVar(&scanMovies, "movies", false, "scan movies")
+	flagSet.BoolVar(&scanShows, "shows", false, "scan shows")
+	flagSet.BoolVar(&scanMusicVideos, "music-videos", false, "scan music videos")
+	_ = flagSet.Parse(args)
+
+	// 不指定类型时扫描全部
+	if !scanMovies && !scanShows && !scanMusicVideos {
+		scanMovies, scanShows, scanMusicVideos = true, true, true
+	}
+
+	// 只选择了一种类型时，不在对应媒体库下的路径也交给它处理
+	single := onlyOne(scanMovies, scanShows, scanMusicVideos)
+	summary := utils.NewSummary()
+	moviesPaths, showsPaths, musicVideosPaths := make([]string, 0), make([]string, 0), make([]string, 0)
+	for _, path := range flagSet.Args() {
+		switch {
+		case scanMovies && (utils.InDirs(path, c.Collector.MoviesDir) != "" || single):
+			moviesPaths = append(moviesPaths, path)
+		case scanShows && (utils.InDirs(path, c.Collector.ShowsDir) != "" || single):
+			showsPaths = append(showsPaths, path)
+		case scanMusicVideos && (utils.InDirs(path, c.Collector.MusicVideosDir) != "" || single):
+			musicVideosPaths = append(musicVideosPaths, path)
+		default:
+			summary.Add(path, false, fmt.Errorf("path not in any selected library"))
+		}
+	}
+
+	// 指定了路径时只处理对应类型的路径
+	withPaths := flagSet.NArg() > 0
+	if scanMovies && (!withPaths || len(moviesPaths) > 0) {
+		movies.RunOnce(ctx, c, moviesPaths, summary)
+	}
+	if scanShows && (!withPaths || len(showsPaths) > 0) {
+		shows.RunOnce(ctx, c, showsPaths, summary)
+	}
+	if scanMusicVideos && (!withPaths || len(musicVideosPaths) > 0) {
+		music_videos.RunOnce(ctx, c, musicVideosPaths, summary)
+	}
+
+	kodi.Rpc.Flush()
+	if ctx.Err() != nil {
+		summary.Add("scan", false, fmt.Errorf("interrupted"))
+	}
+
+	// 演习模式输出json时，汇总信息输出到stderr，保证stdout可以直接解析
+	summaryOutput := os.Stdout
+	if utils.DryRun && planFormat == "json" {
+		summaryOutput = os.Stderr
+	}
+	summary.Print(summaryOutput)
+	if utils.DryRun {
+		if err := utils.Plan.Print(os.Stdout, planFormat); err != nil {
+			utils.Logger.ErrorF("print dry run plan err: %v", err)
+		}
+	}
+
+	return summary.ExitCode()
+}
+
+// 是否只选择了一种类型
+func onlyOne(flags ...bool) bool {
+	count := 0
+	for _, item := range flags {
+		if item {
+			count++
+		}
+	}
+	return count == 1
+}
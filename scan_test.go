@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/kodi"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	utils.InitLogger(utils.LogModeStdout, int(utils.FATAL), "")
+	m.Run()
+}
+
+func TestRunScanExitCode(t *testing.T) {
+	c := &config.Config{
+		Kodi:      &config.KodiConfig{},
+		Collector: &config.CollectorConfig{MoviesDir: []string{"/movies"}, ShowsDir: []string{"/shows"}},
+	}
+	kodi.InitKodi(context.Background(), c.Kodi)
+
+	// 不在任何媒体库中的路径记为失败，不会请求 TMDB
+	if code := runScan(context.Background(), c, []string{"/other/a", "/other/b"}); code != 1 {
+		t.Errorf("runScan with failed paths want 1, give %d", code)
+	}
+
+	// 被中断时也记为失败
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if code := runScan(ctx, c, []string{"/other/a"}); code != 1 {
+		t.Errorf("runScan interrupted want 1, give %d", code)
+	}
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/kodi"
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/movies"
+	"fengqi/kodi-metadata-tmdb-cli/music_videos"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+	"fengqi/kodi-metadata-tmdb-cli/shows"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 媒体库类型，和配置中的目录对应
+const (
+	libraryMovies      = "movies"
+	libraryShows       = "shows"
+	libraryMusicVideos = "music_videos"
+)
+
+type statusResponse struct {
+	StartedAt time.Time      `json:"started_at"`
+	Uptime    int64          `json:"uptime_seconds"`
+	Queues    map[string]int `json:"queues"` // 各个处理队列中等待的数量
+	Jobs      map[string]int `json:"jobs"`   // 持久化队列中各个状态的任务数量
+}
+
+type libraryStats struct {
+	Library string           `json:"library"`
+	Dir     string           `json:"dir"`
+	Stats   []*library.Stats `json:"stats"`
+}
+
+type pathRequest struct {
+	Path    string `json:"path"`
+	Id      int    `json:"id"`
+	Season  int    `json:"season"`
+	GroupId string `json:"group_id"`
+	Scan    bool   `json:"scan"`
+}
+
+// GET /api/status 运行时间、处理队列长度和任务数量
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	refresh, scan := kodi.Rpc.QueueLength()
+	resp := &statusResponse{
+		StartedAt: s.startedAt,
+		Uptime:    int64(time.Since(s.startedAt).Seconds()),
+		Queues: map[string]int{
+			libraryMovies:         movies.QueueLength(),
+			libraryShows:          shows.QueueLength(),
+			libraryMusicVideos:    music_videos.QueueLength(),
+			queue.KindKodiRefresh: refresh,
+			queue.KindKodiScan:    scan,
+		},
+		Jobs: map[string]int{
+			queue.StateQueued:  0,
+			queue.StateRunning: 0,
+			queue.StateDone:    0,
+			queue.StateFailed:  0,
+		},
+	}
+	for _, job := range queue.Jobs.List("") {
+		resp.Jobs[job.State]++
+	}
+
+	writeJson(w, http.StatusOK, resp)
+}
+
+// GET /api/jobs?kind=movie&state=failed&limit=50 最近更新的任务
+func (s *Server) jobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	states := make([]string, 0)
+	if state := query.Get("state"); state != "" {
+		states = append(states, state)
+	}
+
+	jobs := queue.Jobs.List(query.Get("kind"), states...)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].UpdatedAt.After(jobs[j].UpdatedAt)
+	})
+	if limit := queryLimit(r); len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+
+	writeJson(w, http.StatusOK, jobs)
+}
+
+// GET /api/errors?limit=50 最近的警告和错误日志
+func (s *Server) recentErrors(w http.ResponseWriter, r *http.Request) {
+	entries := utils.Logger.Recent()
+	if limit := queryLimit(r); len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	writeJson(w, http.StatusOK, entries)
+}
+
+// GET /api/stats 每个媒体库目录的条目统计，只返回目录下有的类型
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	resp := make([]*libraryStats, 0)
+	for _, name := range []string{libraryMovies, libraryShows, libraryMusicVideos} {
+		for _, dir := range s.libraryDirs(name) {
+			item := &libraryStats{Library: name, Dir: dir, Stats: make([]*library.Stats, 0)}
+			for _, stat := range library.Index.Stats(library.Filter{Under: dir}) {
+				if stat.Total > 0 {
+					item.Stats = append(item.Stats, stat)
+				}
+			}
+			resp = append(resp, item)
+		}
+	}
+
+	writeJson(w, http.StatusOK, resp)
+}
+
+// POST /api/rescan {"path": "/movies/Fortress.2021"} 重新处理路径下的条目
+func (s *Server) rescan(w http.ResponseWriter, r *http.Request) {
+	req, name, err := s.readPathRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var queued int
+	switch name {
+	case libraryMovies:
+		queued, err = movies.Rescan(req.Path)
+	case libraryShows:
+		queued, err = shows.Rescan(req.Path)
+	case libraryMusicVideos:
+		queued, err = music_videos.Rescan(req.Path)
+	}
+	if err != nil {
+		writeError(w, pathErrorCode(err), err)
+		return
+	}
+
+	utils.Logger.InfoF("http api rescan %s: %d queued", req.Path, queued)
+	writeJson(w, http.StatusOK, map[string]int{"queued": queued})
+}
+
+// POST /api/identify {"path": "/shows/Dexter", "id": 1405, "season": 1, "group_id": ""} 手动指定id后重新刮削
+func (s *Server) identify(w http.ResponseWriter, r *http.Request) {
+	req, name, err := s.readPathRequest(r)
+	if err == nil && req.Id <= 0 {
+		err = errors.New("id required")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	queued := false
+	switch name {
+	case libraryMovies:
+		queued, err = movies.Reidentify(req.Path, req.Id)
+	case libraryShows:
+		queued, err = shows.Reidentify(req.Path, req.Id, req.Season, req.GroupId)
+	default:
+		err = errors.New("identify only supports movies and shows")
+	}
+	if err != nil {
+		writeError(w, pathErrorCode(err), err)
+		return
+	}
+
+	// 已经在队列中或者正在处理的不再放入，下次处理时使用新的id
+	count := 0
+	if queued {
+		count = 1
+	}
+	utils.Logger.InfoF("http api identify %s as %d, queued: %d", req.Path, req.Id, count)
+	writeJson(w, http.StatusOK, map[string]int{"queued": count})
+}
+
+// POST /api/kodi/refresh {"scan": true, "path": ""} 立即执行Kodi的刷新和扫描任务，scan 为true时先添加扫描任务，路径为空时扫描整个媒体库
+func (s *Server) kodiRefresh(w http.ResponseWriter, r *http.Request) {
+	if s.config.Kodi == nil || !s.config.Kodi.Enable || kodi.Rpc == nil {
+		writeError(w, http.StatusConflict, errors.New("kodi not enabled"))
+		return
+	}
+
+	req := &pathRequest{}
+	if err := readJson(r, req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.Scan {
+		kodi.Rpc.AddScanTask(req.Path)
+	}
+	kodi.Rpc.Wake()
+
+	refresh, scan := kodi.Rpc.QueueLength()
+	writeJson(w, http.StatusOK, map[string]int{queue.KindKodiRefresh: refresh, queue.KindKodiScan: scan})
+}
+
+// 读取带路径的请求，返回路径所在的媒体库
+func (s *Server) readPathRequest(r *http.Request) (*pathRequest, string, error) {
+	req := &pathRequest{}
+	if err := readJson(r, req); err != nil {
+		return nil, "", err
+	}
+	if req.Path == "" || !filepath.IsAbs(req.Path) {
+		return nil, "", errors.New("absolute path required")
+	}
+	req.Path = filepath.Clean(req.Path)
+
+	for _, name := range []string{libraryMovies, libraryShows, libraryMusicVideos} {
+		if utils.InDirs(req.Path, s.libraryDirs(name)) != "" {
+			return req, name, nil
+		}
+	}
+
+	return nil, "", errors.New("path not in any library")
+}
+
+func (s *Server) libraryDirs(name string) []string {
+	switch name {
+	case libraryMovies:
+		return s.config.Collector.MoviesDir
+	case libraryShows:
+		return s.config.Collector.ShowsDir
+	case libraryMusicVideos:
+		return s.config.Collector.MusicVideosDir
+	}
+	return nil
+}
+
+// 请求体为空时使用默认值
+func readJson(r *http.Request, v any) error {
+	err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func queryLimit(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return 50
+	}
+	return limit
+}
+
+func pathErrorCode(err error) int {
+	if errors.Is(err, fs.ErrNotExist) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
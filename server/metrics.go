@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fengqi/kodi-metadata-tmdb-cli/kodi"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
+	"fengqi/kodi-metadata-tmdb-cli/movies"
+	"fengqi/kodi-metadata-tmdb-cli/music_videos"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+	"fengqi/kodi-metadata-tmdb-cli/shows"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 队列长度和任务数量在输出时读取，和 /api/status 一致
+type statusCollector struct {
+	queueLength *prometheus.Desc
+	jobs        *prometheus.Desc
+}
+
+var metricsHandler = promhttp.Handler()
+
+func init() {
+	prometheus.MustRegister(&statusCollector{
+		queueLength: prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "", "queue_length"),
+			"Items waiting in each process queue", []string{"queue"}, nil),
+		jobs: prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "", "jobs"),
+			"Persistent jobs by kind and state", []string{"kind", "state"}, nil),
+	})
+}
+
+func (c *statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queueLength
+	ch <- c.jobs
+}
+
+func (c *statusCollector) Collect(ch chan<- prometheus.Metric) {
+	refresh, scan := kodi.Rpc.QueueLength()
+	queues := map[string]int{
+		libraryMovies:         movies.QueueLength(),
+		libraryShows:          shows.QueueLength(),
+		libraryMusicVideos:    music_videos.QueueLength(),
+		queue.KindKodiRefresh: refresh,
+		queue.KindKodiScan:    scan,
+	}
+	for name, length := range queues {
+		ch <- prometheus.MustNewConstMetric(c.queueLength, prometheus.GaugeValue, float64(length), name)
+	}
+
+	jobs := make(map[[2]string]int, 0)
+	for _, job := range queue.Jobs.List("") {
+		jobs[[2]string{job.Kind, job.State}]++
+	}
+	for key, count := range jobs {
+		ch <- prometheus.MustNewConstMetric(c.jobs, prometheus.GaugeValue, float64(count), key[0], key[1])
+	}
+}
+
+// GET /metrics Prometheus 文本格式的指标
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	metricsHandler.ServeHTTP(w, r)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"net/http"
+	"time"
+)
+
+const defaultListen = "127.0.0.1:8899"
+
+type Server struct {
+	config    *config.Config
+	startedAt time.Time
+}
+
+// InitServer 开启状态和控制接口，收到退出信号后关闭，没有开启时不处理
+func InitServer(ctx context.Context, config *config.Config) {
+	if config.Http == nil || !config.Http.Enable {
+		return
+	}
+
+	listen := config.Http.Listen
+	if listen == "" {
+		listen = defaultListen
+	}
+
+	s := &Server{config: config, startedAt: time.Now()}
+	httpServer := &http.Server{
+		Addr:              listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	go func() {
+		utils.Logger.InfoF("http api listen on %s", listen)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			utils.Logger.ErrorF("http api listen on %s err: %v", listen, err)
+		}
+	}()
+
+	context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	})
+}
+
+// Handler 所有接口，配置了访问令牌时先检查令牌
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", s.get(s.status))
+	mux.HandleFunc("/api/jobs", s.get(s.jobs))
+	mux.HandleFunc("/api/errors", s.get(s.recentErrors))
+	mux.HandleFunc("/api/stats", s.get(s.stats))
+	mux.HandleFunc("/api/rescan", s.post(s.rescan))
+	mux.HandleFunc("/api/identify", s.post(s.identify))
+	mux.HandleFunc("/api/kodi/refresh", s.post(s.kodiRefresh))
+	mux.HandleFunc("/metrics", s.get(s.metrics))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := s.config.Http.Token; token != "" {
+			auth := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) get(fn http.HandlerFunc) http.HandlerFunc {
+	return s.method(http.MethodGet, fn)
+}
+
+func (s *Server) post(fn http.HandlerFunc) http.HandlerFunc {
+	return s.method(http.MethodPost, fn)
+}
+
+func (s *Server) method(method string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		fn(w, r)
+	}
+}
+
+func writeJson(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(v); err != nil {
+		utils.Logger.WarningF("write http api response err: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJson(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, token string) http.Handler {
+	utils.InitLogger(utils.LogModeStdout, int(utils.ERROR), "")
+
+	store, err := queue.Open(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := queue.Jobs
+	queue.Jobs = store
+	t.Cleanup(func() { queue.Jobs = jobs })
+
+	s := &Server{
+		config: &config.Config{
+			Http:      &config.HttpConfig{Enable: true, Token: token},
+			Kodi:      &config.KodiConfig{},
+			Collector: &config.CollectorConfig{MoviesDir: []string{"/movies"}, ShowsDir: []string{"/shows"}},
+		},
+		startedAt: time.Now(),
+	}
+	return s.Handler()
+}
+
+func request(handler http.Handler, method, url, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestToken(t *testing.T) {
+	handler := newTestServer(t, "secret")
+
+	if w := request(handler, http.MethodGet, "/api/status", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("request without token want 401, give %d", w.Code)
+	}
+	if w := request(handler, http.MethodGet, "/api/status", "", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("request with wrong token want 401, give %d", w.Code)
+	}
+	if w := request(handler, http.MethodGet, "/api/status", "", "secret"); w.Code != http.StatusOK {
+		t.Errorf("request with token want 200, give %d", w.Code)
+	}
+	if w := request(handler, http.MethodPost, "/api/status", "", "secret"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("post status want 405, give %d", w.Code)
+	}
+}
+
+func TestStatusAndJobs(t *testing.T) {
+	handler := newTestServer(t, "")
+	queue.Jobs.Enqueue(queue.KindMovie, "/movies/a")
+	queue.Jobs.Enqueue(queue.KindMovie, "/movies/b")
+	queue.Jobs.Start(queue.KindMovie, "/movies/b")
+	queue.Jobs.Finish(queue.KindMovie, "/movies/b", false, fmt.Errorf("not found"))
+	queue.Jobs.Enqueue(queue.KindShow, "/shows/c")
+
+	w := request(handler, http.MethodGet, "/api/status", "", "")
+	status := &statusResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Jobs[queue.StateQueued] != 3 || status.Queues[libraryMovies] != 0 {
+		t.Errorf("status want 3 queued jobs, give %+v", status)
+	}
+
+	w = request(handler, http.MethodGet, "/api/jobs?kind=movie&limit=1", "", "")
+	jobs := make([]*queue.Job, 0)
+	if err := json.Unmarshal(w.Body.Bytes(), &jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Key != "/movies/b" {
+		t.Errorf("jobs want latest updated /movies/b, give %+v", jobs)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	handler := newTestServer(t, "")
+	utils.Logger.Info("ignored")
+	utils.Logger.ErrorF("process movie: %s err: %v", "a", "timeout")
+
+	w := request(handler, http.MethodGet, "/api/errors", "", "")
+	entries := make([]*utils.LogEntry, 0)
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || entries[0].Message != "process movie: a err: timeout" || entries[0].Level != "error" {
+		t.Errorf("errors want latest error first, give %+v", entries)
+	}
+}
+
+func TestRescan(t *testing.T) {
+	handler := newTestServer(t, "")
+
+	cases := map[string]int{
+		``:                                     http.StatusBadRequest,
+		`{"path": "movies/a"}`:                 http.StatusBadRequest,
+		`{"path": "/downloads/a"}`:             http.StatusBadRequest,
+		`{"path": "/movies/a"}`:                http.StatusBadRequest, // 电影刮削没有运行
+		`{"path": "/music_videos/a", "id": 1}`: http.StatusBadRequest,
+	}
+	for body, want := range cases {
+		if w := request(handler, http.MethodPost, "/api/rescan", body, ""); w.Code != want {
+			t.Errorf("rescan %s want %d, give %d %s", body, want, w.Code, w.Body.String())
+		}
+	}
+
+	if w := request(handler, http.MethodPost, "/api/identify", `{"path": "/shows/a"}`, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("identify without id want 400, give %d", w.Code)
+	}
+	if w := request(handler, http.MethodPost, "/api/kodi/refresh", ``, ""); w.Code != http.StatusConflict {
+		t.Errorf("kodi refresh when disabled want 409, give %d", w.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	handler := newTestServer(t, "secret")
+	queue.Jobs.Enqueue(queue.KindMovie, "/movies/a")
+
+	if w := request(handler, http.MethodGet, "/metrics", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("metrics without token want 401, give %d", w.Code)
+	}
+
+	w := request(handler, http.MethodGet, "/metrics", "", "secret")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("metrics want 200 text/plain, give %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`kodi_tmdb_queue_length{queue="movies"} 0`,
+		`kodi_tmdb_jobs{kind="movie",state="queued"} 1`,
+		"# TYPE kodi_tmdb_last_processed_timestamp_seconds gauge",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics want %s, give %s", want, w.Body.String())
+		}
+	}
+}
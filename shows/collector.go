@@ -1,9 +1,15 @@
 package shows
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fengqi/kodi-metadata-tmdb-cli/config"
 	"fengqi/kodi-metadata-tmdb-cli/kodi"
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+	"fengqi/kodi-metadata-tmdb-cli/tmdb"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"fmt"
 	"io/fs"
@@ -17,150 +23,333 @@ import (
 )
 
 type Collector struct {
+	ctx     context.Context // 取消后不再接收新的任务
 	config  *config.Config
 	dirChan chan *Dir
+	summary *utils.Summary // 单次运行模式下的结果汇总，为空时表示常驻运行
 }
 
 var collector *Collector
 
-func RunCollector(config *config.Config, wg *sync.WaitGroup) {
+func RunCollector(ctx context.Context, config *config.Config, wg *sync.WaitGroup) {
 	defer wg.Done()
 	collector = &Collector{
+		ctx:     ctx,
 		config:  config,
 		dirChan: make(chan *Dir, 100),
 	}
 
 	collector.initWatcher()
 	go collector.runWatcher()
-	go collector.showsDirProcess()
-	collector.runCronScan()
+	queue.Jobs.Handle(queue.KindShow, collector.replay)
+	go func() {
+		collector.replayJobs()
+		collector.runCronScan()
+	}()
+	collector.runShowsProcess()
+
+	_ = watcher.Close()
+	utils.Logger.Info("shows collector stopped")
+}
+
+// RunOnce 单次运行：扫描指定路径（为空时扫描配置的全部剧集目录）并处理完成后返回
+func RunOnce(ctx context.Context, config *config.Config, paths []string, summary *utils.Summary) {
+	collector = &Collector{
+		ctx:     ctx,
+		config:  config,
+		summary: summary,
+	}
+
+	if len(paths) == 0 {
+		paths = config.Collector.ShowsDir
+	}
+
+	for _, item := range paths {
+		showDirs, err := collector.scanPath(item)
+		if err != nil {
+			summary.Add(item, false, err)
+			continue
+		}
+
+		for _, showDir := range showDirs {
+			collector.dispatch(showDir)
+		}
+	}
+}
+
+// 分发目录处理任务：单次运行时直接处理并记录结果，否则加入队列，收到退出信号时放弃
+func (c *Collector) dispatch(dir *Dir) {
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	if c.summary == nil {
+		// 已经在队列中的直接跳过
+		if queue.Jobs.Enqueue(queue.KindShow, dir.GetFullDir()) {
+			c.push(dir)
+		}
+		return
+	}
+
+	scraped, err := c.showsDirProcess(dir)
+	metrics.Processed(library.KindShow, err)
+	c.summary.Add(dir.GetFullDir(), scraped, err)
+}
+
+// 放入处理队列，收到退出信号时放弃，任务保留在持久化队列中下次启动时继续
+func (c *Collector) push(dir *Dir) bool {
+	select {
+	case <-c.ctx.Done():
+		return false
+	case c.dirChan <- dir:
+		return true
+	}
+}
+
+// 等待一段时间后放入处理队列，用于失败重试
+func (c *Collector) pushAfter(dir *Dir, delay time.Duration) {
+	select {
+	case <-c.ctx.Done():
+	case <-time.After(delay):
+		c.push(dir)
+	}
+}
+
+// 重新放入上次退出时没有处理完的任务，等待重试的任务到时间后再放入
+func (c *Collector) replayJobs() {
+	for _, job := range queue.Jobs.Unfinished(queue.KindShow) {
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		utils.Logger.InfoF("replay unfinished shows job: %s", job.Key)
+		if delay := time.Until(job.NextRetry); delay > 0 {
+			go func(key string) {
+				select {
+				case <-c.ctx.Done():
+				case <-time.After(delay):
+					c.replay(key)
+				}
+			}(job.Key)
+			continue
+		}
+		c.replay(job.Key)
+	}
+}
+
+// 重新解析任务路径并放入处理队列，路径已经不存在时删除任务
+func (c *Collector) replay(key string) {
+	showDirs, err := c.scanPath(key)
+	if err != nil {
+		utils.Logger.WarningF("drop shows job: %s err: %v", key, err)
+		queue.Jobs.Remove(queue.KindShow, key)
+		if !utils.FileExist(key) {
+			library.Index.Remove(key)
+		}
+		return
+	}
+
+	for _, showDir := range showDirs {
+		if !c.push(showDir) {
+			return
+		}
+	}
 }
 
 // 目录处理队列消费
-func (c *Collector) showsDirProcess() {
+func (c *Collector) runShowsProcess() {
 	utils.Logger.Debug("run shows dir process")
-	showsStorageDir := c.config.Collector.ShowsStorageDir
 	for {
+		// 收到退出信号后不再处理新的任务
+		if c.ctx.Err() != nil {
+			return
+		}
+
 		select {
-		case dir := <-c.dirChan: // todo dir处理挪到独立的方法
+		case <-c.ctx.Done():
+			return
+
+		case dir := <-c.dirChan:
 			utils.Logger.DebugF("shows dir process receive task: %v", dir.OriginTitle)
 
-			detail, err := dir.getTvDetail()
-			if err != nil || detail == nil {
-				continue
+			queue.Jobs.Start(queue.KindShow, dir.GetFullDir())
+			scraped, err := c.showsDirProcess(dir)
+			metrics.Processed(library.KindShow, err)
+			if err != nil {
+				utils.Logger.ErrorF("process shows dir: %s err: %v", dir.OriginTitle, err)
+			}
+			if delay, retry := queue.Jobs.Finish(queue.KindShow, dir.GetFullDir(), scraped, err); retry {
+				utils.Logger.InfoF("retry shows dir: %s after %s", dir.OriginTitle, delay)
+				go c.pushAfter(dir, delay)
 			}
+		}
+	}
+}
+
+// 单个电视剧目录处理，返回是否写入了新的NFO
+func (c *Collector) showsDirProcess(dir *Dir) (bool, error) {
+	detail, err := dir.getTvDetail()
+	if err == nil && detail == nil {
+		err = errors.New("tv detail empty")
+	}
+	if err != nil {
+		dir.updateIndex(nil, false, err)
+		return false, err
+	}
+
+	scraped := false
+	if !detail.FromCache || !dir.NfoExist() || utils.ForeignNfo(dir.GetNfoFile(), detail.Id) {
+		dir.fillExternalIds(detail)
+		if err = dir.saveToNfo(detail); err != nil {
+			err = fmt.Errorf("save tvshow nfo err: %v", err)
+			dir.updateIndex(detail, false, err)
+			return false, err
+		}
+		kodi.Rpc.AddRefreshTask(kodi.TaskRefreshTVShow, detail.OriginalName)
+		scraped = true
+	}
+	//下载电视剧的相关图片
+	dir.downloadImage(detail)
+	dir.updateIndex(detail, scraped, nil)
+	if dir.IsCollection { // 合集
+		subDir, err := c.scanDir(dir.GetFullDir())
+		if err != nil {
+			return scraped, fmt.Errorf("scan collection dir: %s err: %v", dir.OriginTitle, err)
+		}
 
-			if !detail.FromCache || !dir.NfoExist() {
-				_ = dir.saveToNfo(detail)
-				kodi.Rpc.AddRefreshTask(kodi.TaskRefreshTVShow, detail.OriginalName)
+		for _, item := range subDir {
+			c.watchDir(filepath.Join(item.Dir, item.OriginTitle))
+			if item.TvId == 0 {
+				item.TvId = dir.TvId
 			}
-			//下载电视剧的相关图片
-			dir.downloadImage(detail)
-			if dir.IsCollection { // 合集
-				subDir, err := c.scanDir(dir.GetFullDir())
-				if err != nil {
-					utils.Logger.ErrorF("scan collection dir: %s err: %v", dir.OriginTitle, err)
+			c.dispatch(item)
+		}
+		return scraped, nil
+	}
+
+	// 普通剧集
+	subFiles, err := c.scanShowsFile(dir)
+	//下载季度相关的图片
+	dir.downloadSeasonPosterImage(detail)
+	if err != nil {
+		return scraped, fmt.Errorf("scan shows dir: %s err: %v", dir.OriginTitle, err)
+	}
+
+	files := make(map[int]map[string]*File, 0)
+	if len(subFiles) > 0 {
+		files[dir.Season] = subFiles
+	}
+
+	if len(files) == 0 {
+		utils.Logger.WarningF("scan shows file empty: %s", dir.OriginTitle)
+		return scraped, nil
+	}
+
+	// 剧集组的分集信息写入缓存, 供后面处理分集信息使用
+	if dir.GroupId != "" && detail.TvEpisodeGroupDetail != nil {
+		for _, group := range detail.TvEpisodeGroupDetail.Groups {
+			group.SortEpisode()
+			for k, episode := range group.Episodes {
+				se := fmt.Sprintf("s%02de%02d", group.Order, k+1)
+				file, ok := files[group.Order][se]
+				if !ok {
 					continue
 				}
 
-				for _, item := range subDir {
-					c.watchDir(filepath.Join(item.Dir, item.OriginTitle))
-					item.TvId = dir.TvId
-					c.dirChan <- item
+				cacheFile := filepath.Join(file.getCacheDir(), se+".json")
+				episode.EpisodeNumber = k + 1
+				episode.SeasonNumber = group.Order
+				bytes, err := json.MarshalIndent(episode, "", "    ")
+				if err != nil {
+					return scraped, fmt.Errorf("save tv to cache, marshal struct errr: %v", err)
 				}
-				continue
-			}
 
-			// 普通剧集
-			subFiles, err := c.scanShowsFile(dir)
-			//下载季度相关的图片
-			dir.downloadSeasonPosterImage(detail)
-			if err != nil {
-				utils.Logger.ErrorF("scan shows dir: %s err: %v", dir.OriginTitle, err)
-				continue
+				err = utils.WriteFile(utils.ActionWriteCache, cacheFile, bytes, 0644)
+				if err != nil {
+					return scraped, fmt.Errorf("save tv to cache, write file err: %v", err)
+				}
 			}
+		}
+	}
 
-			files := make(map[int]map[string]*File, 0)
-			if len(subFiles) > 0 {
-				files[dir.Season] = subFiles
+	// 普通剧集每一季只请求一次，剧集组的分集信息已经写入缓存
+	seasons := make(map[int]*tmdb.TvSeasonDetail, 0)
+	failed := 0
+	for _, file := range files {
+		for _, subFile := range file {
+			season, ok := seasons[subFile.Season]
+			if !ok && dir.GroupId == "" {
+				season = dir.getTvSeasonDetail(subFile.Season)
+				seasons[subFile.Season] = season
 			}
 
-			if len(files) == 0 {
-				utils.Logger.WarningF("scan shows file empty: %s", dir.OriginTitle)
+			written, err := c.showsFileProcess(dir.GetFullDir(), detail.OriginalName, subFile, season)
+			metrics.Processed(library.KindEpisode, err)
+			if err != nil {
+				failed++
 				continue
 			}
+			scraped = scraped || written
+		}
+	}
+	for number, season := range seasons {
+		if season != nil && season.Updated {
+			season.SaveToCache(dir.getSeasonCacheFile(number))
+		}
+	}
+	if failed > 0 {
+		return scraped, fmt.Errorf("%d episodes failed", failed)
+	}
 
-			// 剧集组的分集信息写入缓存, 供后面处理分集信息使用
-			if dir.GroupId != "" && detail.TvEpisodeGroupDetail != nil {
-				for _, group := range detail.TvEpisodeGroupDetail.Groups {
-					group.SortEpisode()
-					for k, episode := range group.Episodes {
-						se := fmt.Sprintf("s%02de%02d", group.Order, k+1)
-						file, ok := files[group.Order][se]
-						if !ok {
-							continue
-						}
-
-						cacheFile := fmt.Sprintf("%s/tmdb/%s.json", file.Dir, se)
-						f, err := os.OpenFile(cacheFile, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
-						if err != nil {
-							utils.Logger.ErrorF("save tv to cache, open_file err: %v", err)
-							return
-						}
-
-						episode.EpisodeNumber = k + 1
-						episode.SeasonNumber = group.Order
-						bytes, err := json.MarshalIndent(episode, "", "    ")
-						if err != nil {
-							utils.Logger.ErrorF("save tv to cache, marshal struct errr: %v", err)
-							return
-						}
-
-						_, err = f.Write(bytes)
-						_ = f.Close()
-					}
-				}
-			}
-
-			for _, file := range files {
-				for _, subFile := range file {
-					c.showsFileProcess(detail.OriginalName, subFile)
-				}
-			}
-			if c.config.Collector.MoveToStorage && showsStorageDir != "" {
-				firstAirDate := ""
-				if detail.FirstAirDate != "" {
-					firstAirDate = strings.SplitN(detail.FirstAirDate, "-", 2)[0]
-				}
-				err = dir.MoveToStorage(showsStorageDir, fmt.Sprintf("%s (%s)", utils.SanitizeFileName(detail.Name), firstAirDate), dir.Season)
-				if err != nil {
-					utils.Logger.Error(err.Error())
-					return
-				}
-			}
+	showsStorageDir := c.config.Collector.ShowsStorageDir
+	if c.config.Collector.MoveToStorage && showsStorageDir != "" {
+		firstAirDate := ""
+		if detail.FirstAirDate != "" {
+			firstAirDate = strings.SplitN(detail.FirstAirDate, "-", 2)[0]
+		}
+		err = dir.MoveToStorage(showsStorageDir, fmt.Sprintf("%s (%s)", utils.SanitizeFileName(detail.Name), firstAirDate), dir.Season)
+		metrics.MoveToStorage("shows", err)
+		if err != nil {
+			return scraped, err
 		}
 	}
+
+	return scraped, nil
 }
 
-// 单个剧集处理
-func (c *Collector) showsFileProcess(originalName string, showsFile *File) bool {
+// 单个剧集处理，返回是否写入了新的NFO
+func (c *Collector) showsFileProcess(show, originalName string, showsFile *File, season *tmdb.TvSeasonDetail) (bool, error) {
 	utils.Logger.DebugF("episode process: season: %d episode: %d %s", showsFile.Season, showsFile.Episode, showsFile.OriginTitle)
 
-	episodeDetail, err := showsFile.getTvEpisodeDetail()
+	episodeDetail, err := showsFile.getTvEpisodeDetail(season)
 	if err != nil || episodeDetail == nil {
 		utils.Logger.WarningF("get tv episode detail err: %v", err)
-		return false
+		if err == nil {
+			err = errors.New("tv episode detail empty")
+		}
+		showsFile.updateIndex(show, nil, false, err)
+		return false, err
 	}
 
-	if !episodeDetail.FromCache || !showsFile.NfoExist() {
-		_ = showsFile.saveToNfo(episodeDetail)
+	scraped := false
+	// 旧版本写入的NFO没有 tmdb 类型的 uniqueid，开启 stream_details 或者视频文件被替换后也需要重新写入
+	if !episodeDetail.FromCache || !showsFile.NfoExist() || utils.ForeignNfo(showsFile.getNfoFile(), episodeDetail.Id) ||
+		showsFile.probeStale() {
+		showsFile.fillExternalIds(episodeDetail, season)
+		if err = showsFile.saveToNfo(episodeDetail); err != nil {
+			err = fmt.Errorf("save episode nfo err: %v", err)
+			showsFile.updateIndex(show, episodeDetail, false, err)
+			return false, err
+		}
 		taskVal := fmt.Sprintf("%s|-|%d|-|%d", originalName, episodeDetail.SeasonNumber, episodeDetail.EpisodeNumber)
 		kodi.Rpc.AddRefreshTask(kodi.TaskRefreshEpisode, taskVal)
+		scraped = true
 	}
 
 	showsFile.downloadImage(episodeDetail)
+	showsFile.updateIndex(show, episodeDetail, scraped, nil)
 
-	return true
+	return scraped, nil
 }
 
 // 目录扫描，定时任务，扫描到的目录和文件增加到队列
@@ -181,14 +370,15 @@ func (c *Collector) runCronScan() {
 				c.watchDir(filepath.Join(showDir.Dir, showDir.OriginTitle))
 
 				// 预留50%空间给可能重新放回队列的任务
-				for {
-					if len(c.dirChan) < 100*0.5 {
-						break
+				for len(c.dirChan) >= 100*0.5 {
+					select {
+					case <-c.ctx.Done():
+						return
+					case <-time.After(time.Second * 2):
 					}
-					time.Sleep(time.Second * 2)
 				}
 
-				c.dirChan <- showDir
+				c.dispatch(showDir)
 			}
 		}
 
@@ -199,14 +389,41 @@ func (c *Collector) runCronScan() {
 
 	task() // TODO 启动后立即运行可控
 	ticker := time.NewTicker(time.Second * time.Duration(c.config.Collector.CronSeconds))
+	defer ticker.Stop()
 	for {
 		select {
+		case <-c.ctx.Done():
+			return
 		case <-ticker.C:
 			task()
 		}
 	}
 }
 
+// 扫描单个路径：可以是剧集根目录，也可以是单个电视剧或合集目录
+func (c *Collector) scanPath(path string) ([]*Dir, error) {
+	path = filepath.Clean(path)
+	if utils.InDirs(path, c.config.Collector.ShowsDir) == path {
+		return c.scanDir(path)
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fileInfo.IsDir() {
+		return nil, fmt.Errorf("shows path: %s is not a dir", path)
+	}
+
+	showDir := c.parseShowsDir(filepath.Dir(path), fileInfo)
+	if showDir == nil {
+		return nil, fmt.Errorf("parse shows dir: %s failed", path)
+	}
+
+	return []*Dir{showDir}, nil
+}
+
 // 扫描普通目录，返回其中的电视剧
 func (c *Collector) scanDir(dir string) ([]*Dir, error) {
 	showDirs := make([]*Dir, 0)
@@ -293,6 +510,21 @@ func (c *Collector) scanShowsFile(d *Dir) (map[string]*File, error) {
 		}
 	}
 
+	// 手动指定的集数偏移，偏移后小于1的跳过
+	if d.EpisodeOffset != 0 {
+		offsetFiles := make([]*File, 0, len(showFiles))
+		for _, item := range showFiles {
+			item.Episode += d.EpisodeOffset
+			item.SeasonEpisode = fmt.Sprintf("s%02de%02d", item.Season, item.Episode)
+			if item.Episode < 1 {
+				utils.Logger.WarningF("episode: %s out of range after offset %d", item.OriginTitle, d.EpisodeOffset)
+				continue
+			}
+			offsetFiles = append(offsetFiles, item)
+		}
+		showFiles = offsetFiles
+	}
+
 	// TODO 忘记这里为啥返回map，而不是slice了，先临时转成map，后续看看能不能改回来
 	showFilesMap := make(map[string]*File)
 	for _, item := range showFiles {
@@ -338,6 +570,8 @@ func (c *Collector) parseShowsFile(dir *Dir, file fs.FileInfo) *File {
 		SeasonEpisode: fmt.Sprintf("s%02de%02d", snum, enum),
 		Suffix:        suffix,
 		TvId:          dir.TvId,
+		Language:      dir.Language,
+		GroupId:       dir.GroupId,
 	}
 }
 
@@ -444,17 +678,26 @@ func (c *Collector) parseShowsDir(baseDir string, file fs.FileInfo) *Dir {
 	// 文件名清理
 	showsDir.Title, showsDir.AliasTitle = utils.SplitTitleAlias(showsDir.Title)
 	showsDir.ChsTitle, showsDir.EngTitle = utils.SplitChsEngTitle(showsDir.Title)
+
+	// 读特殊指定的值
+	showsDir.ReadExternalId(file.Name())
+	if !showsDir.ReadOverride() {
+		return nil
+	}
 	if len(showsDir.Title) == 0 {
 		utils.Logger.WarningF("file: %s parse title empty: %v", file.Name(), showsDir)
 		return nil
 	}
-
-	// 读特殊指定的值
-	showsDir.ReadSeason()
-	showsDir.ReadTvId()
-	showsDir.ReadGroupId()
 	showsDir.checkCacheDir()
-	showsDir.ReadPart()
 
 	return showsDir
 }
+
+// 媒体库根目录，包括存储目录，用于判断缓存目录记录的原路径是不是真的不存在了
+func (c *Collector) libraryRoots() []string {
+	roots := append([]string{}, c.config.Collector.ShowsDir...)
+	if c.config.Collector.ShowsStorageDir != "" {
+		roots = append(roots, c.config.Collector.ShowsStorageDir)
+	}
+	return roots
+}
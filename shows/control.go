@@ -0,0 +1,35 @@
+package shows
+
+import (
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/queue"
+)
+
+// QueueLength 常驻运行时处理队列中等待的剧集目录数量
+func QueueLength() int {
+	if collector == nil || collector.dirChan == nil {
+		return 0
+	}
+	return len(collector.dirChan)
+}
+
+// Rescan 常驻运行时重新处理路径下的剧集，返回放入队列的数量，已经在队列中的不计算
+func Rescan(path string) (int, error) {
+	if collector == nil || collector.dirChan == nil {
+		return 0, errors.New("shows collector not running")
+	}
+
+	return queue.Rescan(queue.KindShow, path, collector.scanPath, (*Dir).GetFullDir, collector.push)
+}
+
+// Reidentify 常驻运行时手动指定剧集id，以及可选的季和剧集分组，写入 override.json 后重新放入处理队列，返回是否放入了队列
+func Reidentify(path string, id, season int, groupId string) (bool, error) {
+	if collector == nil || collector.dirChan == nil {
+		return false, errors.New("shows collector not running")
+	}
+
+	set := func(dir *Dir) error {
+		return dir.SetTvId(id, season, groupId)
+	}
+	return queue.Reidentify(queue.KindShow, path, collector.scanPath, (*Dir).GetFullDir, set, collector.push)
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"fengqi/kodi-metadata-tmdb-cli/library"
 	"fengqi/kodi-metadata-tmdb-cli/tmdb"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"fengqi/kodi-metadata-tmdb-cli/webdav"
@@ -34,80 +35,47 @@ var videoExtensions = []string{"mkv",
 // Dir 电视剧目录详情，从名字分析
 // World.Heritage.In.China.E01-E38.2008.CCTVHD.x264.AC3.720p-CMCT
 type Dir struct {
-	Dir          string `json:"dir"`
-	OriginTitle  string `json:"origin_title"`  // 原始文件名
-	Title        string `json:"title"`         // 从视频提取的文件名 鹰眼 Hawkeye
-	AliasTitle   string `json:"alias_title"`   // 别名，通常没有用
-	ChsTitle     string `json:"chs_title"`     // 分离出来的中文名称 鹰眼
-	EngTitle     string `json:"eng_title"`     // 分离出来的英文名称 Hawkeye
-	TvId         int    `json:"tv_id"`         // TMDb tv id
-	GroupId      string `json:"group_id"`      // TMDB Episode Group
-	Season       int    `json:"season"`        // 第几季 ，电影类 -1
-	SeasonRange  string `json:"season_range"`  // 合集：S01-S05
-	Year         int    `json:"year"`          // 年份：2020、2021
-	YearRange    string `json:"year_range"`    // 年份：2010-2015
-	Format       string `json:"format"`        // 格式：720p、1080p
-	Source       string `json:"source"`        // 来源
-	Studio       string `json:"studio"`        // 媒体
-	IsCollection bool   `json:"is_collection"` // 是否是合集目录
-	PartMode     int    `json:"part_mode"`     // 分卷模式: 0不使用分卷, 1-自动, 2以上为手动指定分卷数量
+	Dir           string `json:"dir"`
+	OriginTitle   string `json:"origin_title"`   // 原始文件名
+	Title         string `json:"title"`          // 从视频提取的文件名 鹰眼 Hawkeye
+	AliasTitle    string `json:"alias_title"`    // 别名，通常没有用
+	ChsTitle      string `json:"chs_title"`      // 分离出来的中文名称 鹰眼
+	EngTitle      string `json:"eng_title"`      // 分离出来的英文名称 Hawkeye
+	TvId          int    `json:"tv_id"`          // TMDb tv id
+	ImdbId        string `json:"imdb_id"`        // 目录名、id文件或NFO中的IMDb id
+	TvdbId        string `json:"tvdb_id"`        // 目录名、id文件或NFO中的TVDB id
+	GroupId       string `json:"group_id"`       // TMDB Episode Group
+	Season        int    `json:"season"`         // 第几季 ，电影类 -1
+	SeasonRange   string `json:"season_range"`   // 合集：S01-S05
+	Year          int    `json:"year"`           // 年份：2020、2021
+	YearRange     string `json:"year_range"`     // 年份：2010-2015
+	Format        string `json:"format"`         // 格式：720p、1080p
+	Source        string `json:"source"`         // 来源
+	Studio        string `json:"studio"`         // 媒体
+	IsCollection  bool   `json:"is_collection"`  // 是否是合集目录
+	PartMode      int    `json:"part_mode"`      // 分卷模式: 0不使用分卷, 1-自动, 2以上为手动指定分卷数量
+	Language      string `json:"language"`       // override.json 指定的语言，为空时使用配置的语言
+	EpisodeOffset int    `json:"episode_offset"` // override.json 指定的集数偏移
 }
 
-// ReadTvId 从文件读取tvId
-func (d *Dir) ReadTvId() {
-	idFile := filepath.Join(d.GetCacheDir(), "id.txt")
-	if _, err := os.Stat(idFile); err == nil {
-		bytes, err := os.ReadFile(idFile)
-		if err == nil {
-			d.TvId, _ = strconv.Atoi(strings.Trim(string(bytes), "\r\n "))
-		} else {
-			utils.Logger.WarningF("read tv id specially file: %s err: %v", idFile, err)
-		}
-	}
-}
-
-// CacheTvId 缓存tvId到文件
-func (d *Dir) CacheTvId() {
-	idFile := filepath.Join(d.GetCacheDir(), "id.txt")
-	err := os.WriteFile(idFile, []byte(strconv.Itoa(d.TvId)), 0664)
-	if err != nil {
-		utils.Logger.ErrorF("save tvId %d to %s err: %v", d.TvId, idFile, err)
+// ReadExternalId 从目录名、id文件或NFO内容中提取IMDb、TVDB id，已经有的不覆盖
+func (d *Dir) ReadExternalId(content string) {
+	if d.ImdbId == "" {
+		d.ImdbId = utils.MatchImdbId(content)
 	}
-}
-
-// ReadSeason 从文件读取季
-func (d *Dir) ReadSeason() {
-	seasonFile := filepath.Join(d.GetCacheDir(), "season.txt")
-	if _, err := os.Stat(seasonFile); err == nil {
-		bytes, err := os.ReadFile(seasonFile)
-		if err == nil {
-			d.Season, _ = strconv.Atoi(strings.Trim(string(bytes), "\r\n "))
-		} else {
-			utils.Logger.WarningF("read season specially file: %s err: %v", seasonFile, err)
-		}
-	}
-
-	if d.Season == 0 && len(d.YearRange) == 0 {
-		d.Season = 1
+	if d.TvdbId == "" {
+		d.TvdbId = utils.MatchTvdbId(content)
 	}
 }
 
-// ReadGroupId 从文件读取剧集分组
-func (d *Dir) ReadGroupId() {
-	groupFile := filepath.Join(d.GetCacheDir(), "group.txt")
-	if _, err := os.Stat(groupFile); err == nil {
-		bytes, err := os.ReadFile(groupFile)
-		if err == nil {
-			d.GroupId = strings.Trim(string(bytes), "\r\n ")
-		} else {
-			utils.Logger.WarningF("read group id specially file: %s err: %v", groupFile, err)
-		}
-	}
+// GetCacheDir 获取TMDB信息缓存目录, 没有配置统一缓存目录时在每部电视剧的根目录下
+func (d *Dir) GetCacheDir() string {
+	return utils.CacheDir(utils.CacheKindShows, d.GetFullDir(), filepath.Join(d.GetFullDir(), "tmdb"))
 }
 
-// GetCacheDir 获取TMDB信息缓存目录, 通常是在每部电视剧的根目录下
-func (d *Dir) GetCacheDir() string {
-	return filepath.Join(d.GetFullDir(), "tmdb")
+// GetExpireMarker 手动标记缓存过期的文件，对剧集、分集和剧集组缓存都有效
+func (d *Dir) GetExpireMarker() string {
+	return filepath.Join(d.GetCacheDir(), "expire")
 }
 
 // GetFullDir 获取电视剧的完整目录
@@ -135,7 +103,7 @@ func (d *Dir) NfoExist() bool {
 func (d *Dir) checkCacheDir() {
 	dir := d.GetCacheDir()
 	if _, err := os.Stat(dir); err != nil && os.IsNotExist(err) {
-		err := os.Mkdir(dir, 0755)
+		err := utils.MkdirAll(dir, 0755)
 		if err != nil {
 			utils.Logger.ErrorF("create cache: %s dir err: %v", dir, err)
 		}
@@ -191,19 +159,6 @@ func (d *Dir) downloadSeasonPosterImage(detail *tmdb.TvDetail) {
 	}
 }
 
-// ReadPart 读取分卷模式
-func (d *Dir) ReadPart() {
-	partFile := filepath.Join(d.GetCacheDir(), "part.txt")
-	if _, err := os.Stat(partFile); err == nil {
-		bytes, err := os.ReadFile(partFile)
-		if err == nil {
-			d.PartMode, _ = strconv.Atoi(strings.Trim(string(bytes), "\r\n "))
-		} else {
-			utils.Logger.WarningF("read part specially file: %s err: %v", partFile, err)
-		}
-	}
-}
-
 // 刮削完成后 将剧集移动到正式文件夹
 func (d *Dir) MoveToStorage(showsStorageDir string, tmdbShowName string, seasonCount int) error {
 	// 剧集文件夹
@@ -212,7 +167,7 @@ func (d *Dir) MoveToStorage(showsStorageDir string, tmdbShowName string, seasonC
 	seasonDir := filepath.Join(showDir, fmt.Sprintf("S%02d", seasonCount))
 	_, err := os.Stat(showDir)
 	if err != nil && os.IsNotExist(err) {
-		os.MkdirAll(showDir, 0755)
+		_ = utils.MkdirAll(showDir, 0755)
 	} else if err == nil {
 		//遍历剧集目录 找到跟seasonCount相同的季度目录 删除
 		dirEntry, err := os.ReadDir(showDir)
@@ -233,7 +188,7 @@ func (d *Dir) MoveToStorage(showsStorageDir string, tmdbShowName string, seasonC
 				s := season[1:]
 				i, err := strconv.Atoi(s)
 				if err == nil && i == seasonCount {
-					err = os.RemoveAll(filepath.Join(showDir, entry.Name()))
+					err = utils.RemoveAll(filepath.Join(showDir, entry.Name()))
 					if err != nil {
 						return err
 					}
@@ -244,8 +199,9 @@ func (d *Dir) MoveToStorage(showsStorageDir string, tmdbShowName string, seasonC
 
 	}
 	// 如果剧集tmdb文件夹不存在则 创建tmdb文件夹
-	if _, err := os.Stat(filepath.Join(showDir, "tmdb")); err != nil && os.IsNotExist(err) {
-		err = os.MkdirAll(filepath.Join(showDir, "tmdb"), 0755)
+	showCacheDir := utils.CacheDir(utils.CacheKindShows, showDir, filepath.Join(showDir, "tmdb"))
+	if _, err := os.Stat(showCacheDir); err != nil && os.IsNotExist(err) {
+		err = utils.MkdirAll(showCacheDir, 0755)
 		if err != nil {
 			return err
 		}
@@ -260,21 +216,23 @@ func moveSingleSeason(fromSeason string, showDir string, toSeason string, season
 	// Step 1: 整理字幕文件
 	_ = processSubtitles(fromSeason)
 	// Step 2: 移动剧集元信息文件
-	showMetaFiles := []string{
-		"tvshow.nfo", "poster.jpg", "fanart.jpg", "clearlogo.png",
-		fmt.Sprintf("season%02d-poster.jpg", seasonCount),
-		filepath.Join("tmdb", "id.txt"),
-		filepath.Join("tmdb", "tv.json"),
+	showMetaFiles := [][2]string{}
+	for _, item := range []string{"tvshow.nfo", "poster.jpg", "fanart.jpg", "clearlogo.png", fmt.Sprintf("season%02d-poster.jpg", seasonCount)} {
+		showMetaFiles = append(showMetaFiles, [2]string{filepath.Join(fromSeason, item), filepath.Join(showDir, item)})
+	}
+	fromCacheDir := utils.CacheDir(utils.CacheKindShows, fromSeason, filepath.Join(fromSeason, "tmdb"))
+	showCacheDir := utils.CacheDir(utils.CacheKindShows, showDir, filepath.Join(showDir, "tmdb"))
+	for _, item := range []string{"id.txt", "override.json", "tv.json"} {
+		showMetaFiles = append(showMetaFiles, [2]string{filepath.Join(fromCacheDir, item), filepath.Join(showCacheDir, item)})
 	}
 
 	for _, item := range showMetaFiles {
-		sourceFile := filepath.Join(fromSeason, item)
-		targetFile := filepath.Join(showDir, item)
+		sourceFile, targetFile := item[0], item[1]
 
 		// 如果目标文件已存在，删除源文件
 		if _, targetErr := os.Stat(targetFile); targetErr == nil {
 			if _, sourceErr := os.Stat(sourceFile); sourceErr == nil {
-				if err := os.Remove(sourceFile); err != nil {
+				if err := utils.Remove(sourceFile); err != nil {
 					fmt.Printf("failed to remove source file %s: %v\n", sourceFile, err)
 				}
 			}
@@ -282,14 +240,16 @@ func moveSingleSeason(fromSeason string, showDir string, toSeason string, season
 		}
 
 		// 移动文件到目标位置
-		err := os.Rename(sourceFile, targetFile)
+		err := utils.Rename(sourceFile, targetFile)
 		if err != nil && !os.IsNotExist(err) {
 			fmt.Printf("failed to move file %s to %s: %v\n", sourceFile, targetFile, err)
 		}
 	}
 
-	// Step 3: 迁移整个季度文件夹
-	_ = os.Rename(fromSeason, toSeason)
+	// Step 3: 迁移整个季度文件夹，统一缓存目录中分集的缓存跟着移动
+	_ = utils.Rename(fromSeason, toSeason)
+	_ = utils.MoveCacheDir(utils.CacheKindShows, fromSeason, toSeason)
+	library.Index.Move(fromSeason, toSeason)
 	return nil
 }
 
@@ -349,7 +309,7 @@ func processSubtitles(fromSeason string) error {
 		}
 		// 如果是字幕文件夹，则在处理完后删除该文件夹
 		if dir != fromSeason {
-			_ = os.Remove(dir)
+			_ = utils.Remove(dir)
 		}
 	}
 
@@ -443,7 +403,7 @@ func renameAndMoveSubtitle(fileName, fromDir, newFileName string, isFromSeason b
 	} else {
 		newPath = filepath.Join(filepath.Dir(fromDir), newFileName)
 	}
-	err := os.Rename(oldPath, newPath)
+	err := utils.Rename(oldPath, newPath)
 	if err != nil {
 		return fmt.Errorf("failed to rename and move file from %s to %s: %w", oldPath, newPath, err)
 	}
@@ -1,7 +1,9 @@
 package shows
 
 import (
+	"fengqi/kodi-metadata-tmdb-cli/ffmpeg"
 	"fengqi/kodi-metadata-tmdb-cli/tmdb"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,7 +19,9 @@ type File struct {
 	SeasonEpisode string `json:"season_episode"`
 	Suffix        string `json:"suffix"`
 	TvId          int    `json:"tv_id"`
-	Part          int    `json:"part"` // 分卷模式下，第几部分
+	Part          int    `json:"part"`     // 分卷模式下，第几部分
+	Language      string `json:"language"` // 所在目录 override.json 指定的语言
+	GroupId       string `json:"group_id"` // 所在目录使用的剧集组，季集编号和TMDB的不同
 	//TvDetail      *tmdb.TvDetail `json:"tv_detail"`
 }
 
@@ -40,7 +44,36 @@ func (f *File) getTitleWithoutSuffix() string {
 }
 
 func (f *File) getCacheDir() string {
-	return filepath.Join(f.Dir, "tmdb")
+	return utils.CacheDir(utils.CacheKindShows, f.Dir, filepath.Join(f.Dir, "tmdb"))
+}
+
+// 读取视频文件的音视频信息，没有开启或读取失败时返回nil
+func (f *File) getProbe() *ffmpeg.ProbeData {
+	if !collector.config.Ffmpeg.StreamDetails {
+		return nil
+	}
+
+	file := filepath.Join(f.Dir, f.OriginTitle)
+	probe, err := ffmpeg.ProbeCache(file, f.getProbeCacheFile())
+	if err != nil {
+		utils.Logger.WarningF("probe episode: %s err: %v", file, err)
+		return nil
+	}
+
+	return probe
+}
+
+// 开启了 stream_details 并且视频文件还没有读取过或者已经被替换，NFO中的音视频信息需要更新
+func (f *File) probeStale() bool {
+	if !collector.config.Ffmpeg.StreamDetails {
+		return false
+	}
+
+	return ffmpeg.ProbeStale(filepath.Join(f.Dir, f.OriginTitle), f.getProbeCacheFile())
+}
+
+func (f *File) getProbeCacheFile() string {
+	return filepath.Join(f.getCacheDir(), f.OriginTitle+".probe.json")
 }
 
 // 下载剧集的相关图片
@@ -0,0 +1,91 @@
+package shows
+
+import (
+	"context"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+	"path/filepath"
+)
+
+// Identify 解析单个电视剧目录，用于手动识别
+func Identify(config *config.Config, path string) (*Dir, error) {
+	collector = &Collector{
+		ctx:    context.Background(),
+		config: config,
+	}
+
+	showDirs, err := collector.scanPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(showDirs) != 1 {
+		return nil, fmt.Errorf("path: %s contains %d shows, identify one at a time", path, len(showDirs))
+	}
+
+	return showDirs[0], nil
+}
+
+// SetTvId 手动指定剧集id，以及可选的季和剧集分组，写入 override.json 并删除旧的缓存、NFO和图片，下次处理时重新刮削
+func (d *Dir) SetTvId(id, season int, groupId string) error {
+	d.checkCacheDir()
+	overrideFile := d.GetOverrideFile()
+	override := utils.LoadOverride(overrideFile, d.getLegacyOverride())
+	if override == nil {
+		override = &utils.Override{}
+	}
+	override.Id = id
+	if season > 0 {
+		override.Season = season
+	}
+	if groupId != "" {
+		override.GroupId = groupId
+	}
+	if err := utils.SaveOverride(overrideFile, override); err != nil {
+		return fmt.Errorf("save tvId %d to %s err: %w", id, overrideFile, err)
+	}
+	d.TvId, d.GroupId = id, override.GroupId
+	if season > 0 {
+		d.Season = season
+	}
+
+	// 剧集、整季和剧集分组的缓存，item.json 和 *.probe.json 和识别结果无关，需要保留
+	stale := []string{
+		filepath.Join(d.GetCacheDir(), "tv.json"),
+		filepath.Join(d.GetCacheDir(), "group.json"),
+	}
+	seasonCaches, _ := filepath.Glob(filepath.Join(d.GetCacheDir(), "season[0-9]*.json"))
+	stale = append(stale, seasonCaches...)
+	stale = append(stale,
+		d.GetNfoFile(),
+		filepath.Join(d.GetFullDir(), "poster.jpg"),
+		filepath.Join(d.GetFullDir(), "fanart.jpg"),
+		filepath.Join(d.GetFullDir(), "clearlogo.png"),
+	)
+	seasonPosters, _ := filepath.Glob(filepath.Join(d.GetFullDir(), "season*-poster.jpg"))
+	stale = append(stale, seasonPosters...)
+
+	// 分集的缓存、NFO和缩略图
+	showFiles, err := collector.scanShowsFile(d)
+	if err != nil {
+		return err
+	}
+	for _, file := range showFiles {
+		stale = append(stale,
+			filepath.Join(file.getCacheDir(), file.SeasonEpisode+".json"),
+			file.getNfoFile(),
+			filepath.Join(file.Dir, file.getTitleWithoutSuffix()+"-thumb.jpg"),
+		)
+	}
+
+	for _, file := range stale {
+		if !utils.FileExist(file) {
+			continue
+		}
+		if err := utils.Remove(file); err != nil {
+			return fmt.Errorf("remove stale file: %s err: %w", file, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package shows
+
+import (
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/tmdb"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"path/filepath"
+	"strings"
+)
+
+// 把剧集目录的处理结果写入条目索引，detail 为空时只记录失败
+func (d *Dir) updateIndex(detail *tmdb.TvDetail, scraped bool, err error) {
+	item := &library.Item{
+		Path:   d.GetFullDir(),
+		Kind:   library.KindShow,
+		Title:  d.Title,
+		Year:   d.Year,
+		Season: d.Season,
+	}
+	if d.IsCollection {
+		item.Season = 0
+	}
+
+	if detail != nil {
+		item.Title, item.TmdbId = detail.Name, detail.Id
+		if year := utils.IsYear(strings.SplitN(detail.FirstAirDate, "-", 2)[0]); year > 0 {
+			item.Year = year
+		}
+		item.NfoFile = library.ExistingNfo(d.GetNfoFile())
+		item.Artwork = library.ExistingArtwork(map[string]string{
+			library.ArtworkPoster:    filepath.Join(d.GetFullDir(), "poster.jpg"),
+			library.ArtworkFanart:    filepath.Join(d.GetFullDir(), "fanart.jpg"),
+			library.ArtworkClearlogo: filepath.Join(d.GetFullDir(), "clearlogo.png"),
+		})
+	}
+
+	library.Index.Update(item, scraped, err)
+}
+
+// 把分集的处理结果写入条目索引，detail 为空时只记录失败
+func (f *File) updateIndex(show string, detail *tmdb.TvEpisodeDetail, scraped bool, err error) {
+	item := &library.Item{
+		Path:    filepath.Join(f.Dir, f.OriginTitle),
+		Kind:    library.KindEpisode,
+		Title:   f.SeasonEpisode,
+		TmdbId:  f.TvId,
+		Show:    show,
+		Season:  f.Season,
+		Episode: f.Episode,
+	}
+
+	if detail != nil {
+		item.Title = detail.Name
+		item.Season, item.Episode = detail.SeasonNumber, detail.EpisodeNumber
+		item.NfoFile = library.ExistingNfo(f.getNfoFile())
+		item.Artwork = library.ExistingArtwork(map[string]string{
+			library.ArtworkThumb: filepath.Join(f.Dir, f.getTitleWithoutSuffix()+"-thumb.jpg"),
+		})
+	}
+
+	library.Index.Update(item, scraped, err)
+}
@@ -1,6 +1,7 @@
 package shows
 
 import (
+	"encoding/json"
 	"fengqi/kodi-metadata-tmdb-cli/tmdb"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"strconv"
@@ -10,6 +11,10 @@ import (
 func (d *Dir) saveToNfo(detail *tmdb.TvDetail) error {
 	utils.Logger.InfoF("save tvshow.nfo to: %s", d.GetNfoFile())
 
+	if collector.config.Collector.ExistingNfo == utils.NfoBackup {
+		utils.BackupNfo(d.GetNfoFile(), detail.Id)
+	}
+
 	genre := make([]string, 0)
 	for _, item := range detail.Genres {
 		genre = append(genre, item.Name)
@@ -86,24 +91,21 @@ func (d *Dir) saveToNfo(detail *tmdb.TvDetail) error {
 		ShowTitle:     detail.Name,
 		SortTitle:     detail.Name,
 		Plot:          detail.Overview,
-		UniqueId: UniqueId{
-			Type:    "tmdb",
-			Default: true,
-			Value:   strconv.Itoa(detail.Id),
-		},
-		Id:          detail.Id,
-		Premiered:   detail.FirstAirDate,
-		Ratings:     Ratings{Rating: rating},
-		MPaa:        mpaa,
-		Status:      detail.Status,
-		Genre:       genre,
-		Studio:      studio,
-		Season:      d.Season,
-		Episode:     episodeCount,
-		UserRating:  detail.VoteAverage,
-		Actor:       actor,
-		NamedSeason: namedSeason,
-		FanArt:      fanArt,
+		UniqueId:      uniqueIds(detail.Id, detail.ExternalIds),
+		EpisodeGuide:  episodeGuide(detail.Id, detail.ExternalIds),
+		Id:            detail.Id,
+		Premiered:     detail.FirstAirDate,
+		Ratings:       Ratings{Rating: rating},
+		MPaa:          mpaa,
+		Status:        detail.Status,
+		Genre:         genre,
+		Studio:        studio,
+		Season:        d.Season,
+		Episode:       episodeCount,
+		UserRating:    detail.VoteAverage,
+		Actor:         actor,
+		NamedSeason:   namedSeason,
+		FanArt:        fanArt,
 	}
 
 	// 使用分组信息
@@ -148,15 +150,19 @@ func (f *File) saveToNfo(episode *tmdb.TvEpisodeDetail) error {
 		Votes: episode.VoteCount,
 	}
 
+	// 读取到视频文件的实际时长时优先使用
+	runtime := episode.Runtime
+	probe := f.getProbe()
+	if minutes := probe.RuntimeMinutes(); minutes > 0 {
+		runtime = minutes
+	}
+
 	top := &TvEpisodeNfo{
-		Title:         episode.Name,
-		ShowTitle:     episode.Name,
-		OriginalTitle: episode.Name,
-		Plot:          episode.Overview,
-		UniqueId: UniqueId{
-			Type:    strconv.Itoa(episode.Id),
-			Default: true,
-		},
+		Title:          episode.Name,
+		ShowTitle:      episode.Name,
+		OriginalTitle:  episode.Name,
+		Plot:           episode.Overview,
+		UniqueId:       uniqueIds(episode.Id, episode.ExternalIds),
 		Premiered:      episode.AirDate,
 		Season:         episode.SeasonNumber,
 		Episode:        episode.EpisodeNumber,
@@ -164,15 +170,42 @@ func (f *File) saveToNfo(episode *tmdb.TvEpisodeDetail) error {
 		DisplayEpisode: episode.EpisodeNumber,
 		UserRating:     episode.VoteAverage,
 		TmdbId:         "tmdb" + strconv.Itoa(episode.Id),
-		Runtime:        6,
+		Runtime:        runtime,
 		Actor:          actor,
 		Thumb: Thumb{
 			Aspect:  "thumb",
 			Preview: tmdb.Api.GetImageOriginal(episode.StillPath),
 		},
-		Ratings: rating,
-		Aired:   episode.AirDate,
+		Ratings:  rating,
+		Aired:    episode.AirDate,
+		FileInfo: probe.FileInfo(),
 	}
 
 	return utils.SaveNfo(f.getNfoFile(), top)
 }
+
+// tmdb、imdb、tvdb 的id，tmdb 为默认
+func uniqueIds(tmdbId int, ids *tmdb.ExternalIds) []UniqueId {
+	uniqueId := []UniqueId{{Type: "tmdb", Default: true, Value: strconv.Itoa(tmdbId)}}
+	if imdbId := ids.GetImdbId(); imdbId != "" {
+		uniqueId = append(uniqueId, UniqueId{Type: "imdb", Value: imdbId})
+	}
+	if tvdbId := ids.GetTvdbId(); tvdbId > 0 {
+		uniqueId = append(uniqueId, UniqueId{Type: "tvdb", Value: strconv.Itoa(tvdbId)})
+	}
+	return uniqueId
+}
+
+// Kodi v20 起剧集刮削器通过 episodeguide 中的id获取分集：{"imdb":"tt0903747","tmdb":"1396","tvdb":"81189"}
+func episodeGuide(tmdbId int, ids *tmdb.ExternalIds) string {
+	guide := map[string]string{"tmdb": strconv.Itoa(tmdbId)}
+	if imdbId := ids.GetImdbId(); imdbId != "" {
+		guide["imdb"] = imdbId
+	}
+	if tvdbId := ids.GetTvdbId(); tvdbId > 0 {
+		guide["tvdb"] = strconv.Itoa(tvdbId)
+	}
+
+	bytes, _ := json.Marshal(guide)
+	return string(bytes)
+}
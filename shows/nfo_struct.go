@@ -1,6 +1,9 @@
 package shows
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"fengqi/kodi-metadata-tmdb-cli/ffmpeg"
+)
 
 // TvShowNfo tvshow.nfo
 //
@@ -32,9 +35,9 @@ type TvShowNfo struct {
 	MPaa           string        `xml:"mpaa"`
 	PlayCount      int           `xml:"-"`
 	LastPlayed     string        `xml:"-"`
-	EpisodeGuide   EpisodeGuide  `xml:"-"`
+	EpisodeGuide   string        `xml:"episodeguide,omitempty"` // Kodi v20 起为各网站id的json
 	Id             int           `xml:"id"`
-	UniqueId       UniqueId      `xml:"uniqueid"`
+	UniqueId       []UniqueId    `xml:"uniqueid"`
 	Genre          []string      `xml:"genre"`
 	Tag            []string      `xml:"tag"`
 	Premiered      string        `xml:"premiered"`
@@ -64,12 +67,12 @@ type TvEpisodeNfo struct {
 	Outline        string   `xml:"outline"`
 	Plot           string   `xml:"plot"`
 	Tagline        string   `xml:"-"`
-	Runtime        int      `xml:"runtime"`
+	Runtime        int      `xml:"runtime,omitempty"`
 	Thumb          Thumb    `xml:"thumb"`
 
-	UniqueId UniqueId `xml:"uniqueid"`
-	Year     string   `xml:"year"`
-	TmdbId   string   `xml:"tmdbid"`
+	UniqueId []UniqueId `xml:"uniqueid"`
+	Year     string     `xml:"year"`
+	TmdbId   string     `xml:"tmdbid"`
 
 	MPaa      string   `xml:"-"`
 	Premiered string   `xml:"premiered"`
@@ -79,7 +82,7 @@ type TvEpisodeNfo struct {
 	Genre     []string `xml:"genre"`
 	Studio    []string `xml:"studio"`
 
-	FileInfo FileInfo `xml:"fileinfo"`
+	FileInfo *ffmpeg.FileInfo `xml:"fileinfo,omitempty"`
 }
 
 type Ratings struct {
@@ -93,40 +96,6 @@ type Rating struct {
 	Votes int     `xml:"votes"`
 }
 
-type FileInfo struct {
-	StreamDetails StreamDetails `xml:"streamdetails"`
-}
-
-type StreamDetails struct {
-	Video    []Video    `xml:"video"`
-	Audio    []Audio    `xml:"audio"`
-	Subtitle []Subtitle `xml:"subtitle"`
-}
-
-type Video struct {
-	Codec             string `xml:"codec"`
-	Aspect            string `xml:"aspect"`
-	Width             int    `xml:"width"`
-	Height            int    `xml:"height"`
-	DurationInSeconds int    `xml:"durationinseconds"`
-	StereoMode        int    `xml:"stereomode"`
-}
-
-type Audio struct {
-	Codec    string `xml:"codec"`
-	Language string `xml:"language"`
-	Channels int    `xml:"channels"`
-}
-
-type Subtitle struct {
-	Codec    string `xml:"codec"`
-	Micodec  string `xml:"micodec"`
-	Language string `xml:"language"`
-	ScanType string `xml:"scantype"`
-	Default  bool   `xml:"default"`
-	Forced   bool   `xml:"forced"`
-}
-
 type Thumb struct {
 	Aspect  string `xml:"aspect,attr"`
 	Preview string `xml:"preview,attr"`
@@ -135,7 +104,7 @@ type Thumb struct {
 type UniqueId struct {
 	XMLName xml.Name `xml:"uniqueid"`
 	Type    string   `xml:"type,attr"`
-	Default bool     `xml:"default,attr"`
+	Default bool     `xml:"default,attr,omitempty"`
 	Value   string   `xml:",chardata"`
 }
 
@@ -156,14 +125,6 @@ type ShowThumb struct {
 	Preview string `xml:"preview,attr"`
 }
 
-type EpisodeGuide struct {
-	Url Url `xml:"url"`
-}
-
-type Url struct {
-	Cache string `xml:"cache"`
-}
-
 type NamedSeason struct {
 	Number int    `xml:"number,attr"`
 	Value  string `xml:",chardata"`
@@ -0,0 +1,106 @@
+package shows
+
+import (
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"path/filepath"
+)
+
+// ReadOverride 读取 override.json，不存在时兼容读取旧的 id.txt、season.txt、group.txt、part.txt，需要跳过时返回false
+func (d *Dir) ReadOverride() bool {
+	override := utils.LoadOverride(d.GetOverrideFile(), d.getLegacyOverride())
+	if override == nil {
+		override = &utils.Override{}
+	}
+
+	if override.Ignore {
+		utils.Logger.InfoF("ignore show: %s by override", d.OriginTitle)
+		return false
+	}
+	if override.MediaType == utils.MediaMovie {
+		utils.Logger.WarningF("show: %s is movie by override, skip", d.OriginTitle)
+		return false
+	}
+
+	if override.Id > 0 {
+		d.TvId = override.Id
+	}
+	if override.ImdbId != "" {
+		d.ImdbId = override.ImdbId
+	}
+	if override.TvdbId != "" {
+		d.TvdbId = override.TvdbId
+	}
+	if override.Season > 0 {
+		d.Season = override.Season
+	}
+	if d.Season == 0 && len(d.YearRange) == 0 {
+		d.Season = 1
+	}
+	if override.Title != "" {
+		d.Title, d.AliasTitle = override.Title, ""
+		d.ChsTitle, d.EngTitle = utils.SplitChsEngTitle(override.Title)
+	}
+	if override.Year > 0 {
+		d.Year = override.Year
+	}
+	d.GroupId = override.GroupId
+	d.PartMode = override.PartMode
+	d.Language = override.Language
+	if d.Language == "" {
+		d.Language = collector.config.Collector.LibraryLanguage(d.GetFullDir())
+	}
+	d.EpisodeOffset = override.EpisodeOffset
+
+	return true
+}
+
+// GetOverrideFile 手动指定刮削信息的文件
+func (d *Dir) GetOverrideFile() string {
+	return filepath.Join(d.GetCacheDir(), "override.json")
+}
+
+// 旧版本手动指定信息的文本文件
+func (d *Dir) getLegacyOverride() utils.LegacyOverride {
+	return utils.LegacyOverride{
+		IdFiles:    []string{filepath.Join(d.GetCacheDir(), "id.txt")},
+		SeasonFile: filepath.Join(d.GetCacheDir(), "season.txt"),
+		GroupFile:  filepath.Join(d.GetCacheDir(), "group.txt"),
+		PartFile:   filepath.Join(d.GetCacheDir(), "part.txt"),
+	}
+}
+
+// MigrateOverride 把旧的 id.txt、season.txt、group.txt、part.txt 合并成 override.json，paths 为空时处理配置的全部剧集目录
+// 每个目录处理完成后调用 fn，migrated 表示写入了新的 override.json
+func MigrateOverride(config *config.Config, paths []string, fn func(name string, migrated bool, err error)) {
+	collector = &Collector{config: config}
+	if len(paths) == 0 {
+		paths = config.Collector.ShowsDir
+	}
+
+	for _, item := range paths {
+		showDirs, err := collector.scanPath(item)
+		if err != nil {
+			fn(item, false, err)
+			continue
+		}
+
+		for len(showDirs) > 0 {
+			showDir := showDirs[0]
+			showDirs = showDirs[1:]
+
+			migrated, err := utils.MigrateOverride(showDir.GetOverrideFile(), showDir.getLegacyOverride())
+			fn(showDir.GetFullDir(), migrated, err)
+
+			// 合集中的每一季也有自己的文件
+			if showDir.IsCollection {
+				subDirs, err := collector.scanDir(showDir.GetFullDir())
+				if err != nil {
+					fn(showDir.GetFullDir(), false, err)
+					continue
+				}
+				showDirs = append(showDirs, subDirs...)
+			}
+		}
+	}
+}
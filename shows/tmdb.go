@@ -2,10 +2,15 @@ package shows
 
 import (
 	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
 	"fengqi/kodi-metadata-tmdb-cli/tmdb"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,8 +19,6 @@ func (d *Dir) getTvDetail() (*tmdb.TvDetail, error) {
 	var err error
 	var detail = new(tmdb.TvDetail)
 
-	d.ReadTvId()
-
 	// 从缓存读取
 	tvCacheFile := filepath.Join(d.GetCacheDir(), "tv.json")
 	cacheExpire := false
@@ -31,33 +34,52 @@ func (d *Dir) getTvDetail() (*tmdb.TvDetail, error) {
 		err = json.Unmarshal(bytes, detail)
 		if err != nil {
 			utils.Logger.WarningF("parse tv file: %s err: %v", tvCacheFile, err)
-			_ = os.Remove(tvCacheFile)
+			_ = utils.Remove(tvCacheFile)
 			goto search
 		}
 
 		airTime, _ := time.Parse("2006-01-02", detail.LastAirDate)
-		cacheExpire = utils.CacheExpire(cf.ModTime(), airTime)
+		nextAirTime, _ := time.Parse("2006-01-02", detail.NextEpisodeToAir.AirDate)
+		// 手动指定了其他id时缓存也失效
+		cacheExpire = collector.config.Collector.CachePolicy.ShowExpired(cf.ModTime(), airTime, detail.Status, nextAirTime) ||
+			utils.ForceExpired(d.GetExpireMarker(), cf.ModTime()) ||
+			d.TvId > 0 && detail.Id != d.TvId
 		detail.FromCache = true
-		d.TvId = detail.Id
+		if d.TvId == 0 {
+			d.TvId = detail.Id
+		}
 	}
 
 search:
+	metrics.CacheLookup("tv", detail.Id != 0 && !cacheExpire)
+
 	// 缓存失效，重新搜索
 	if detail.Id == 0 || cacheExpire {
 		detail.FromCache = false
 		if d.TvId == 0 {
-			SearchResults, err := tmdb.Api.SearchShows(d.ChsTitle, d.EngTitle, d.Year)
-			if err != nil || SearchResults == nil {
-				utils.Logger.ErrorF("search title: %s year: %d failed", d.Title, d.Year)
-				return detail, err
+			d.TvId = d.readNfoIds()
+		}
+		if d.TvId == 0 {
+			d.TvId = d.findByExternalId()
+			if d.TvId == 0 {
+				SearchResults, err := tmdb.Api.WithLanguage(d.Language).SearchShows(d.ChsTitle, d.EngTitle, d.Year)
+				if err != nil || SearchResults == nil {
+					utils.Logger.ErrorF("search title: %s year: %d failed", d.Title, d.Year)
+					return detail, err
+				}
+
+				d.TvId = SearchResults.Id
 			}
+			// 搜索到的id只保存在详情缓存和 item.json 中，不写入 id.txt，避免和手动指定的id混淆
+		}
 
-			d.TvId = SearchResults.Id
-			d.CacheTvId()
+		// 改名后重新识别到的条目，使用原来的缓存
+		if detail.Id == 0 && utils.RelinkCacheDir(utils.CacheKindShows, d.GetFullDir(), d.TvId, collector.libraryRoots()) {
+			return d.getTvDetail()
 		}
 
 		// 获取详情
-		detail, err = tmdb.Api.GetTvDetail(d.TvId)
+		detail, err = tmdb.Api.WithLanguage(d.Language).GetTvDetail(d.TvId)
 		if err != nil || detail == nil || detail.Id == 0 || detail.Name == "" {
 			utils.Logger.ErrorF("get tv: %d detail err: %v", d.TvId, err)
 			return nil, err
@@ -65,6 +87,7 @@ search:
 
 		// 保存到缓存
 		detail.SaveToCache(tvCacheFile)
+		utils.SaveCacheItem(utils.CacheKindShows, d.GetFullDir(), detail.Id)
 	}
 
 	// 剧集分组：不同的季版本
@@ -78,7 +101,122 @@ search:
 	return detail, nil
 }
 
-func (f *File) getTvEpisodeDetail() (*tmdb.TvEpisodeDetail, error) {
+// 获取整季的详情，一季只请求和缓存一次，失败时返回nil，由分集单独请求
+func (d *Dir) getTvSeasonDetail(season int) *tmdb.TvSeasonDetail {
+	var detail = new(tmdb.TvSeasonDetail)
+
+	cacheFile := d.getSeasonCacheFile(season)
+	cacheExpire := false
+	if cf, err := os.Stat(cacheFile); err == nil {
+		utils.Logger.DebugF("get season from cache: %s", cacheFile)
+
+		bytes, err := os.ReadFile(cacheFile)
+		if err != nil {
+			utils.Logger.WarningF("read season cache: %s err: %v", cacheFile, err)
+		}
+
+		err = json.Unmarshal(bytes, detail)
+		if err != nil {
+			utils.Logger.WarningF("parse season cache: %s err: %v", cacheFile, err)
+		}
+
+		airTime, _ := time.Parse("2006-01-02", detail.LastAirDate())
+		cacheExpire = collector.config.Collector.CachePolicy.Expired(config.CacheEpisodes, cf.ModTime(), airTime) ||
+			utils.ForceExpired(d.GetExpireMarker(), cf.ModTime())
+		detail.FromCache = true
+	}
+
+	metrics.CacheLookup("season", detail.Id != 0 && !cacheExpire)
+
+	// 请求tmdb
+	if detail.Id == 0 || cacheExpire {
+		seasonDetail, err := tmdb.Api.WithLanguage(d.Language).GetTvSeasonDetail(d.TvId, season)
+		if err != nil || seasonDetail == nil {
+			utils.Logger.WarningF("get season from tmdb: %d season: %d failed: %v", d.TvId, season, err)
+			return nil
+		}
+
+		seasonDetail.KeepEpisodeExternalIds(detail)
+		detail = seasonDetail
+		detail.SaveToCache(cacheFile)
+	}
+
+	return detail
+}
+
+// 整季详情的缓存文件
+func (d *Dir) getSeasonCacheFile(season int) string {
+	return filepath.Join(d.GetCacheDir(), fmt.Sprintf("season%02d.json", season))
+}
+
+// 旧的缓存中没有外部id，写入NFO前单独获取并更新缓存
+func (d *Dir) fillExternalIds(detail *tmdb.TvDetail) {
+	if detail.ExternalIds != nil {
+		return
+	}
+
+	ids, err := tmdb.Api.GetTvExternalIds(detail.Id)
+	if err != nil {
+		utils.Logger.WarningF("get tv: %d external ids err: %v", detail.Id, err)
+		return
+	}
+
+	detail.ExternalIds = ids
+	detail.SaveToCache(filepath.Join(d.GetCacheDir(), "tv.json"))
+}
+
+// 整季的详情中没有分集的外部id：已有的NFO是之前写入的时直接使用其中的id，
+// 没有NFO并且开启了 episode_external_ids 时才单独请求，保存到整季或单集的缓存
+func (f *File) fillExternalIds(detail *tmdb.TvEpisodeDetail, season *tmdb.TvSeasonDetail) {
+	if detail.ExternalIds != nil || f.GroupId != "" {
+		return
+	}
+
+	ids := f.readNfoExternalIds(detail.Id)
+	if ids == nil {
+		if f.NfoExist() || !collector.config.Collector.EpisodeExternalIds {
+			return
+		}
+
+		var err error
+		ids, err = tmdb.Api.GetTvEpisodeExternalIds(f.TvId, detail.SeasonNumber, detail.EpisodeNumber)
+		if err != nil {
+			utils.Logger.WarningF("get episode: %d %s external ids err: %v", f.TvId, f.SeasonEpisode, err)
+			return
+		}
+	}
+
+	detail.ExternalIds = ids
+	if season.GetEpisode(f.Episode) != nil {
+		season.SetEpisodeExternalIds(f.Episode, ids)
+		return
+	}
+	detail.SaveToCache(filepath.Join(f.getCacheDir(), f.SeasonEpisode+".json"))
+}
+
+// 从之前为这一集写入的NFO中读取imdb、tvdb id，不是这一集的NFO或者没有时返回nil
+func (f *File) readNfoExternalIds(episodeId int) *tmdb.ExternalIds {
+	bytes, err := os.ReadFile(f.getNfoFile())
+	if err != nil {
+		return nil
+	}
+
+	nfoIds := utils.ParseNfoIds(bytes)
+	if nfoIds.Tmdb != episodeId || nfoIds.Imdb == "" && nfoIds.Tvdb == "" {
+		return nil
+	}
+
+	ids := &tmdb.ExternalIds{ImdbId: nfoIds.Imdb}
+	ids.TvdbId, _ = strconv.Atoi(nfoIds.Tvdb)
+	return ids
+}
+
+// 获取单集详情，整季的详情中有这一集时直接使用，没有时再单独请求
+func (f *File) getTvEpisodeDetail(season *tmdb.TvSeasonDetail) (*tmdb.TvEpisodeDetail, error) {
+	if episode := season.GetEpisode(f.Episode); episode != nil {
+		return episode, nil
+	}
+
 	var err error
 	var detail = new(tmdb.TvEpisodeDetail)
 
@@ -98,14 +236,17 @@ func (f *File) getTvEpisodeDetail() (*tmdb.TvEpisodeDetail, error) {
 		}
 
 		airTime, _ := time.Parse("2006-01-02", detail.AirDate)
-		cacheExpire = utils.CacheExpire(cf.ModTime(), airTime)
+		cacheExpire = collector.config.Collector.CachePolicy.Expired(config.CacheEpisodes, cf.ModTime(), airTime) ||
+			utils.ForceExpired(filepath.Join(f.getCacheDir(), "expire"), cf.ModTime())
 		detail.FromCache = true
 	}
 
+	metrics.CacheLookup("episode", detail != nil && detail.Id != 0 && !cacheExpire)
+
 	// 请求tmdb
 	if detail == nil || detail.Id == 0 || cacheExpire {
 		detail.FromCache = false
-		detail, err = tmdb.Api.GetTvEpisodeDetail(f.TvId, f.Season, f.Episode)
+		detail, err = tmdb.Api.WithLanguage(f.Language).GetTvEpisodeDetail(f.TvId, f.Season, f.Episode)
 		if err != nil {
 			utils.Logger.ErrorF("get tv episode error %v", err)
 			return nil, err
@@ -152,14 +293,15 @@ func (d *Dir) getTvEpisodeGroupDetail() (*tmdb.TvEpisodeGroupDetail, error) {
 		}
 
 		airTime, _ := time.Parse("2006-01-02", detail.Groups[len(detail.Groups)-1].Episodes[0].AirDate)
-		cacheExpire = utils.CacheExpire(cf.ModTime(), airTime)
+		cacheExpire = collector.config.Collector.CachePolicy.Expired(config.CacheEpisodeGroups, cf.ModTime(), airTime) ||
+			utils.ForceExpired(d.GetExpireMarker(), cf.ModTime())
 		detail.FromCache = true
 	}
 
 	// 缓存失效，重新搜索
 	if detail.Id == "" || cacheExpire {
 		detail.FromCache = false
-		detail, err = tmdb.Api.GetTvEpisodeGroupDetail(d.GroupId)
+		detail, err = tmdb.Api.WithLanguage(d.Language).GetTvEpisodeGroupDetail(d.GroupId)
 		if err != nil {
 			utils.Logger.ErrorF("get tv episode group: %s detail err: %v", d.GroupId, err)
 			return nil, err
@@ -171,3 +313,70 @@ func (d *Dir) getTvEpisodeGroupDetail() (*tmdb.TvEpisodeGroupDetail, error) {
 
 	return detail, nil
 }
+
+// 从剧集目录已有的NFO中读取id，有TMDB剧集id时直接返回，IMDb、TVDB id留给 findByExternalId 使用
+func (d *Dir) readNfoIds() int {
+	entries, err := os.ReadDir(d.GetFullDir())
+	if err != nil {
+		return 0
+	}
+
+	// 和视频同名的是单集的NFO，里面是单集的id
+	videos := make(map[string]struct{}, 0)
+	for _, entry := range entries {
+		if suffix := utils.IsVideo(entry.Name()); suffix != "" {
+			videos[strings.TrimSuffix(entry.Name(), "."+suffix)] = struct{}{}
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.ToLower(filepath.Ext(entry.Name())) != ".nfo" {
+			continue
+		}
+		if _, ok := videos[strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))]; ok {
+			continue
+		}
+
+		nfo := filepath.Join(d.GetFullDir(), entry.Name())
+		bytes, err := os.ReadFile(nfo)
+		if err != nil {
+			continue
+		}
+
+		ids := utils.ParseNfoIds(bytes)
+		utils.Logger.DebugF("read ids from nfo: %s %+v", nfo, ids)
+		if d.ImdbId == "" {
+			d.ImdbId = ids.Imdb
+		}
+		if d.TvdbId == "" {
+			d.TvdbId = ids.Tvdb
+		}
+		if ids.Tmdb > 0 && ids.TmdbType != "movie" {
+			utils.Logger.InfoF("use tmdb id: %d from nfo: %s", ids.Tmdb, nfo)
+			return ids.Tmdb
+		}
+	}
+
+	return 0
+}
+
+// 目录名、id文件或已有的NFO中有IMDb、TVDB id时直接通过id查找，找不到返回0再按标题搜索
+func (d *Dir) findByExternalId() int {
+	externalIds := [][2]string{{d.TvdbId, tmdb.ExternalTvdb}, {d.ImdbId, tmdb.ExternalImdb}}
+	for _, item := range externalIds {
+		if item[0] == "" {
+			continue
+		}
+
+		resp, err := tmdb.Api.WithLanguage(d.Language).FindByExternalId(item[0], item[1])
+		if err != nil || len(resp.TvResults) == 0 {
+			utils.Logger.WarningF("find tv by %s: %s failed, err: %v", item[1], item[0], err)
+			continue
+		}
+
+		utils.Logger.InfoF("find tv by %s: %s, use: %d %s", item[1], item[0], resp.TvResults[0].Id, resp.TvResults[0].Name)
+		return resp.TvResults[0].Id
+	}
+
+	return 0
+}
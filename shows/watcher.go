@@ -1,6 +1,8 @@
 package shows
 
 import (
+	"fengqi/kodi-metadata-tmdb-cli/library"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
 	"os"
 	"path/filepath"
@@ -30,10 +32,20 @@ func (c *Collector) runWatcher() {
 
 	for {
 		select {
+		case <-c.ctx.Done():
+			return
+
 		case event, ok := <-watcher.Events:
 			if !ok {
-				continue
+				return
 			}
+			metrics.WatcherEvent("shows", event)
+
+			// 删除或移走的条目从索引中删除
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				library.Index.Remove(event.Name)
+			}
+
 			fileInfo, err := os.Stat(event.Name)
 			if fileInfo == nil || err != nil {
 				utils.Logger.WarningF("get shows stat err: %v", err)
@@ -63,7 +75,7 @@ func (c *Collector) runWatcher() {
 
 				showsDir := c.parseShowsDir(filepath.Dir(event.Name), fileInfo)
 				if showsDir != nil {
-					c.dirChan <- showsDir
+					c.dispatch(showsDir)
 				}
 
 				c.watchDir(event.Name)
@@ -78,7 +90,7 @@ func (c *Collector) runWatcher() {
 				dirInfo, _ := os.Stat(filePath)
 				dir := c.parseShowsDir(filepath.Dir(filePath), dirInfo)
 				if dir != nil {
-					c.dirChan <- dir
+					c.dispatch(dir)
 				}
 			}
 
@@ -95,7 +107,7 @@ func (c *Collector) runWatcher() {
 // 监听目录
 // todo 判断是否是目录
 func (c *Collector) watchDir(name string) {
-	if !c.config.Collector.Watcher {
+	if !c.config.Collector.Watcher || watcher == nil {
 		return
 	}
 
@@ -0,0 +1,85 @@
+package tmdb
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+)
+
+// 排在前面的几个搜索结果获取别名和翻译后重新计算匹配度
+const alternativeCandidates = 3
+
+// 匹配度达到这个值时认为标题已经一致，不再获取别名
+const alternativeSkipConfidence = 0.9
+
+// AlternativeTitlesResponse 别名，电影在 titles 中，电视剧在 results 中
+type AlternativeTitlesResponse struct {
+	Id      int                 `json:"id"`
+	Titles  []*AlternativeTitle `json:"titles"`
+	Results []*AlternativeTitle `json:"results"`
+}
+
+type AlternativeTitle struct {
+	Iso31661 string `json:"iso_3166_1"`
+	Title    string `json:"title"`
+	Type     string `json:"type"`
+}
+
+// TranslationsResponse 各语言的翻译
+type TranslationsResponse struct {
+	Id           int            `json:"id"`
+	Translations []*Translation `json:"translations"`
+}
+
+type Translation struct {
+	Iso31661    string          `json:"iso_3166_1"`
+	Iso6391     string          `json:"iso_639_1"`
+	Name        string          `json:"name"`
+	EnglishName string          `json:"english_name"`
+	Data        TranslationData `json:"data"`
+}
+
+// TranslationData 电影使用 title，电视剧使用 name
+type TranslationData struct {
+	Title    string `json:"title"`
+	Name     string `json:"name"`
+	Overview string `json:"overview"`
+	Tagline  string `json:"tagline"`
+}
+
+// GetAlternativeTitles 获取别名和各语言翻译的标题，用于匹配港台译名、罗马音等，请求失败时返回已经获取到的部分
+func (t *tmdb) GetAlternativeTitles(titlesApi, translationsApi string, id int) []string {
+	utils.Logger.DebugF("get alternative titles from tmdb: %d", id)
+
+	titles := make([]string, 0)
+	seen := make(map[string]struct{}, 0)
+	add := func(title string) {
+		if _, ok := seen[title]; title != "" && !ok {
+			seen[title] = struct{}{}
+			titles = append(titles, title)
+		}
+	}
+
+	if body, err := t.request(fmt.Sprintf(titlesApi, id), nil); err == nil {
+		resp := &AlternativeTitlesResponse{}
+		if err = json.Unmarshal(body, resp); err != nil {
+			utils.Logger.WarningF("parse alternative titles: %d err: %v", id, err)
+		}
+		for _, item := range append(resp.Titles, resp.Results...) {
+			add(item.Title)
+		}
+	}
+
+	if body, err := t.request(fmt.Sprintf(translationsApi, id), nil); err == nil {
+		resp := &TranslationsResponse{}
+		if err = json.Unmarshal(body, resp); err != nil {
+			utils.Logger.WarningF("parse translations: %d err: %v", id, err)
+		}
+		for _, item := range resp.Translations {
+			add(item.Data.Title)
+			add(item.Data.Name)
+		}
+	}
+
+	return titles
+}
@@ -0,0 +1,49 @@
+package tmdb
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSearchMovieAlternativeTitles(t *testing.T) {
+	requests := make([]string, 0)
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case ApiSearchMovie:
+			_, _ = w.Write([]byte(`{"page":1,"results":[
+				{"id":10138,"title":"钢铁侠2","original_title":"Iron Man 2","release_date":"2010-04-28","popularity":61},
+				{"id":1726,"title":"钢铁侠","original_title":"Iron Man","release_date":"2008-04-30","popularity":84}]}`))
+		case "/3/movie/1726/alternative_titles":
+			_, _ = w.Write([]byte(`{"id":1726,"titles":[{"iso_3166_1":"HK","title":"鐵甲奇俠","type":""}]}`))
+		case "/3/movie/1726/translations":
+			_, _ = w.Write([]byte(`{"id":1726,"translations":[{"iso_3166_1":"TW","iso_639_1":"zh","data":{"title":"鋼鐵人"}}]}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	})
+	defer closeFn()
+	api.threshold = defaultMatchThreshold
+
+	for _, title := range []string{"鐵甲奇俠", "鋼鐵人"} {
+		result, err := api.SearchMovie(title, "", 2008)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Id != 1726 {
+			t.Errorf("SearchMovie(%s) want 1726, give %d %s", title, result.Id, result.Title)
+		}
+	}
+
+	// 标题完全一致时不获取别名
+	requests = requests[:0]
+	if _, err := api.SearchMovie("钢铁侠", "", 2008); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range requests {
+		if strings.HasSuffix(path, "alternative_titles") {
+			t.Errorf("exact title should not request alternative titles: %v", requests)
+		}
+	}
+}
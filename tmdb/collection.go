@@ -0,0 +1,55 @@
+package tmdb
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+)
+
+// CollectionDetail 电影合集（系列）详情
+type CollectionDetail struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name"`
+	Overview     string `json:"overview"`
+	PosterPath   string `json:"poster_path"`
+	BackdropPath string `json:"backdrop_path"`
+}
+
+// GetCollectionDetail 获取合集详情，简介为空时按顺序使用回退语言的简介
+func (t *tmdb) GetCollectionDetail(id int) (*CollectionDetail, error) {
+	utils.Logger.DebugF("get collection detail from tmdb: %d", id)
+
+	detail, err := t.getCollectionDetail(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, language := range t.fallback {
+		if detail.Overview != "" {
+			break
+		}
+		if other, err := t.onlyLanguage(language).getCollectionDetail(id); err == nil {
+			detail.Overview = other.Overview
+		}
+	}
+
+	return detail, nil
+}
+
+func (t *tmdb) getCollectionDetail(id int) (*CollectionDetail, error) {
+	api := fmt.Sprintf(ApiCollection, id)
+	body, err := t.request(api, nil)
+	if err != nil {
+		utils.Logger.ErrorF("get collection detail err: %d %v", id, err)
+		return nil, err
+	}
+
+	detail := &CollectionDetail{}
+	err = json.Unmarshal(body, detail)
+	if err != nil {
+		utils.Logger.ErrorF("parse collection detail err: %d %v", id, err)
+		return nil, err
+	}
+
+	return detail, nil
+}
@@ -0,0 +1,47 @@
+package tmdb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")      // 搜索没有结果或者id不存在，重试也不会成功
+	ErrUnauthorized  = errors.New("unauthorized")   // api key 无效
+	ErrRateLimited   = errors.New("rate limited")   // 请求过于频繁
+	ErrLowConfidence = errors.New("low confidence") // 搜索结果匹配度低于阈值，需要人工确认
+)
+
+// ApiError TMDB 返回的错误，可以用 errors.Is 判断是否为上面的几种错误
+type ApiError struct {
+	HttpStatus    int
+	StatusCode    int           // TMDB 错误码
+	StatusMessage string        // TMDB 错误信息
+	RetryAfter    time.Duration // 429 时需要等待的时间
+}
+
+func (e *ApiError) Error() string {
+	if e.StatusMessage == "" {
+		return fmt.Sprintf("tmdb http status %d", e.HttpStatus)
+	}
+	return fmt.Sprintf("tmdb http status %d: %d %s", e.HttpStatus, e.StatusCode, e.StatusMessage)
+}
+
+func (e *ApiError) Unwrap() error {
+	switch e.HttpStatus {
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// 服务端错误和限流可以重试
+func (e *ApiError) retryable() bool {
+	return e.HttpStatus == http.StatusTooManyRequests || e.HttpStatus >= 500
+}
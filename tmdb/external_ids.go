@@ -0,0 +1,59 @@
+package tmdb
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+)
+
+// ExternalIds 电影、剧集、分集在其他网站的id，tvdb_id 没有时为null
+type ExternalIds struct {
+	ImdbId     string `json:"imdb_id"`
+	TvdbId     int    `json:"tvdb_id"`
+	WikidataId string `json:"wikidata_id"`
+}
+
+// GetTvEpisodeExternalIds 获取分集的外部id，整季的详情中没有这个字段
+func (t *tmdb) GetTvEpisodeExternalIds(tvId, season, episode int) (*ExternalIds, error) {
+	return t.getExternalIds(fmt.Sprintf(ApiTvEpisodeExternalIds, tvId, season, episode))
+}
+
+// GetTvExternalIds 获取剧集的外部id，用于没有附带外部id的旧缓存
+func (t *tmdb) GetTvExternalIds(tvId int) (*ExternalIds, error) {
+	return t.getExternalIds(fmt.Sprintf(ApiTvExternalIds, tvId))
+}
+
+func (t *tmdb) getExternalIds(api string) (*ExternalIds, error) {
+	utils.Logger.DebugF("get external ids from tmdb: %s", api)
+
+	body, err := t.request(api, nil)
+	if err != nil {
+		utils.Logger.ErrorF("read tmdb response: %s err: %v", api, err)
+		return nil, err
+	}
+
+	ids := &ExternalIds{}
+	err = json.Unmarshal(body, ids)
+	if err != nil {
+		utils.Logger.ErrorF("parse tmdb response: %s err: %v", api, err)
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// GetImdbId IMDb id，nil 时返回空
+func (e *ExternalIds) GetImdbId() string {
+	if e == nil {
+		return ""
+	}
+	return e.ImdbId
+}
+
+// GetTvdbId TVDB id，nil 或没有时返回0
+func (e *ExternalIds) GetTvdbId() int {
+	if e == nil {
+		return 0
+	}
+	return e.TvdbId
+}
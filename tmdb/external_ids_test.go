@@ -0,0 +1,48 @@
+package tmdb
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetTvEpisodeExternalIds(t *testing.T) {
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/3/tv/1396/season/1/episode/1/external_ids":
+			_, _ = w.Write([]byte(`{"id":62085,"imdb_id":"tt0959621","tvdb_id":349232,"wikidata_id":null}`))
+		case "/3/tv/1396/season/1/episode/2/external_ids":
+			_, _ = w.Write([]byte(`{"id":62086,"imdb_id":"","tvdb_id":null}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer closeFn()
+
+	ids, err := api.GetTvEpisodeExternalIds(1396, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids.GetImdbId() != "tt0959621" || ids.GetTvdbId() != 349232 {
+		t.Errorf("GetTvEpisodeExternalIds want tt0959621 349232, give %+v", ids)
+	}
+
+	ids, err = api.GetTvEpisodeExternalIds(1396, 1, 2)
+	if err != nil || ids.GetImdbId() != "" || ids.GetTvdbId() != 0 {
+		t.Errorf("GetTvEpisodeExternalIds null tvdb_id want empty, give %+v %v", ids, err)
+	}
+
+	if _, err = api.GetTvEpisodeExternalIds(1396, 1, 3); err == nil {
+		t.Errorf("GetTvEpisodeExternalIds not found want error")
+	}
+
+	var empty *ExternalIds
+	if empty.GetImdbId() != "" || empty.GetTvdbId() != 0 {
+		t.Errorf("nil ExternalIds want empty")
+	}
+
+	season := &TvSeasonDetail{Episodes: []TvEpisodeDetail{{Id: 62085, EpisodeNumber: 1}, {Id: 62086, EpisodeNumber: 2}}}
+	season.SetEpisodeExternalIds(2, &ExternalIds{ImdbId: "tt1054724"})
+	if !season.Updated || season.GetEpisode(2).ExternalIds.GetImdbId() != "tt1054724" || season.GetEpisode(1).ExternalIds != nil {
+		t.Errorf("SetEpisodeExternalIds want episode 2 updated, give %+v", season)
+	}
+}
@@ -0,0 +1,49 @@
+package tmdb
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+	"net/url"
+)
+
+// 外部id来源
+const (
+	ExternalImdb = "imdb_id"
+	ExternalTvdb = "tvdb_id"
+)
+
+// FindResponse 通过外部id查找的结果
+type FindResponse struct {
+	MovieResults []*SearchMoviesResults `json:"movie_results"`
+	TvResults    []*SearchResults       `json:"tv_results"`
+}
+
+// FindByExternalId 通过IMDb、TVDB id查找电影或电视剧，source 为 ExternalImdb 或 ExternalTvdb
+func (t *tmdb) FindByExternalId(externalId, source string) (*FindResponse, error) {
+	utils.Logger.InfoF("find %s: %s from tmdb", source, externalId)
+
+	api := fmt.Sprintf(ApiFind, url.PathEscape(externalId))
+	req := map[string]string{
+		"external_source": source,
+	}
+
+	body, err := t.request(api, req)
+	if err != nil {
+		utils.Logger.ErrorF("find %s: %s err: %v", source, externalId, err)
+		return nil, err
+	}
+
+	resp := &FindResponse{}
+	err = json.Unmarshal(body, resp)
+	if err != nil {
+		utils.Logger.ErrorF("parse find %s: %s response err: %v", source, externalId, err)
+		return nil, err
+	}
+
+	if len(resp.MovieResults) == 0 && len(resp.TvResults) == 0 {
+		return nil, fmt.Errorf("find %s %w", externalId, ErrNotFound)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,31 @@
+package tmdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFindByExternalId(t *testing.T) {
+	api := newReplayTmdb()
+
+	resp, err := api.FindByExternalId("tt0371746", ExternalImdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.MovieResults) != 1 || resp.MovieResults[0].Id != 1726 || len(resp.TvResults) != 0 {
+		t.Errorf("FindByExternalId(tt0371746) want movie 1726, give %+v", resp)
+	}
+
+	resp, err = api.FindByExternalId("81189", ExternalTvdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.TvResults) != 1 || resp.TvResults[0].Id != 1396 {
+		t.Errorf("FindByExternalId(81189) want tv 1396, give %+v", resp)
+	}
+
+	_, err = api.FindByExternalId("tt0000000", ExternalImdb)
+	if !errors.Is(err, ErrFixtureMissing) {
+		t.Errorf("FindByExternalId(tt0000000) want fixture missing, give %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package tmdb
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 接口请求录制和回放模式
+const (
+	FixturesRecord = "record" // 请求TMDB并把返回保存到 fixtures 目录
+	FixturesReplay = "replay" // 只从 fixtures 目录读取，不请求TMDB
+)
+
+// ErrFixtureMissing 回放模式下没有找到对应请求的录制
+var ErrFixtureMissing = errors.New("fixture missing")
+
+// 录制的请求和返回
+type fixture struct {
+	Request    string            `json:"request"` // 规范化的请求路径和参数，不包含 api_key
+	StatusCode int               `json:"status_code"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       json.RawMessage   `json:"body"`
+}
+
+// 需要录制的返回头
+var fixtureHeaders = []string{"Content-Type", "Retry-After"}
+
+// fixtureTransport 录制或回放TMDB接口请求，其他地址的请求（比如图片）直接转发
+type fixtureTransport struct {
+	mode string
+	dir  string
+	host string
+	next http.RoundTripper
+}
+
+func newFixtureTransport(mode, dir, apiHost string, next http.RoundTripper) *fixtureTransport {
+	host := apiHost
+	if u, err := url.Parse(apiHost); err == nil {
+		host = u.Host
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &fixtureTransport{
+		mode: mode,
+		dir:  dir,
+		host: host,
+		next: next,
+	}
+}
+
+func (f *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != f.host {
+		return f.next.RoundTrip(req)
+	}
+
+	key := requestKey(req.URL)
+	file := filepath.Join(f.dir, fixtureFile(req.URL.Path, key))
+	if f.mode == FixturesReplay {
+		return f.replay(req, key, file)
+	}
+
+	resp, err := f.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err = f.record(key, file, resp.StatusCode, resp.Header, body); err != nil {
+		utils.Logger.WarningF("record tmdb fixture: %s err: %v", file, err)
+	}
+
+	return resp, nil
+}
+
+func (f *fixtureTransport) replay(req *http.Request, key, file string) (*http.Response, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		utils.Logger.ErrorF("replay tmdb fixture: %s not found: %s", key, file)
+		return nil, fmt.Errorf("%w: %s", ErrFixtureMissing, key)
+	}
+
+	item := &fixture{}
+	if err = json.Unmarshal(content, item); err != nil {
+		return nil, fmt.Errorf("parse fixture: %s err: %v", file, err)
+	}
+
+	header := make(http.Header)
+	for k, v := range item.Header {
+		header.Set(k, v)
+	}
+
+	body := []byte(item.Body)
+	var text string
+	if json.Unmarshal(item.Body, &text) == nil {
+		body = []byte(text)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", item.StatusCode, http.StatusText(item.StatusCode)),
+		StatusCode:    item.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(string(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (f *fixtureTransport) record(key, file string, statusCode int, header http.Header, body []byte) error {
+	item := &fixture{
+		Request:    key,
+		StatusCode: statusCode,
+		Header:     make(map[string]string, 0),
+		Body:       body,
+	}
+	for _, k := range fixtureHeaders {
+		if v := header.Get(k); v != "" {
+			item.Header[k] = v
+		}
+	}
+
+	// 不是json的返回保存为字符串
+	if !json.Valid(body) {
+		item.Body, _ = json.Marshal(string(body))
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(item); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// 录制文件名：路径方便查找，参数的哈希区分同一个接口的不同请求
+func fixtureFile(path, key string) string {
+	sum := sha1.Sum([]byte(key))
+	name := strings.ReplaceAll(strings.Trim(path, "/"), "/", "_")
+	return name + "_" + hex.EncodeToString(sum[:])[:10] + ".json"
+}
@@ -0,0 +1,147 @@
+package tmdb
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 分集没有翻译时TMDB返回的默认标题，比如 第 5 集、Episode 5
+var placeholderName = regexp.MustCompile(`^(第\s*\d+\s*[集話话]|Episode\s+\d+|エピソード\s*\d+|에피소드\s*\d+|\d+\s*화)$`)
+
+// IsPlaceholderName 是否是TMDB生成的默认分集标题
+func IsPlaceholderName(name string) bool {
+	return placeholderName.MatchString(strings.TrimSpace(name))
+}
+
+// ParseLanguages 解析逗号分隔的语言列表，按顺序去掉空白和重复的
+func ParseLanguages(languages ...string) []string {
+	list := make([]string, 0)
+	seen := make(map[string]struct{}, 0)
+	for _, item := range languages {
+		for _, language := range strings.Split(item, ",") {
+			language = strings.TrimSpace(language)
+			if _, ok := seen[language]; language == "" || ok {
+				continue
+			}
+			seen[language] = struct{}{}
+			list = append(list, language)
+		}
+	}
+	return list
+}
+
+// Languages 请求使用的语言和按顺序回退的语言
+func (t *tmdb) Languages() []string {
+	return append([]string{t.language}, t.fallback...)
+}
+
+// 只使用一种语言请求，不再回退
+func (t *tmdb) onlyLanguage(language string) *tmdb {
+	api := *t
+	api.language, api.fallback = language, nil
+	return &api
+}
+
+// 配置了回退语言时附加各语言的翻译
+func (t *tmdb) withTranslations(appendToResponse string) string {
+	if len(t.fallback) == 0 {
+		return appendToResponse
+	}
+	if appendToResponse == "" {
+		return "translations"
+	}
+	return appendToResponse + ",translations"
+}
+
+// Is 翻译是否是指定的语言，zh-CN 需要语言和地区都一致，zh 只比较语言
+func (tr *Translation) Is(language string) bool {
+	lang, region, _ := strings.Cut(language, "-")
+	return strings.EqualFold(tr.Iso6391, lang) && (region == "" || strings.EqualFold(tr.Iso31661, region))
+}
+
+// 按语言顺序补全字段，所有语言的翻译中都没有时保留接口返回的值
+func (t *tmdb) localize(translations *TranslationsResponse, value *string, field func(data *TranslationData) string) {
+	if translations == nil {
+		return
+	}
+
+	for _, language := range t.Languages() {
+		for _, item := range translations.Translations {
+			if !item.Is(language) {
+				continue
+			}
+			if text := strings.TrimSpace(field(&item.Data)); text != "" && !IsPlaceholderName(text) {
+				*value = text
+				return
+			}
+		}
+	}
+}
+
+func translationTitle(data *TranslationData) string {
+	return data.Title
+}
+
+func translationName(data *TranslationData) string {
+	return data.Name
+}
+
+func translationOverview(data *TranslationData) string {
+	return data.Overview
+}
+
+func translationTagline(data *TranslationData) string {
+	return data.Tagline
+}
+
+// 整季中有分集缺少标题或简介时，按顺序请求其他语言的整季详情补全
+func (t *tmdb) localizeSeason(detail *TvSeasonDetail, tvId int) {
+	for _, language := range t.fallback {
+		if !detail.missingTranslation() {
+			return
+		}
+
+		api := fmt.Sprintf(ApiTvSeason, tvId, detail.SeasonNumber)
+		body, err := t.onlyLanguage(language).request(api, nil)
+		if err != nil {
+			utils.Logger.WarningF("get season: %s in %s err: %v", api, language, err)
+			continue
+		}
+
+		other := &TvSeasonDetail{}
+		if err = json.Unmarshal(body, other); err != nil {
+			utils.Logger.WarningF("parse season: %s in %s err: %v", api, language, err)
+			continue
+		}
+
+		if detail.Overview == "" {
+			detail.Overview = other.Overview
+		}
+		for i := range detail.Episodes {
+			episode := &detail.Episodes[i]
+			translated := other.GetEpisode(episode.EpisodeNumber)
+			if translated == nil {
+				continue
+			}
+			if (episode.Name == "" || IsPlaceholderName(episode.Name)) && translated.Name != "" && !IsPlaceholderName(translated.Name) {
+				episode.Name = translated.Name
+			}
+			if episode.Overview == "" {
+				episode.Overview = translated.Overview
+			}
+		}
+	}
+}
+
+// 是否有分集缺少标题或简介
+func (d *TvSeasonDetail) missingTranslation() bool {
+	for _, episode := range d.Episodes {
+		if episode.Overview == "" || episode.Name == "" || IsPlaceholderName(episode.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package tmdb
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestWithLanguage(t *testing.T) {
+	api := &tmdb{language: "zh-CN", fallback: []string{"zh-TW", "en-US"}}
+
+	cases := map[string][]string{
+		"":            {"zh-CN", "zh-TW", "en-US"},
+		"zh-CN":       {"zh-CN", "zh-TW", "en-US"},
+		"ja-JP":       {"ja-JP", "zh-CN", "zh-TW", "en-US"},
+		"en-US,zh-TW": {"en-US", "zh-TW", "zh-CN"},
+	}
+	for language, want := range cases {
+		if give := api.WithLanguage(language).Languages(); !reflect.DeepEqual(give, want) {
+			t.Errorf("WithLanguage(%s) want %v, give %v", language, want, give)
+		}
+	}
+
+	if give := ParseLanguages(" zh-CN, ,en-US", "zh-CN"); !reflect.DeepEqual(give, []string{"zh-CN", "en-US"}) {
+		t.Errorf("ParseLanguages want [zh-CN en-US], give %v", give)
+	}
+}
+
+func TestIsPlaceholderName(t *testing.T) {
+	cases := map[string]bool{
+		"第 5 集":       true,
+		"第12集":        true,
+		"Episode 5":   true,
+		"第 1 话":       true,
+		"试播集":         false,
+		"Episode 5 ":  true,
+		"The Episode": false,
+	}
+	for name, want := range cases {
+		if give := IsPlaceholderName(name); give != want {
+			t.Errorf("IsPlaceholderName(%s) want %v, give %v", name, want, give)
+		}
+	}
+}
+
+func TestGetMovieDetailLocalize(t *testing.T) {
+	var appendToResponse string
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		appendToResponse = r.URL.Query().Get("append_to_response")
+		_, _ = w.Write([]byte(`{"id":1726,"title":"Iron Man","original_title":"Iron Man","overview":"","tagline":"",
+			"translations":{"translations":[
+				{"iso_3166_1":"CN","iso_639_1":"zh","data":{"title":"钢铁侠","overview":"","tagline":""}},
+				{"iso_3166_1":"TW","iso_639_1":"zh","data":{"title":"鋼鐵人","overview":"東尼史塔克","tagline":""}},
+				{"iso_3166_1":"US","iso_639_1":"en","data":{"title":"Iron Man","overview":"Tony Stark","tagline":"Heroes aren't born. They're built."}}]}}`))
+	})
+	defer closeFn()
+	api.language, api.fallback = "zh-CN", []string{"zh-TW", "en-US"}
+
+	detail, err := api.GetMovieDetail(1726)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appendToResponse != "credits,releases,images,videos,external_ids,translations" {
+		t.Errorf("append_to_response want translations, give %s", appendToResponse)
+	}
+	if detail.Title != "钢铁侠" || detail.Overview != "東尼史塔克" || detail.Tagline != "Heroes aren't born. They're built." || detail.Translations != nil {
+		t.Errorf("GetMovieDetail want fields from zh-CN, zh-TW, en-US, give %+v", detail)
+	}
+
+	// 没有回退语言时不请求翻译
+	api.fallback = nil
+	if _, err = api.GetMovieDetail(1726); err != nil {
+		t.Fatal(err)
+	}
+	if appendToResponse != "credits,releases,images,videos,external_ids" {
+		t.Errorf("append_to_response without fallback want no translations, give %s", appendToResponse)
+	}
+}
+
+func TestGetTvSeasonDetailLocalize(t *testing.T) {
+	languages := make([]string, 0)
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		language := r.URL.Query().Get("language")
+		languages = append(languages, language)
+		switch language {
+		case "zh-CN":
+			_, _ = w.Write([]byte(`{"id":3572,"season_number":1,"episodes":[
+				{"id":62085,"episode_number":1,"name":"试播集","overview":"沃尔特·怀特是一名高中化学老师。"},
+				{"id":62086,"episode_number":2,"name":"第 2 集","overview":""},
+				{"id":62087,"episode_number":3,"name":"第 3 集","overview":""}]}`))
+		case "zh-TW":
+			_, _ = w.Write([]byte(`{"id":3572,"season_number":1,"episodes":[
+				{"id":62086,"episode_number":2,"name":"第 2 集","overview":"華特和傑西試圖處理屍體。"},
+				{"id":62087,"episode_number":3,"name":"第 3 集","overview":""}]}`))
+		case "en-US":
+			_, _ = w.Write([]byte(`{"id":3572,"season_number":1,"episodes":[
+				{"id":62086,"episode_number":2,"name":"Cat's in the Bag...","overview":"Walt and Jesse attempt to dispose of two bodies."},
+				{"id":62087,"episode_number":3,"name":"...And the Bag's in the River","overview":"Walter fights with Jesse."}]}`))
+		}
+	})
+	defer closeFn()
+	api.language, api.fallback = "zh-CN", []string{"zh-TW", "en-US"}
+
+	detail, err := api.GetTvSeasonDetail(1396, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(languages, []string{"zh-CN", "zh-TW", "en-US"}) {
+		t.Errorf("GetTvSeasonDetail want request zh-CN, zh-TW, en-US, give %v", languages)
+	}
+
+	want := map[int][2]string{
+		1: {"试播集", "沃尔特·怀特是一名高中化学老师。"},
+		2: {"Cat's in the Bag...", "華特和傑西試圖處理屍體。"},
+		3: {"...And the Bag's in the River", "Walter fights with Jesse."},
+	}
+	for number, fields := range want {
+		episode := detail.GetEpisode(number)
+		if episode == nil || episode.Name != fields[0] || episode.Overview != fields[1] {
+			t.Errorf("episode %d want %v, give %+v", number, fields, episode)
+		}
+	}
+}
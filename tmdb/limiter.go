@@ -0,0 +1,81 @@
+package tmdb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 令牌桶限流，所有请求共用一个
+type limiter struct {
+	lock   *sync.Mutex
+	rate   float64 // 每秒生成的令牌数，小于等于0时不限制
+	burst  float64
+	tokens float64
+	last   time.Time
+	until  time.Time // 收到 Retry-After 后暂停到这个时间
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst <= 0 {
+		burst = max(int(rate), 1)
+	}
+
+	return &limiter{
+		lock:   &sync.Mutex{},
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// 等待拿到令牌，ctx 取消时返回错误
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// 拿到令牌时返回0，否则返回需要等待的时间
+func (l *limiter) reserve() time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	if now.Before(l.until) {
+		return l.until.Sub(now)
+	}
+
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// 暂停所有请求一段时间
+func (l *limiter) pause(d time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+}
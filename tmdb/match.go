@@ -0,0 +1,134 @@
+package tmdb
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 默认的匹配度阈值，低于这个值的搜索结果需要人工确认
+const defaultMatchThreshold = 0.6
+
+// 媒体类型，同 TMDB 返回的 media_type
+const (
+	MediaTypeMovie = "movie"
+	MediaTypeTv    = "tv"
+)
+
+// 名称中的季、集特征，比如 S01E02、S01、EP05、第3集、第二季
+var episodePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(?:s[0-9]{1,2}(?:e[0-9]{1,4})?|e[0-9]{1,4}|ep\s*[0-9]{1,4})(?:[^a-z0-9]|$)|第\s*[0-9零一二三四五六七八九十百]+\s*[季集]`)
+
+// 匹配度 0-1，以标题相似度为主，年份、内容完整性和热度只用来调整：
+// 标题完全一致、年份一致的接近1，年份未知的0.8左右，年份差距较大的0.6左右，
+// 媒体类型不一致的再乘以 mediaTypeScore，即使标题一致也会低于阈值
+func matchConfidence(queries, titles []string, year int, date string, popularity float32, complete bool, typeScore float64) float64 {
+	similarity := 0.0
+	for _, query := range queries {
+		for _, title := range titles {
+			similarity = math.Max(similarity, titleSimilarity(query, title))
+		}
+	}
+
+	score := 0.6 + 0.3*yearScore(year, date) + 0.05*popularityScore(popularity)
+	if complete {
+		score += 0.05
+	}
+
+	return similarity * score * typeScore
+}
+
+// 媒体类型提示，kind 为媒体库类型，mediaType 为结果的类型（搜索接口的结果没有，按接口的类型）：
+// 结果类型和媒体库不一致的0.5分，电影的名称中有季、集特征的多半是放错目录的剧集，0.6分，其他1分
+func mediaTypeScore(kind, mediaType string, queries []string) float64 {
+	if mediaType != "" && mediaType != kind {
+		return 0.5
+	}
+
+	if kind == MediaTypeMovie {
+		for _, query := range queries {
+			if episodePattern.MatchString(query) {
+				return 0.6
+			}
+		}
+	}
+
+	return 1
+}
+
+// 标准化的编辑距离，忽略大小写、空格和标点
+func titleSimilarity(a, b string) float64 {
+	ra, rb := normalizeTitle(a), normalizeTitle(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(max(len(ra), len(rb)))
+}
+
+func normalizeTitle(title string) []rune {
+	runes := make([]rune, 0, len(title))
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// 年份一致1分，相差一年（不同地区上映时间不同）0.8分，年份未知0.5分
+func yearScore(year int, date string) float64 {
+	if year == 0 {
+		return 0.5
+	}
+	if len(date) < 4 {
+		return 0.3
+	}
+
+	dateYear, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0.3
+	}
+
+	switch diff := max(year-dateYear, dateYear-year); {
+	case diff == 0:
+		return 1
+	case diff == 1:
+		return 0.8
+	case diff == 2:
+		return 0.4
+	default:
+		return 0
+	}
+}
+
+// 热度按数量级计算，1000以上为满分
+func popularityScore(popularity float32) float64 {
+	if popularity <= 0 {
+		return 0
+	}
+	return math.Min(1, math.Log10(1+float64(popularity))/3)
+}
@@ -0,0 +1,142 @@
+package tmdb
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestTitleSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want float64
+	}{
+		{"Iron Man", "iron.man", 1},
+		{"钢铁侠", "钢铁侠", 1},
+		{"钢铁侠", "钢铁侠2", 0.75},
+		{"Breaking Bad", "Breaking Bad!", 1},
+		{"Up", "", 0},
+		{"abcd", "wxyz", 0},
+	}
+
+	for _, item := range cases {
+		give := titleSimilarity(item.a, item.b)
+		if give < item.want-0.001 || give > item.want+0.001 {
+			t.Errorf("titleSimilarity(%s, %s) give: %.3f, want %.3f", item.a, item.b, give, item.want)
+		}
+	}
+}
+
+func TestMatchConfidence(t *testing.T) {
+	exact := matchConfidence([]string{"钢铁侠", ""}, []string{"钢铁侠", "Iron Man"}, 2008, "2008-04-30", 84, true, 1)
+	sequel := matchConfidence([]string{"钢铁侠", ""}, []string{"钢铁侠2", "Iron Man 2"}, 2008, "2010-04-28", 61, true, 1)
+	noYear := matchConfidence([]string{"", "Iron Man"}, []string{"钢铁侠", "Iron Man"}, 0, "2008-04-30", 84, true, 1)
+	wrong := matchConfidence([]string{"", "Fortress"}, []string{"钢铁侠", "Iron Man"}, 2008, "2008-04-30", 84, true, 1)
+
+	if exact < 0.95 || exact > 1 {
+		t.Errorf("exact match confidence: %.3f", exact)
+	}
+	if sequel >= defaultMatchThreshold || sequel >= exact {
+		t.Errorf("sequel confidence: %.3f should below threshold", sequel)
+	}
+	if noYear < defaultMatchThreshold || noYear >= exact {
+		t.Errorf("no year confidence: %.3f", noYear)
+	}
+	if wrong >= 0.3 {
+		t.Errorf("wrong title confidence: %.3f", wrong)
+	}
+}
+
+func TestMediaTypeScore(t *testing.T) {
+	cases := []struct {
+		kind, mediaType string
+		queries         []string
+		want            float64
+	}{
+		{MediaTypeMovie, "", []string{"钢铁侠", "Iron Man"}, 1},
+		{MediaTypeMovie, MediaTypeTv, []string{"", "Breaking Bad"}, 0.5},
+		{MediaTypeTv, MediaTypeTv, []string{"", "Breaking Bad"}, 1},
+		{MediaTypeMovie, "", []string{"", "Breaking Bad S01E02"}, 0.6},
+		{MediaTypeMovie, "", []string{"绝命毒师 第二季", ""}, 0.6},
+		{MediaTypeMovie, "", []string{"", "Friends EP05"}, 0.6},
+		{MediaTypeTv, "", []string{"", "Breaking Bad S01"}, 1},
+		{MediaTypeMovie, "", []string{"", "Se7en"}, 1},
+		{MediaTypeMovie, "", []string{"", "2001 A Space Odyssey"}, 1},
+	}
+
+	for _, item := range cases {
+		if give := mediaTypeScore(item.kind, item.mediaType, item.queries); give != item.want {
+			t.Errorf("mediaTypeScore(%s, %s, %v) give %.1f, want %.1f", item.kind, item.mediaType, item.queries, give, item.want)
+		}
+	}
+
+	// 标题完全一致但是类型不对的也需要人工确认
+	exact := matchConfidence([]string{"", "Breaking Bad S01E02"}, []string{"Breaking Bad S01E02"}, 0, "2008-01-20", 400, true,
+		mediaTypeScore(MediaTypeMovie, "", []string{"", "Breaking Bad S01E02"}))
+	if exact >= defaultMatchThreshold {
+		t.Errorf("episode like movie confidence: %.3f should below threshold", exact)
+	}
+}
+
+func TestSearchMovieLowConfidence(t *testing.T) {
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"page":1,"results":[{"id":1,"title":"Fortress of Solitude","original_title":"Fortress of Solitude","release_date":"1999-01-01"}]}`))
+	})
+	defer closeFn()
+	api.threshold = defaultMatchThreshold
+
+	result, err := api.SearchMovie("", "Fortress", 2021)
+	if !errors.Is(err, ErrLowConfidence) {
+		t.Fatalf("SearchMovie want low confidence, give %v", err)
+	}
+	if result == nil || result.Id != 1 || result.Confidence >= defaultMatchThreshold {
+		t.Errorf("SearchMovie want best match with low confidence, give %+v", result)
+	}
+}
+
+func TestSearchMovieCandidates(t *testing.T) {
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("year") != "" {
+			_, _ = w.Write([]byte(`{"page":1,"results":[{"id":1,"title":"Fortress","original_title":"Fortress","release_date":"2021-12-17"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"page":1,"results":[{"id":2,"title":"Fortress of Solitude","original_title":"Fortress of Solitude","release_date":"1999-01-01"},{"id":1,"title":"Fortress","original_title":"Fortress","release_date":"2021-12-17"}]}`))
+	})
+	defer closeFn()
+	api.threshold = defaultMatchThreshold
+
+	results, err := api.SearchMovieCandidates("", "Fortress", 2021)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Id != 1 || results[1].Id != 2 {
+		t.Errorf("SearchMovieCandidates want [1 2], give %+v", results)
+	}
+}
+
+func TestSearchShowsCandidatesStableOrder(t *testing.T) {
+	// 两次搜索返回的顺序不同，匹配度和热度都相同时按 id 排序
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("year") != "" {
+			_, _ = w.Write([]byte(`{"page":1,"results":[{"id":30,"name":"Fortress","original_name":"Fortress","popularity":5},{"id":20,"name":"Fortress","original_name":"Fortress","popularity":5}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"page":1,"results":[{"id":10,"name":"Fortress","original_name":"Fortress","popularity":5},{"id":40,"name":"Fortress","original_name":"Fortress","popularity":9}]}`))
+	})
+	defer closeFn()
+	api.threshold = defaultMatchThreshold
+
+	for i := 0; i < 20; i++ {
+		results, err := api.SearchShowsCandidates("", "Fortress", 2021)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]int, 0, len(results))
+		for _, item := range results {
+			ids = append(ids, item.Id)
+		}
+		if len(ids) != 4 || ids[0] != 40 || ids[1] != 10 || ids[2] != 20 || ids[3] != 30 {
+			t.Fatalf("SearchShowsCandidates want [40 10 20 30], give %v", ids)
+		}
+	}
+}
@@ -13,8 +13,9 @@ func (t *tmdb) GetMovieDetail(id int) (*MovieDetail, error) {
 
 	api := fmt.Sprintf(ApiMovieDetail, id)
 	req := map[string]string{
-		"append_to_response":     "credits,releases,images",
+		"append_to_response":     t.withTranslations("credits,releases,images,videos,external_ids"),
 		"include_image_language": "zh,en,null",
+		"include_video_language": "zh,en,null",
 	}
 
 	body, err := t.request(api, req)
@@ -30,6 +31,19 @@ func (t *tmdb) GetMovieDetail(id int) (*MovieDetail, error) {
 		return nil, err
 	}
 
+	// 已经补全的翻译不再写入缓存
+	t.localize(detail.Translations, &detail.Title, translationTitle)
+	t.localize(detail.Translations, &detail.Overview, translationOverview)
+	t.localize(detail.Translations, &detail.Tagline, translationTagline)
+	detail.Translations = nil
+
+	// 合集的简介用于NFO中的 <set>，获取失败不影响电影详情
+	if detail.BelongsToCollection.Id > 0 {
+		if collection, err := t.GetCollectionDetail(detail.BelongsToCollection.Id); err == nil {
+			detail.BelongsToCollection.Overview = collection.Overview
+		}
+	}
+
 	return detail, err
 }
 
@@ -41,6 +55,10 @@ func (d *MovieDetail) SaveToCache(file string) {
 
 	utils.Logger.InfoF("save movie detail to: %s", file)
 
+	if utils.Planned(utils.ActionWriteCache, file, "") {
+		return
+	}
+
 	f, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	if err != nil {
 		utils.Logger.ErrorF("save movie to cache, open_file err: %v", err)
@@ -4,12 +4,34 @@ import (
 	"encoding/json"
 	"errors"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
 	"sort"
 	"strconv"
-	"strings"
 )
 
+// SearchMovie 搜索并返回匹配度最高的结果，匹配度低于阈值时同时返回结果和 ErrLowConfidence
 func (t *tmdb) SearchMovie(chsTitle, engTitle string, year int) (*SearchMoviesResults, error) {
+	results, err := t.searchMovies(chsTitle, engTitle, year, false)
+	if err != nil {
+		return nil, err
+	}
+
+	best := results[0]
+	if best.Confidence < t.threshold {
+		return best, fmt.Errorf("search movie best match: %d %s (%s) confidence %.2f %w",
+			best.Id, best.Title, best.ReleaseDate, best.Confidence, ErrLowConfidence)
+	}
+
+	return best, nil
+}
+
+// SearchMovieCandidates 使用全部搜索条件搜索，返回去重后按匹配度排序的结果，用于手动识别
+func (t *tmdb) SearchMovieCandidates(chsTitle, engTitle string, year int) ([]*SearchMoviesResults, error) {
+	return t.searchMovies(chsTitle, engTitle, year, true)
+}
+
+// 依次使用各个搜索条件，all 为 false 时遇到匹配度达到阈值的结果就返回
+func (t *tmdb) searchMovies(chsTitle, engTitle string, year int, all bool) ([]*SearchMoviesResults, error) {
 	utils.Logger.InfoF("search: %s or %s %d from tmdb", chsTitle, engTitle, year)
 
 	strYear := strconv.Itoa(year)
@@ -61,74 +83,93 @@ func (t *tmdb) SearchMovie(chsTitle, engTitle string, year int) (*SearchMoviesRe
 		return nil, errors.New("title empty")
 	}
 
-	moviesResp := &SearchMoviesResponse{}
+	// 所有请求都失败时返回最后一个错误，区分网络错误和确实搜索不到
+	var lastErr error
+	searched := false
+	candidates := make(map[int]*SearchMoviesResults, 0)
+	order := make([]int, 0) // 第一次出现的顺序，排序结果不受 map 遍历顺序影响
 	for _, req := range searchComb {
 		body, err := t.request(ApiSearchMovie, req)
 		if err != nil {
 			utils.Logger.ErrorF("read tmdb response err: %v", err)
+			lastErr = err
 			continue
 		}
 
+		moviesResp := &SearchMoviesResponse{}
 		err = json.Unmarshal(body, moviesResp)
 		if err != nil {
 			utils.Logger.ErrorF("parse tmdb response err: %v", err)
+			lastErr = err
 			continue
 		}
+		searched = true
 
-		if len(moviesResp.Results) > 0 {
-			moviesResp.SortResults(chsTitle, engTitle, strYear)
-			utils.Logger.InfoF("search movies: %s %d result count: %d, use: %v", chsTitle, year, len(moviesResp.Results), moviesResp.Results[0])
-			return moviesResp.Results[0], nil
+		if len(moviesResp.Results) == 0 {
+			continue
 		}
-	}
 
-	return nil, errors.New("search movie not found")
-}
+		// 标题不一致时用前几个结果的别名和翻译重新排序
+		moviesResp.SortResults(chsTitle, engTitle, year)
+		if moviesResp.Results[0].Confidence < alternativeSkipConfidence {
+			for _, item := range moviesResp.Results[:min(alternativeCandidates, len(moviesResp.Results))] {
+				item.AlternativeTitles = t.GetAlternativeTitles(ApiMovieAlternativeTitles, ApiMovieTranslations, item.Id)
+			}
+			moviesResp.SortResults(chsTitle, engTitle, year)
+		}
 
-// SortResults sorts the movie search results based on multiple criteria
-func (resp *SearchMoviesResponse) SortResults(chsTitle, engTitle, year string) {
-	sort.SliceStable(resp.Results, func(i, j int) bool {
-		// Check for content completeness
-		completeI := isCompleteMovie(resp.Results[i])
-		completeJ := isCompleteMovie(resp.Results[j])
-		if completeI != completeJ {
-			return completeI
+		top := moviesResp.Results[0]
+		utils.Logger.InfoF("search movies: %s %d result count: %d, use: %v", chsTitle, year, len(moviesResp.Results), top)
+		if !all && top.Confidence >= t.threshold {
+			return moviesResp.Results, nil
 		}
 
-		// If year is provided, prioritize results from that year
-		if year != "" {
-			yearInt, _ := strconv.Atoi(year)
-			yearI, _ := strconv.Atoi(resp.Results[i].ReleaseDate[:4])
-			yearJ, _ := strconv.Atoi(resp.Results[j].ReleaseDate[:4])
-			if yearI == yearInt && yearJ != yearInt {
-				return true
+		// 匹配度不够时继续尝试其他搜索条件
+		for _, item := range moviesResp.Results {
+			exist, ok := candidates[item.Id]
+			if !ok {
+				order = append(order, item.Id)
 			}
-			if yearI != yearInt && yearJ == yearInt {
-				return false
+			if !ok || item.Confidence > exist.Confidence {
+				candidates[item.Id] = item
 			}
 		}
+	}
 
-		// Check for matching Chinese or English title
-		matchTitleI := matchesTitleMovie(resp.Results[i], chsTitle, engTitle)
-		matchTitleJ := matchesTitleMovie(resp.Results[j], chsTitle, engTitle)
-		if matchTitleI != matchTitleJ {
-			return matchTitleI
+	if len(candidates) == 0 {
+		if !searched && lastErr != nil {
+			return nil, lastErr
 		}
+		return nil, fmt.Errorf("search movie %w", ErrNotFound)
+	}
 
-		// Sort primarily by vote_average, then by popularity
-		if resp.Results[i].VoteAverage != resp.Results[j].VoteAverage {
-			return resp.Results[i].VoteAverage > resp.Results[j].VoteAverage
-		}
-		return resp.Results[i].Popularity > resp.Results[j].Popularity
-	})
-}
+	resp := &SearchMoviesResponse{Results: make([]*SearchMoviesResults, 0, len(candidates))}
+	for _, id := range order {
+		resp.Results = append(resp.Results, candidates[id])
+	}
+	resp.SortResults(chsTitle, engTitle, year)
 
-// isCompleteMovie checks if the movie result has complete information
-func isCompleteMovie(result *SearchMoviesResults) bool {
-	return result.PosterPath != "" && result.BackdropPath != "" && result.Overview != ""
+	return resp.Results, nil
 }
 
-// matchesTitleMovie checks if the movie result matches the given Chinese or English title
-func matchesTitleMovie(result *SearchMoviesResults, chsTitle, engTitle string) bool {
-	return strings.Contains(result.Title, chsTitle) || strings.Contains(result.OriginalTitle, engTitle)
+// SortResults 按匹配度从高到低排序，匹配度相同时热度高的在前，都相同时 id 小的在前
+func (resp *SearchMoviesResponse) SortResults(chsTitle, engTitle string, year int) {
+	queries := []string{chsTitle, engTitle}
+	for _, item := range resp.Results {
+		titles := append([]string{item.Title, item.OriginalTitle}, item.AlternativeTitles...)
+		// 只在视频网站发行的（导演剪辑、花絮等）视为不完整
+		complete := item.PosterPath != "" && item.BackdropPath != "" && item.Overview != "" && !item.Video
+		typeScore := mediaTypeScore(MediaTypeMovie, item.MediaType, queries)
+		item.Confidence = matchConfidence(queries, titles, year, item.ReleaseDate, item.Popularity, complete, typeScore)
+	}
+
+	sort.SliceStable(resp.Results, func(i, j int) bool {
+		if resp.Results[i].Confidence != resp.Results[j].Confidence {
+			return resp.Results[i].Confidence > resp.Results[j].Confidence
+		}
+		if resp.Results[i].Popularity != resp.Results[j].Popularity {
+			return resp.Results[i].Popularity > resp.Results[j].Popularity
+		}
+		return resp.Results[i].Id < resp.Results[j].Id
+	})
 }
@@ -0,0 +1,16 @@
+package tmdb
+
+import "testing"
+
+func TestSearchMovie(t *testing.T) {
+	api := newReplayTmdb()
+
+	// 同名的续集评分更低但排在前面，按年份选择正确的电影
+	result, err := api.SearchMovie("钢铁侠", "", 2008)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Id != 1726 || result.Title != "钢铁侠" {
+		t.Errorf("SearchMovie want 1726 钢铁侠, give %d %s", result.Id, result.Title)
+	}
+}
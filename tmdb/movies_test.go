@@ -0,0 +1,57 @@
+package tmdb
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetMovieDetail(t *testing.T) {
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/3/movie/1726":
+			_, _ = w.Write([]byte(`{"id":1726,"title":"钢铁侠","imdb_id":"tt0371746","runtime":126,"tagline":"钢铁之躯",
+				"belongs_to_collection":{"id":131292,"name":"钢铁侠（系列）"},
+				"videos":{"results":[
+					{"iso_639_1":"en","key":"teaser","site":"YouTube","type":"Teaser","official":true},
+					{"iso_639_1":"en","key":"en-trailer","site":"YouTube","type":"Trailer","official":true},
+					{"iso_639_1":"zh","key":"zh-fan","site":"YouTube","type":"Trailer","official":false},
+					{"iso_639_1":"zh","key":"zh-official","site":"YouTube","type":"Trailer","official":true},
+					{"iso_639_1":"zh","key":"vimeo","site":"Vimeo","type":"Trailer","official":true},
+					{"iso_639_1":"zh","key":"clip","site":"YouTube","type":"Clip","official":true}]}}`))
+		case "/3/collection/131292":
+			_, _ = w.Write([]byte(`{"id":131292,"name":"钢铁侠（系列）","overview":"托尼·斯塔克的故事。"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer closeFn()
+	api.language = "zh-CN"
+
+	detail, err := api.GetMovieDetail(1726)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.BelongsToCollection.Overview != "托尼·斯塔克的故事。" {
+		t.Errorf("GetMovieDetail want collection overview, give %+v", detail.BelongsToCollection)
+	}
+
+	cases := []struct {
+		languages []string
+		want      string
+	}{
+		{[]string{"zh-CN", "en-US"}, "zh-official"},
+		{[]string{"en-US", "zh-CN"}, "en-trailer"},
+		{[]string{"ja-JP"}, "en-trailer"},
+	}
+	for _, item := range cases {
+		video := detail.Videos.Trailer(item.languages)
+		if video == nil || video.Key != item.want {
+			t.Errorf("Trailer(%v) want %s, give %+v", item.languages, item.want, video)
+		}
+	}
+
+	var videos *MovieVideos
+	if videos.Trailer(nil) != nil || (&MovieVideos{}).Trailer(nil) != nil {
+		t.Errorf("Trailer without videos want nil")
+	}
+}
@@ -1,41 +1,47 @@
 package tmdb
 
+import "strings"
+
 // MovieDetail 电影详情
 type MovieDetail struct {
-	Adult               bool                `json:"adult"`
-	BackdropPath        string              `json:"backdrop_path"`
-	BelongsToCollection BelongsToCollection `json:"belongs_to_collection"`
-	Budget              int                 `json:"budget"`
-	Genres              []Genre             `json:"genres"`
-	Homepage            string              `json:"homepage"`
-	Id                  int                 `json:"id"`
-	ImdbId              string              `json:"imdb_id"`
-	OriginalLanguage    string              `json:"original_language"`
-	OriginalTitle       string              `json:"original_title"`
-	Overview            string              `json:"overview"`
-	Popularity          float32             `json:"popularity"`
-	PosterPath          string              `json:"poster_path"`
-	ProductionCompanies []ProductionCompany `json:"production_companies"`
-	ProductionCountries []ProductionCountry `json:"production_countries"`
-	ReleaseDate         string              `json:"release_date"`
-	Revenue             int64               `json:"revenue"`
-	Runtime             int                 `json:"runtime"`
-	SpokenLanguages     []SpokenLanguage    `json:"spoken_languages"`
-	Status              string              `json:"status"`
-	Tagline             string              `json:"tagline"`
-	Title               string              `json:"title"`
-	Video               bool                `json:"video"`
-	VoteAverage         float32             `json:"vote_average"`
-	VoteCount           int                 `json:"vote_count"`
-	Credits             *Credit             `json:"credits"`
-	FromCache           bool                `json:"from_cache"`
-	Releases            MovieRelease        `json:"releases"`
-	Images              *MovieImages        `json:"images"`
+	Adult               bool                  `json:"adult"`
+	BackdropPath        string                `json:"backdrop_path"`
+	BelongsToCollection BelongsToCollection   `json:"belongs_to_collection"`
+	Budget              int                   `json:"budget"`
+	Genres              []Genre               `json:"genres"`
+	Homepage            string                `json:"homepage"`
+	Id                  int                   `json:"id"`
+	ImdbId              string                `json:"imdb_id"`
+	OriginalLanguage    string                `json:"original_language"`
+	OriginalTitle       string                `json:"original_title"`
+	Overview            string                `json:"overview"`
+	Popularity          float32               `json:"popularity"`
+	PosterPath          string                `json:"poster_path"`
+	ProductionCompanies []ProductionCompany   `json:"production_companies"`
+	ProductionCountries []ProductionCountry   `json:"production_countries"`
+	ReleaseDate         string                `json:"release_date"`
+	Revenue             int64                 `json:"revenue"`
+	Runtime             int                   `json:"runtime"`
+	SpokenLanguages     []SpokenLanguage      `json:"spoken_languages"`
+	Status              string                `json:"status"`
+	Tagline             string                `json:"tagline"`
+	Title               string                `json:"title"`
+	Video               bool                  `json:"video"`
+	VoteAverage         float32               `json:"vote_average"`
+	VoteCount           int                   `json:"vote_count"`
+	Credits             *Credit               `json:"credits"`
+	FromCache           bool                  `json:"from_cache"`
+	Releases            MovieRelease          `json:"releases"`
+	Images              *MovieImages          `json:"images"`
+	Videos              *MovieVideos          `json:"videos"`
+	ExternalIds         *ExternalIds          `json:"external_ids"`
+	Translations        *TranslationsResponse `json:"translations,omitempty"`
 }
 
 type BelongsToCollection struct {
 	Id           int    `json:"id"`
 	Name         string `json:"name"`
+	Overview     string `json:"overview"` // 详情中没有，从合集接口获取
 	PosterPath   string `json:"poster_path"`
 	BackdropPath string `json:"backdrop_path"`
 }
@@ -86,20 +92,23 @@ type SearchMoviesResponse struct {
 
 // SearchMoviesResults 搜索电影的结果
 type SearchMoviesResults struct {
-	PosterPath       string  `json:"poster_path"`
-	Adult            bool    `json:"adult"`
-	Overview         string  `json:"overview"`
-	ReleaseDate      string  `json:"release_date"`
-	GenreIds         []int   `json:"genre_ids"`
-	Id               int     `json:"id"`
-	OriginalTitle    string  `json:"original_title"`
-	OriginalLanguage string  `json:"original_language"`
-	Title            string  `json:"title"`
-	BackdropPath     string  `json:"backdrop_path"`
-	Popularity       float32 `json:"popularity"`
-	VoteCount        int     `json:"vote_count"`
-	Video            bool    `json:"video"`
-	VoteAverage      float32 `json:"vote_average"`
+	PosterPath        string   `json:"poster_path"`
+	Adult             bool     `json:"adult"`
+	Overview          string   `json:"overview"`
+	ReleaseDate       string   `json:"release_date"`
+	GenreIds          []int    `json:"genre_ids"`
+	Id                int      `json:"id"`
+	OriginalTitle     string   `json:"original_title"`
+	OriginalLanguage  string   `json:"original_language"`
+	Title             string   `json:"title"`
+	BackdropPath      string   `json:"backdrop_path"`
+	Popularity        float32  `json:"popularity"`
+	VoteCount         int      `json:"vote_count"`
+	Video             bool     `json:"video"`
+	VoteAverage       float32  `json:"vote_average"`
+	MediaType         string   `json:"media_type,omitempty"`         // 只有 find 和 multi 搜索的结果有
+	Confidence        float64  `json:"confidence,omitempty"`         // 和搜索条件的匹配度，0-1
+	AlternativeTitles []string `json:"alternative_titles,omitempty"` // 别名和各语言的标题，只有匹配度不够时才获取
 }
 
 // MovieRelease 电影各国家上映时间和分级
@@ -130,3 +139,61 @@ type MovieImages struct {
 	Posters   []*MovieImage `json:"posters"`
 	Backdrops []*MovieImage `json:"backdrops"`
 }
+
+type MovieVideos struct {
+	Id      int           `json:"id"`
+	Results []*MovieVideo `json:"results"`
+}
+
+// MovieVideo 预告片、花絮等视频，Key 为视频网站上的id
+type MovieVideo struct {
+	Iso6391     string `json:"iso_639_1"`
+	Iso31661    string `json:"iso_3166_1"`
+	Name        string `json:"name"`
+	Key         string `json:"key"`
+	Site        string `json:"site"`
+	Type        string `json:"type"`
+	Official    bool   `json:"official"`
+	PublishedAt string `json:"published_at"`
+}
+
+// Trailer YouTube上的预告片，按语言顺序优先，同一语言中官方的优先，没有预告片时使用先导预告，都没有时返回nil
+func (v *MovieVideos) Trailer(languages []string) *MovieVideo {
+	if v == nil {
+		return nil
+	}
+
+	var best *MovieVideo
+	bestScore := -1
+	for _, item := range v.Results {
+		if item.Site != "YouTube" || item.Key == "" || (item.Type != "Trailer" && item.Type != "Teaser") {
+			continue
+		}
+
+		// 类型、语言、是否官方依次决定优先级
+		score := 0
+		if item.Type == "Trailer" {
+			score += 1000
+		}
+		score += 10 * (len(languages) - languageIndex(languages, item.Iso6391))
+		if item.Official {
+			score += 1
+		}
+		if score > bestScore {
+			best, bestScore = item, score
+		}
+	}
+
+	return best
+}
+
+// 语言在列表中的位置，只比较 zh-CN 中的 zh，不在列表中时返回列表长度
+func languageIndex(languages []string, iso6391 string) int {
+	for i, language := range languages {
+		lang, _, _ := strings.Cut(language, "-")
+		if iso6391 != "" && strings.EqualFold(lang, iso6391) {
+			return i
+		}
+	}
+	return len(languages)
+}
@@ -0,0 +1,261 @@
+package tmdb
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 接口返回缓存，所有条目共用，按接口、参数和语言区分，过期后使用 ETag/Last-Modified 重新验证
+type responseCache struct {
+	dir string
+	ttl time.Duration // 过期后超过这个时间没有再请求的删除，0不删除
+}
+
+type cacheEntry struct {
+	Request      string          `json:"request"`
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"last_modified,omitempty"`
+	Expires      time.Time       `json:"expires"` // 根据 max-age 计算，之前不需要请求
+	Body         json.RawMessage `json:"body"`
+}
+
+func newResponseCache(dir string, ttl time.Duration) *responseCache {
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		utils.Logger.WarningF("create tmdb response cache dir: %s err: %v", dir, err)
+		return nil
+	}
+
+	return &responseCache{dir: dir, ttl: ttl}
+}
+
+// 读取缓存，没有时返回nil
+func (c *responseCache) get(key string) *cacheEntry {
+	if c == nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(c.file(key))
+	if err != nil {
+		return nil
+	}
+
+	entry := &cacheEntry{}
+	if err = json.Unmarshal(content, entry); err != nil || entry.Request != key {
+		return nil
+	}
+
+	return entry
+}
+
+// 保存200的返回，no-store 或者没有过期时间也没有验证信息时不保存
+func (c *responseCache) put(key string, header http.Header, body []byte) {
+	if c == nil || !json.Valid(body) {
+		return
+	}
+
+	maxAge, store := parseCacheControl(header.Get("Cache-Control"))
+	entry := &cacheEntry{
+		Request:      key,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Expires:      time.Now().Add(maxAge),
+		Body:         body,
+	}
+	if !store || (maxAge == 0 && entry.ETag == "" && entry.LastModified == "") {
+		return
+	}
+
+	c.save(entry)
+}
+
+// 304 后更新过期时间，返回内容不变
+func (c *responseCache) revalidate(entry *cacheEntry, header http.Header) {
+	if c == nil {
+		return
+	}
+
+	maxAge, _ := parseCacheControl(header.Get("Cache-Control"))
+	entry.Expires = time.Now().Add(maxAge)
+	if etag := header.Get("ETag"); etag != "" {
+		entry.ETag = etag
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		entry.LastModified = lastModified
+	}
+
+	c.save(entry)
+}
+
+// 演习模式不写入
+func (c *responseCache) save(entry *cacheEntry) {
+	if utils.DryRun {
+		return
+	}
+
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	file := c.file(entry.Request)
+	tmpFile := file + ".tmp"
+	if err = os.WriteFile(tmpFile, content, 0644); err == nil {
+		err = os.Rename(tmpFile, file)
+	}
+	if err != nil {
+		utils.Logger.WarningF("save tmdb response cache: %s err: %v", file, err)
+		_ = os.Remove(tmpFile)
+	}
+}
+
+func (c *responseCache) file(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// 是否还在有效期内，不需要请求
+func (e *cacheEntry) fresh() bool {
+	return e != nil && time.Now().Before(e.Expires)
+}
+
+// 设置条件请求头
+func (e *cacheEntry) setConditional(req *http.Request) {
+	if e == nil {
+		return
+	}
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+// 解析 Cache-Control，返回 max-age 和是否可以缓存，no-cache 时每次都需要重新验证
+func parseCacheControl(value string) (time.Duration, bool) {
+	var maxAge time.Duration
+	noCache := false
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch {
+		case item == "no-store":
+			return 0, false
+		case item == "no-cache":
+			noCache = true
+		case strings.HasPrefix(item, "max-age="):
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(item, "max-age=")); err == nil && seconds > 0 {
+				maxAge = time.Second * time.Duration(seconds)
+			}
+		}
+	}
+
+	if noCache {
+		return 0, true
+	}
+	return maxAge, true
+}
+
+// 删除指定接口及其子接口的缓存，返回删除的数量
+func (c *responseCache) expire(api string) int {
+	if c == nil {
+		return 0
+	}
+
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		entry := &cacheEntry{}
+		if json.Unmarshal(content, entry) != nil {
+			continue
+		}
+
+		if strings.HasPrefix(entry.Request, api+"?") || strings.HasPrefix(entry.Request, api+"/") {
+			if utils.Remove(file) == nil {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// 定时清理缓存，启动时执行一次，之后每天一次
+func (c *responseCache) runPrune(ctx context.Context) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour * 24)
+	defer ticker.Stop()
+	for {
+		if count := c.prune(); count > 0 {
+			utils.Logger.InfoF("pruned %d tmdb response cache", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 删除过期后超过 ttl 都没有再请求的缓存，不同语言、分页的返回不会一直累积，返回删除的数量
+func (c *responseCache) prune() int {
+	if c == nil || c.ttl <= 0 {
+		return 0
+	}
+
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	deadline := time.Now().Add(-c.ttl)
+	for _, file := range files {
+		// 每次写入或重新验证都会更新修改时间，最近修改过的不需要读取内容
+		info, err := os.Stat(file)
+		if err != nil || info.ModTime().After(deadline) {
+			continue
+		}
+
+		// 无法解析的也一起删除
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		entry := &cacheEntry{}
+		if json.Unmarshal(content, entry) == nil && entry.Expires.After(deadline) {
+			continue
+		}
+
+		if utils.Remove(file) == nil {
+			count++
+		}
+	}
+
+	return count
+}
@@ -4,9 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
 	"sort"
 	"strconv"
-	"strings"
 )
 
 type SearchTvResponse struct {
@@ -17,19 +17,22 @@ type SearchTvResponse struct {
 }
 
 type SearchResults struct {
-	Id               int      `json:"id"`
-	PosterPath       string   `json:"poster_path"`
-	Popularity       float32  `json:"popularity"`
-	BackdropPath     string   `json:"backdrop_path"`
-	VoteAverage      float32  `json:"vote_average"`
-	Overview         string   `json:"overview"`
-	FirstAirDate     string   `json:"first_air_date"`
-	OriginCountry    []string `json:"origin_country"`
-	GenreIds         []int    `json:"genre_ids"`
-	OriginalLanguage string   `json:"original_language"`
-	VoteCount        int      `json:"vote_count"`
-	Name             string   `json:"name"`
-	OriginalName     string   `json:"original_name"`
+	Id                int      `json:"id"`
+	PosterPath        string   `json:"poster_path"`
+	Popularity        float32  `json:"popularity"`
+	BackdropPath      string   `json:"backdrop_path"`
+	VoteAverage       float32  `json:"vote_average"`
+	Overview          string   `json:"overview"`
+	FirstAirDate      string   `json:"first_air_date"`
+	OriginCountry     []string `json:"origin_country"`
+	GenreIds          []int    `json:"genre_ids"`
+	OriginalLanguage  string   `json:"original_language"`
+	VoteCount         int      `json:"vote_count"`
+	Name              string   `json:"name"`
+	OriginalName      string   `json:"original_name"`
+	MediaType         string   `json:"media_type,omitempty"`         // 只有 find 和 multi 搜索的结果有
+	Confidence        float64  `json:"confidence,omitempty"`         // 和搜索条件的匹配度，0-1
+	AlternativeTitles []string `json:"alternative_titles,omitempty"` // 别名和各语言的标题，只有匹配度不够时才获取
 }
 
 type Response struct {
@@ -74,56 +77,50 @@ func swap(s []*SearchResults, i, j int) {
 // 	}
 // }
 
-// SortResults sorts the TV search results based on multiple criteria
-func (resp *SearchTvResponse) SortResults(chsTitle, engTitle, year string) {
-	sort.SliceStable(resp.Results, func(i, j int) bool {
-		// Check for content completeness
-		completeI := isComplete(resp.Results[i])
-		completeJ := isComplete(resp.Results[j])
-		if completeI != completeJ {
-			return completeI
-		}
+// SortResults 按匹配度从高到低排序，匹配度相同时热度高的在前，都相同时 id 小的在前
+func (resp *SearchTvResponse) SortResults(chsTitle, engTitle string, year int) {
+	queries := []string{chsTitle, engTitle}
+	for _, item := range resp.Results {
+		titles := append([]string{item.Name, item.OriginalName}, item.AlternativeTitles...)
+		complete := item.PosterPath != "" && item.BackdropPath != "" && item.Overview != ""
+		typeScore := mediaTypeScore(MediaTypeTv, item.MediaType, queries)
+		item.Confidence = matchConfidence(queries, titles, year, item.FirstAirDate, item.Popularity, complete, typeScore)
+	}
 
-		// If year is provided, prioritize results from that year
-		if year != "" {
-			yearInt, _ := strconv.Atoi(year)
-			yearI, _ := strconv.Atoi(resp.Results[i].FirstAirDate[:4])
-			yearJ, _ := strconv.Atoi(resp.Results[j].FirstAirDate[:4])
-			if yearI == yearInt && yearJ != yearInt {
-				return true
-			}
-			if yearI != yearInt && yearJ == yearInt {
-				return false
-			}
+	sort.SliceStable(resp.Results, func(i, j int) bool {
+		if resp.Results[i].Confidence != resp.Results[j].Confidence {
+			return resp.Results[i].Confidence > resp.Results[j].Confidence
 		}
-
-		// Check for matching Chinese or English title
-		matchTitleI := matchesTitle(resp.Results[i], chsTitle, engTitle)
-		matchTitleJ := matchesTitle(resp.Results[j], chsTitle, engTitle)
-		if matchTitleI != matchTitleJ {
-			return matchTitleI
+		if resp.Results[i].Popularity != resp.Results[j].Popularity {
+			return resp.Results[i].Popularity > resp.Results[j].Popularity
 		}
-
-		// Sort primarily by vote_average, then by popularity
-		if resp.Results[i].VoteAverage != resp.Results[j].VoteAverage {
-			return resp.Results[i].VoteAverage > resp.Results[j].VoteAverage
-		}
-		return resp.Results[i].Popularity > resp.Results[j].Popularity
+		return resp.Results[i].Id < resp.Results[j].Id
 	})
 }
 
-// isComplete checks if the result has complete information
-func isComplete(result *SearchResults) bool {
-	return result.PosterPath != "" && result.BackdropPath != "" && result.Overview != ""
+// SearchShows 搜索并返回匹配度最高的结果，匹配度低于阈值时同时返回结果和 ErrLowConfidence
+func (t *tmdb) SearchShows(chsTitle, engTitle string, year int) (*SearchResults, error) {
+	results, err := t.searchShows(chsTitle, engTitle, year, false)
+	if err != nil {
+		return nil, err
+	}
+
+	best := results[0]
+	if best.Confidence < t.threshold {
+		return best, fmt.Errorf("search tv best match: %d %s (%s) confidence %.2f %w",
+			best.Id, best.Name, best.FirstAirDate, best.Confidence, ErrLowConfidence)
+	}
+
+	return best, nil
 }
 
-// matchesTitle checks if the result matches the given Chinese or English title
-func matchesTitle(result *SearchResults, chsTitle, engTitle string) bool {
-	return strings.Contains(result.Name, chsTitle) || strings.Contains(result.OriginalName, engTitle)
+// SearchShowsCandidates 使用全部搜索条件搜索，返回去重后按匹配度排序的结果，用于手动识别
+func (t *tmdb) SearchShowsCandidates(chsTitle, engTitle string, year int) ([]*SearchResults, error) {
+	return t.searchShows(chsTitle, engTitle, year, true)
 }
 
-// SearchShows 搜索tmdb
-func (t *tmdb) SearchShows(chsTitle, engTitle string, year int) (*SearchResults, error) {
+// 依次使用各个搜索条件，all 为 false 时遇到匹配度达到阈值的结果就返回
+func (t *tmdb) searchShows(chsTitle, engTitle string, year int, all bool) ([]*SearchResults, error) {
 	utils.Logger.InfoF("search: %s or %s %d from tmdb", chsTitle, engTitle, year)
 
 	strYear := strconv.Itoa(year)
@@ -165,26 +162,71 @@ func (t *tmdb) SearchShows(chsTitle, engTitle string, year int) (*SearchResults,
 		return nil, errors.New("title empty")
 	}
 
-	tvResp := &SearchTvResponse{}
+	// 所有请求都失败时返回最后一个错误，区分网络错误和确实搜索不到
+	var lastErr error
+	searched := false
+	candidates := make(map[int]*SearchResults, 0)
+	order := make([]int, 0) // 第一次出现的顺序，排序结果不受 map 遍历顺序影响
 	for _, req := range searchComb {
 		body, err := t.request(ApiSearchTv, req)
 		if err != nil {
 			utils.Logger.ErrorF("read tmdb response err: %v", err)
+			lastErr = err
 			continue
 		}
 
+		tvResp := &SearchTvResponse{}
 		err = json.Unmarshal(body, tvResp)
 		if err != nil {
 			utils.Logger.ErrorF("parse tmdb response err: %v", err)
+			lastErr = err
 			continue
 		}
+		searched = true
 
-		if len(tvResp.Results) > 0 {
-			tvResp.SortResults(chsTitle, engTitle, strYear)
-			utils.Logger.InfoF("search tv: %s %d result count: %d, use: %v", chsTitle, year, len(tvResp.Results), tvResp.Results[0])
-			return tvResp.Results[0], nil
+		if len(tvResp.Results) == 0 {
+			continue
+		}
+
+		// 标题不一致时用前几个结果的别名和翻译重新排序
+		tvResp.SortResults(chsTitle, engTitle, year)
+		if tvResp.Results[0].Confidence < alternativeSkipConfidence {
+			for _, item := range tvResp.Results[:min(alternativeCandidates, len(tvResp.Results))] {
+				item.AlternativeTitles = t.GetAlternativeTitles(ApiTvAlternativeTitles, ApiTvTranslations, item.Id)
+			}
+			tvResp.SortResults(chsTitle, engTitle, year)
 		}
+
+		top := tvResp.Results[0]
+		utils.Logger.InfoF("search tv: %s %d result count: %d, use: %v", chsTitle, year, len(tvResp.Results), top)
+		if !all && top.Confidence >= t.threshold {
+			return tvResp.Results, nil
+		}
+
+		// 匹配度不够时继续尝试其他搜索条件
+		for _, item := range tvResp.Results {
+			exist, ok := candidates[item.Id]
+			if !ok {
+				order = append(order, item.Id)
+			}
+			if !ok || item.Confidence > exist.Confidence {
+				candidates[item.Id] = item
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		if !searched && lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, fmt.Errorf("search tv %w", ErrNotFound)
+	}
+
+	resp := &SearchTvResponse{Results: make([]*SearchResults, 0, len(candidates))}
+	for _, id := range order {
+		resp.Results = append(resp.Results, candidates[id])
 	}
+	resp.SortResults(chsTitle, engTitle, year)
 
-	return nil, errors.New("search tv not found")
+	return resp.Results, nil
 }
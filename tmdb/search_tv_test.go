@@ -1 +1,15 @@
 package tmdb
+
+import "testing"
+
+func TestSearchShows(t *testing.T) {
+	api := newReplayTmdb()
+
+	result, err := api.SearchShows("", "Breaking Bad", 2008)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Id != 1396 || result.OriginalName != "Breaking Bad" {
+		t.Errorf("SearchShows want 1396 Breaking Bad, give %d %s", result.Id, result.OriginalName)
+	}
+}
@@ -2,14 +2,21 @@ package tmdb
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fengqi/kodi-metadata-tmdb-cli/config"
+	"fengqi/kodi-metadata-tmdb-cli/metrics"
 	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
 	"golang.org/x/net/proxy"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,22 +27,97 @@ const (
 	ApiSearchTv           = "/3/search/tv"
 	ApiSearchMovie        = "/3/search/movie"
 	ApiTvDetail           = "/3/tv/%d"
+	ApiTvSeason           = "/3/tv/%d/season/%d"
 	ApiTvEpisode          = "/3/tv/%d/season/%d/episode/%d"
 	ApiTvAggregateCredits = "/3/tv/%d/aggregate_credits"
 	ApiTvContentRatings   = "/3/tv/%d/content_ratings"
 	ApiTvEpisodeGroup     = "/3/tv/episode_group/%s"
 	ApiMovieDetail        = "/3/movie/%d"
+	ApiCollection         = "/3/collection/%d"
+	ApiFind               = "/3/find/%s"
+
+	ApiTvExternalIds        = "/3/tv/%d/external_ids"
+	ApiTvEpisodeExternalIds = "/3/tv/%d/season/%d/episode/%d/external_ids"
+
+	ApiMovieAlternativeTitles = "/3/movie/%d/alternative_titles"
+	ApiMovieTranslations      = "/3/movie/%d/translations"
+	ApiTvAlternativeTitles    = "/3/tv/%d/alternative_titles"
+	ApiTvTranslations         = "/3/tv/%d/translations"
 )
 
-func InitTmdb(config *config.TmdbConfig) {
+func InitTmdb(ctx context.Context, config *config.TmdbConfig) {
+	rateLimit := config.RateLimit
+	if rateLimit == 0 {
+		rateLimit = 20
+	}
+	retries := config.MaxRetries
+	if retries == 0 {
+		retries = 3
+	}
+	threshold := config.MatchThreshold
+	if threshold == 0 {
+		threshold = defaultMatchThreshold
+	}
+	cacheDays := config.ResponseCacheDays
+	if cacheDays == 0 {
+		cacheDays = 30
+	}
+
+	// 配置了语言列表时第一个为请求使用的语言，其他的用于补全缺少的字段
+	languages := ParseLanguages(config.Language)
+	if len(config.Languages) > 0 {
+		languages = ParseLanguages(config.Languages...)
+	}
+	if len(languages) == 0 {
+		languages = []string{""}
+	}
+
 	HttpClient = getHttpClient(config.Proxy)
+	switch config.FixturesMode {
+	case FixturesRecord, FixturesReplay:
+		utils.Logger.InfoF("tmdb fixtures %s mode, dir: %s", config.FixturesMode, config.FixturesDir)
+		HttpClient = &http.Client{
+			Timeout:   HttpClient.Timeout,
+			Transport: newFixtureTransport(config.FixturesMode, config.FixturesDir, config.ApiHost, HttpClient.Transport),
+		}
+	case "":
+	default:
+		utils.Logger.WarningF("unknown tmdb fixtures mode: %s", config.FixturesMode)
+	}
 	Api = &tmdb{
-		apiHost:   config.ApiHost,
-		apiKey:    config.ApiKey,
-		imageHost: config.ImageHost,
-		language:  config.Language,
-		rating:    config.Rating,
+		ctx:         ctx,
+		apiHost:     config.ApiHost,
+		apiKey:      config.ApiKey,
+		accessToken: config.AccessToken,
+		imageHost:   config.ImageHost,
+		language:    languages[0],
+		fallback:    languages[1:],
+		rating:      config.Rating,
+		limiter:     newLimiter(rateLimit, config.RateBurst),
+		retries:     max(retries, 0),
+		backoff:     time.Second,
+		cache:       newResponseCache(config.ResponseCacheDir, time.Hour*24*time.Duration(max(cacheDays, 0))),
+		threshold:   threshold,
+	}
+	go Api.cache.runPrune(ctx)
+}
+
+// ExpireCache 删除接口返回缓存，api 为接口路径，比如 /3/tv/1396，同时删除季、单集等子接口
+func (t *tmdb) ExpireCache(api string) int {
+	return t.cache.expire(api)
+}
+
+// WithLanguage 使用指定语言请求，其他配置和限速、缓存共用，language 为空时使用配置的语言
+func (t *tmdb) WithLanguage(language string) *tmdb {
+	if language == "" || language == t.language {
+		return t
 	}
+
+	// 可以用逗号分隔多个语言，指定的语言优先，之后是配置的语言
+	languages := ParseLanguages(language, strings.Join(t.Languages(), ","))
+	api := *t
+	api.language, api.fallback = languages[0], languages[1:]
+	return &api
 }
 
 // GetImageW500 压缩后的图片
@@ -59,15 +141,86 @@ func (t *tmdb) request(api string, args map[string]string) ([]byte, error) {
 		args = make(map[string]string, 0)
 	}
 
-	args["api_key"] = t.apiKey
+	if t.accessToken == "" {
+		args["api_key"] = t.apiKey
+	}
 	args["language"] = t.language
 
 	api = t.apiHost + api + "?" + utils.StringMapToQuery(args)
-	resp, err := HttpClient.Get(api)
+
+	// 有效期内直接使用缓存，不同条目请求同一个接口时也只请求一次
+	var cached *cacheEntry
+	key := ""
+	if u, err := url.Parse(api); err == nil {
+		key = requestKey(u)
+		cached = t.cache.get(key)
+	}
+	if cached.fresh() {
+		utils.Logger.DebugF("request tmdb from cache: %s", key)
+		return cached.Body, nil
+	}
+
+	// 都是GET请求，网络错误、5xx和429可以放心重试
+	var body []byte
+	var err error
+	for i := 0; i <= t.retries; i++ {
+		if i > 0 {
+			delay := t.backoff << (i - 1)
+			var apiErr *ApiError
+			if errors.As(err, &apiErr) && apiErr.RetryAfter > delay {
+				delay = apiErr.RetryAfter
+			}
+
+			utils.Logger.WarningF("request tmdb: %s err: %v, retry after %s", utils.RedactUrl(api), err, delay)
+			select {
+			case <-t.ctx.Done():
+				return nil, t.ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		body, err = t.doRequest(api, key, cached)
+		if err == nil {
+			return body, nil
+		}
+
+		var apiErr *ApiError
+		if t.ctx.Err() != nil || errors.Is(err, ErrFixtureMissing) || (errors.As(err, &apiErr) && !apiErr.retryable()) {
+			break
+		}
+	}
+
+	utils.Logger.ErrorF("request tmdb: %s err: %v", utils.RedactUrl(api), err)
+	return nil, err
+}
+
+// 发送单次请求，有缓存时使用条件请求，非200和304时返回 ApiError
+func (t *tmdb) doRequest(api, key string, cached *cacheEntry) ([]byte, error) {
+	if err := t.limiter.wait(t.ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(t.ctx, http.MethodGet, api, nil)
+	if err != nil {
+		return nil, err
+	}
+	if t.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+t.accessToken)
+	}
+	cached.setConditional(req)
+
+	start := time.Now()
+	resp, err := HttpClient.Do(req)
 	if err != nil {
-		utils.Logger.ErrorF("request tmdb: %s err: %v", api, err)
+		metrics.TmdbRequest(req.URL.Path, 0, time.Since(start))
+		// 错误信息中包含请求网址，会输出到日志和任务队列
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = utils.RedactUrl(urlErr.URL)
+		}
 		return nil, err
 	}
+	metrics.TmdbRequest(req.URL.Path, resp.StatusCode, time.Since(start))
 
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -76,7 +229,51 @@ func (t *tmdb) request(api string, args map[string]string) ([]byte, error) {
 		}
 	}(resp.Body)
 
-	return io.ReadAll(io.Reader(resp.Body))
+	body, err := io.ReadAll(io.Reader(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		t.cache.put(key, resp.Header, body)
+		return body, nil
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		utils.Logger.DebugF("request tmdb not modified: %s", key)
+		t.cache.revalidate(cached, resp.Header)
+		return cached.Body, nil
+	}
+
+	apiErr := &ApiError{HttpStatus: resp.StatusCode}
+	response := &Response{}
+	if json.Unmarshal(body, response) == nil {
+		apiErr.StatusCode = response.StatusCode
+		apiErr.StatusMessage = response.StatusMessage
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		t.limiter.pause(apiErr.RetryAfter)
+	}
+
+	return nil, apiErr
+}
+
+// Retry-After 可以是秒数也可以是时间，解析不了时默认等待1秒
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Second * time.Duration(seconds)
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+		return 0
+	}
+
+	return time.Second
 }
 
 // DownloadFile 下载文件, 提供网址和目的地
@@ -85,11 +282,21 @@ func DownloadFile(url string, filename string) error {
 		return nil
 	}
 
+	if utils.Planned(utils.ActionDownload, filename, url) {
+		return nil
+	}
+
 	utils.Logger.InfoF("download %s to %s", url, filename)
 
-	resp, err := HttpClient.Get(url)
+	req, err := http.NewRequestWithContext(Api.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := HttpClient.Do(req)
 	if err != nil {
 		utils.Logger.ErrorF("download: %s err: %v", url, err)
+		metrics.ImageDownload(0, err)
 		return err
 	}
 	defer func(Body io.ReadCloser) {
@@ -101,28 +308,32 @@ func DownloadFile(url string, filename string) error {
 
 	if resp.StatusCode != 200 {
 		utils.Logger.ErrorF("download: %s status code failed: %d", url, resp.StatusCode)
-		return nil
+		err = fmt.Errorf("download status code: %d", resp.StatusCode)
+		metrics.ImageDownload(0, err)
+		return err
 	}
 
-	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	// 先写入临时文件，下载完整后再重命名，避免中断时留下不完整的图片
+	tmpFile := filename + ".tmp"
+	f, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	if err != nil {
-		utils.Logger.ErrorF("download: %s open_file %s err: %v", url, filename, err)
+		utils.Logger.ErrorF("download: %s open_file %s err: %v", url, tmpFile, err)
+		metrics.ImageDownload(0, err)
 		return err
 	}
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
-			utils.Logger.WarningF("download file, close file %s err: %v", filename, err)
-		}
-	}(f)
 
-	_, err = io.Copy(f, resp.Body)
+	size, err := io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	metrics.ImageDownload(size, err)
 	if err != nil {
 		utils.Logger.ErrorF("save content to image: %s err: %v", filename, err)
+		_ = os.Remove(tmpFile)
 		return err
 	}
 
-	return nil
+	return os.Rename(tmpFile, filename)
 }
 
 // 支持 http 和 socks5 代理
@@ -164,3 +375,27 @@ func getHttpClient(proxyConnect string) *http.Client {
 
 	return http.DefaultClient
 }
+
+// 规范化请求：路径加上排序后的参数，去掉 api_key，用于录制回放和返回缓存
+func requestKey(u *url.URL) string {
+	query := u.Query()
+	query.Del("api_key")
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, k+"="+v)
+		}
+	}
+
+	if len(params) == 0 {
+		return u.Path
+	}
+	return u.Path + "?" + strings.Join(params, "&")
+}
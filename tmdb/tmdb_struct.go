@@ -1,9 +1,22 @@
 package tmdb
 
+import (
+	"context"
+	"time"
+)
+
 type tmdb struct {
-	apiHost   string
-	apiKey    string
-	imageHost string
-	language  string
-	rating    string
+	ctx         context.Context // 取消后正在进行的请求会立即中断
+	apiHost     string
+	apiKey      string
+	accessToken string
+	imageHost   string
+	language    string
+	fallback    []string // 字段为空时按顺序使用的其他语言
+	rating      string
+	limiter     *limiter
+	retries     int
+	backoff     time.Duration // 第一次重试前等待的时间，之后每次翻倍
+	cache       *responseCache
+	threshold   float64 // 搜索结果的匹配度阈值，低于阈值的需要人工确认
 }
@@ -1 +1,316 @@
 package tmdb
+
+import (
+	"context"
+	"errors"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	utils.InitLogger(utils.LogModeStdout, int(utils.FATAL), "")
+	m.Run()
+}
+
+func newTestTmdb(handler http.HandlerFunc) (*tmdb, func()) {
+	server := httptest.NewServer(handler)
+	HttpClient = server.Client()
+	return &tmdb{
+		ctx:     context.Background(),
+		apiHost: server.URL,
+		limiter: newLimiter(-1, 0),
+		retries: 2,
+		backoff: time.Millisecond,
+	}, server.Close
+}
+
+func TestRequestStatus(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusUnauthorized, `{"status_code":7,"status_message":"Invalid API key"}`, ErrUnauthorized},
+		{http.StatusNotFound, `{"status_code":34,"status_message":"not found"}`, ErrNotFound},
+		{http.StatusTooManyRequests, `{"status_code":25,"status_message":"limit"}`, ErrRateLimited},
+	}
+
+	for _, item := range cases {
+		requests := 0
+		api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(item.status)
+			_, _ = w.Write([]byte(item.body))
+		})
+
+		_, err := api.request("/3/movie/1", nil)
+		closeFn()
+		if !errors.Is(err, item.want) {
+			t.Errorf("status %d want %v, give %v", item.status, item.want, err)
+		}
+
+		var apiErr *ApiError
+		if !errors.As(err, &apiErr) || apiErr.StatusMessage == "" {
+			t.Errorf("status %d want ApiError with message, give %v", item.status, err)
+		}
+
+		wantRequests := 1
+		if item.status == http.StatusTooManyRequests {
+			wantRequests = 3
+		}
+		if requests != wantRequests {
+			t.Errorf("status %d want %d requests, give %d", item.status, wantRequests, requests)
+		}
+	}
+}
+
+func TestRequestRetry(t *testing.T) {
+	requests := 0
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":1}`))
+	})
+	defer closeFn()
+
+	body, err := api.request("/3/movie/1", nil)
+	if err != nil || string(body) != `{"id":1}` || requests != 3 {
+		t.Errorf("want success after 3 requests, give %s %v %d", body, err, requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if give := parseRetryAfter("3"); give != time.Second*3 {
+		t.Errorf("parseRetryAfter(3) give %s", give)
+	}
+	if give := parseRetryAfter(""); give != time.Second {
+		t.Errorf("parseRetryAfter() give %s", give)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if give := parseRetryAfter(date); give <= time.Second*50 || give > time.Minute {
+		t.Errorf("parseRetryAfter(%s) give %s", date, give)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(10, 2)
+	if l.reserve() != 0 || l.reserve() != 0 {
+		t.Errorf("burst tokens should be available")
+	}
+	if give := l.reserve(); give <= 0 || give > time.Millisecond*100 {
+		t.Errorf("third reserve want wait about 100ms, give %s", give)
+	}
+
+	l.pause(time.Second)
+	if give := l.reserve(); give <= time.Millisecond*900 {
+		t.Errorf("reserve after pause want wait about 1s, give %s", give)
+	}
+}
+
+func TestRequestAccessToken(t *testing.T) {
+	var auth, query string
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		query = r.URL.RawQuery
+		_, _ = w.Write([]byte(`{}`))
+	})
+	defer closeFn()
+
+	api.apiKey = "key"
+	api.accessToken = "token"
+	if _, err := api.request("/3/movie/1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer token" || strings.Contains(query, "api_key") {
+		t.Errorf("want bearer token without api_key, give %s %s", auth, query)
+	}
+
+	api.accessToken = ""
+	if _, err := api.request("/3/movie/1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "" || !strings.Contains(query, "api_key=key") {
+		t.Errorf("want api_key without bearer token, give %s %s", auth, query)
+	}
+}
+
+// 使用 testdata/fixtures 中的返回，按录制格式手工整理，只保留测试用到的字段和条目，数值不是真实数据
+// TMDB 返回变化后可以用 fixtures_mode record 重新录制替换
+func newReplayTmdb() *tmdb {
+	HttpClient = &http.Client{
+		Transport: newFixtureTransport(FixturesReplay, "testdata/fixtures", "https://api.themoviedb.org", nil),
+	}
+	return &tmdb{
+		ctx:       context.Background(),
+		apiHost:   "https://api.themoviedb.org",
+		apiKey:    "key",
+		language:  "zh-CN",
+		limiter:   newLimiter(-1, 0),
+		retries:   2,
+		backoff:   time.Millisecond,
+		threshold: defaultMatchThreshold,
+	}
+}
+
+func TestFixtureRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"status_code":34,"status_message":"not found"}`))
+	}))
+	defer server.Close()
+
+	HttpClient = &http.Client{Transport: newFixtureTransport(FixturesRecord, dir, server.URL, nil)}
+	api := &tmdb{ctx: context.Background(), apiHost: server.URL, apiKey: "secret", language: "zh-CN", limiter: newLimiter(-1, 0)}
+	if _, err := api.request("/3/movie/1", map[string]string{"b": "2", "a": "1"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("record want ErrNotFound, give %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "3_movie_1_*.json"))
+	if len(files) != 1 {
+		t.Fatalf("want 1 fixture file, give %v", files)
+	}
+	content, _ := os.ReadFile(files[0])
+	if strings.Contains(string(content), "secret") || !strings.Contains(string(content), `"request": "/3/movie/1?a=1&b=2&language=zh-CN"`) {
+		t.Errorf("fixture should be normalized without api_key, give %s", content)
+	}
+
+	// 回放时不请求服务端，参数顺序和 api_key 不影响
+	server.Close()
+	HttpClient = &http.Client{Transport: newFixtureTransport(FixturesReplay, dir, server.URL, nil)}
+	api.apiKey = "other"
+	_, err := api.request("/3/movie/1", map[string]string{"a": "1", "b": "2"})
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) || apiErr.HttpStatus != http.StatusNotFound || apiErr.StatusCode != 34 {
+		t.Errorf("replay want recorded 404, give %v", err)
+	}
+
+	if _, err = api.request("/3/movie/2", nil); !errors.Is(err, ErrFixtureMissing) {
+		t.Errorf("replay miss want ErrFixtureMissing, give %v", err)
+	}
+}
+
+func TestRequestResponseCache(t *testing.T) {
+	requests, notModified := 0, 0
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		_, _ = w.Write([]byte(`{"id":1396}`))
+	})
+	defer closeFn()
+	api.cache = newResponseCache(t.TempDir(), 0)
+
+	// 有效期内的第二次请求不会发出，api_key 不影响缓存
+	for _, key := range []string{"a", "b"} {
+		api.apiKey = key
+		body, err := api.request("/3/tv/1396", nil)
+		if err != nil || string(body) != `{"id":1396}` {
+			t.Fatalf("request want cached body, give %s %v", body, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("want 1 request within max-age, give %d", requests)
+	}
+
+	// 过期后使用 ETag 重新验证
+	u, _ := url.Parse(api.apiHost + "/3/tv/1396?language=")
+	entry := api.cache.get(requestKey(u))
+	if entry == nil {
+		t.Fatal("response should be cached")
+	}
+	entry.Expires = time.Now().Add(-time.Second)
+	api.cache.save(entry)
+
+	body, err := api.request("/3/tv/1396", nil)
+	if err != nil || string(body) != `{"id":1396}` || requests != 2 || notModified != 1 {
+		t.Errorf("want 304 revalidation, give %s %v %d %d", body, err, requests, notModified)
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	cases := []struct {
+		value  string
+		maxAge time.Duration
+		store  bool
+	}{
+		{"public, max-age=28800", time.Hour * 8, true},
+		{"", 0, true},
+		{"max-age=60, no-cache", 0, true},
+		{"no-store", 0, false},
+	}
+	for _, item := range cases {
+		maxAge, store := parseCacheControl(item.value)
+		if maxAge != item.maxAge || store != item.store {
+			t.Errorf("parseCacheControl(%s) give %s %v, want %s %v", item.value, maxAge, store, item.maxAge, item.store)
+		}
+	}
+}
+
+func TestResponseCachePrune(t *testing.T) {
+	cache := newResponseCache(t.TempDir(), time.Hour*24)
+	old := time.Now().Add(-time.Hour * 48)
+
+	// 过期很久的删除，最近写入的和还在有效期内的保留
+	cache.save(&cacheEntry{Request: "/3/tv/1?language=en-US", Expires: old, Body: []byte(`{}`)})
+	cache.save(&cacheEntry{Request: "/3/tv/2?language=en-US", Expires: old, Body: []byte(`{}`)})
+	cache.save(&cacheEntry{Request: "/3/tv/3?language=en-US", Expires: time.Now().Add(time.Hour), Body: []byte(`{}`)})
+	for _, key := range []string{"/3/tv/1?language=en-US", "/3/tv/3?language=en-US"} {
+		_ = os.Chtimes(cache.file(key), old, old)
+	}
+
+	if count := cache.prune(); count != 1 {
+		t.Errorf("prune want 1, give %d", count)
+	}
+	if cache.get("/3/tv/1?language=en-US") != nil {
+		t.Errorf("stale entry should be pruned")
+	}
+	if cache.get("/3/tv/2?language=en-US") == nil || cache.get("/3/tv/3?language=en-US") == nil {
+		t.Errorf("recent and fresh entries should be kept")
+	}
+
+	if count := newResponseCache(cache.dir, 0).prune(); count != 0 {
+		t.Errorf("prune without ttl want 0, give %d", count)
+	}
+}
+
+func TestDownloadFileStatus(t *testing.T) {
+	api, closeFn := newTestTmdb(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("image"))
+	})
+	defer closeFn()
+	Api = api
+	defer func() { Api = nil }()
+
+	dir := t.TempDir()
+	if err := DownloadFile(api.apiHost+"/missing.jpg", filepath.Join(dir, "missing.jpg")); err == nil {
+		t.Errorf("download 404 want error")
+	}
+	if utils.FileExist(filepath.Join(dir, "missing.jpg")) {
+		t.Errorf("download 404 want no file")
+	}
+	if err := DownloadFile(api.apiHost+"/ok.jpg", filepath.Join(dir, "ok.jpg")); err != nil || !utils.FileExist(filepath.Join(dir, "ok.jpg")) {
+		t.Errorf("download 200 want file, give %v", err)
+	}
+}
@@ -52,6 +52,8 @@ type TvDetail struct {
 	ContentRatings       *TvContentRatings     `json:"content_ratings"`
 	TvEpisodeGroupDetail *TvEpisodeGroupDetail `json:"tv_episode_group_detail"`
 	Images               *TvImages             `json:"images"`
+	ExternalIds          *ExternalIds          `json:"external_ids"`
+	Translations         *TranslationsResponse `json:"translations,omitempty"`
 	FromCache            bool                  `json:"from_cache"`
 }
 
@@ -151,7 +153,7 @@ func (t *tmdb) GetTvDetail(id int) (*TvDetail, error) {
 
 	api := fmt.Sprintf(ApiTvDetail, id)
 	req := map[string]string{
-		"append_to_response":     "aggregate_credits,content_ratings,images",
+		"append_to_response":     t.withTranslations("aggregate_credits,content_ratings,images,external_ids"),
 		"include_image_language": "zh,en,null",
 	}
 
@@ -168,6 +170,11 @@ func (t *tmdb) GetTvDetail(id int) (*TvDetail, error) {
 		return nil, err
 	}
 
+	t.localize(tvResp.Translations, &tvResp.Name, translationName)
+	t.localize(tvResp.Translations, &tvResp.Overview, translationOverview)
+	t.localize(tvResp.Translations, &tvResp.Tagline, translationTagline)
+	tvResp.Translations = nil
+
 	return tvResp, err
 }
 
@@ -188,6 +195,10 @@ func (d *TvDetail) SaveToCache(file string) {
 
 	utils.Logger.InfoF("save tv detail to: %s", file)
 
+	if utils.Planned(utils.ActionWriteCache, file, "") {
+		return
+	}
+
 	f, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	if err != nil {
 		utils.Logger.ErrorF("save tv to cache, open_file err: %v", err)
@@ -14,19 +14,22 @@ type TvEpisodeRequest struct {
 }
 
 type TvEpisodeDetail struct {
-	AirDate        string       `json:"air_date"`
-	Crew           []Crew       `json:"crew"`
-	GuestStars     []GuestStars `json:"guest_stars"`
-	Name           string       `json:"name"`
-	Overview       string       `json:"overview"`
-	Id             int          `json:"id"`
-	ProductionCode string       `json:"production_code"`
-	SeasonNumber   int          `json:"season_number"`
-	EpisodeNumber  int          `json:"episode_number"`
-	StillPath      string       `json:"still_path"`
-	VoteAverage    float32      `json:"vote_average"`
-	VoteCount      int          `json:"vote_count"`
-	FromCache      bool         `json:"from_cache"`
+	AirDate        string                `json:"air_date"`
+	Crew           []Crew                `json:"crew"`
+	GuestStars     []GuestStars          `json:"guest_stars"`
+	Name           string                `json:"name"`
+	Overview       string                `json:"overview"`
+	Id             int                   `json:"id"`
+	ProductionCode string                `json:"production_code"`
+	SeasonNumber   int                   `json:"season_number"`
+	EpisodeNumber  int                   `json:"episode_number"`
+	StillPath      string                `json:"still_path"`
+	VoteAverage    float32               `json:"vote_average"`
+	VoteCount      int                   `json:"vote_count"`
+	Runtime        int                   `json:"runtime"`
+	ExternalIds    *ExternalIds          `json:"external_ids"`
+	Translations   *TranslationsResponse `json:"translations,omitempty"`
+	FromCache      bool                  `json:"from_cache"`
 }
 
 type Crew struct {
@@ -56,7 +59,7 @@ func (t *tmdb) GetTvEpisodeDetail(tvId, season, episode int) (*TvEpisodeDetail,
 
 	api := fmt.Sprintf(ApiTvEpisode, tvId, season, episode)
 	req := map[string]string{
-		"append_to_response": "",
+		"append_to_response": t.withTranslations("external_ids"),
 	}
 
 	body, err := t.request(api, req)
@@ -72,6 +75,10 @@ func (t *tmdb) GetTvEpisodeDetail(tvId, season, episode int) (*TvEpisodeDetail,
 		return nil, err
 	}
 
+	t.localize(tvResp.Translations, &tvResp.Name, translationName)
+	t.localize(tvResp.Translations, &tvResp.Overview, translationOverview)
+	tvResp.Translations = nil
+
 	return tvResp, err
 }
 
@@ -92,6 +99,10 @@ func (d *TvEpisodeDetail) SaveToCache(file string) {
 
 	utils.Logger.InfoF("save episode detail to: %s", file)
 
+	if utils.Planned(utils.ActionWriteCache, file, "") {
+		return
+	}
+
 	f, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	if err != nil {
 		utils.Logger.ErrorF("save to episode file: %s err: %v", file, err)
@@ -99,6 +99,10 @@ func (d TvEpisodeGroupDetail) SaveToCache(file string) {
 
 	utils.Logger.InfoF("save tv episode group detail to: %s", file)
 
+	if utils.Planned(utils.ActionWriteCache, file, "") {
+		return
+	}
+
 	f, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	if err != nil {
 		utils.Logger.ErrorF("save tv episode group detail to cache, open_file err: %v", err)
@@ -0,0 +1,137 @@
+package tmdb
+
+import (
+	"encoding/json"
+	"fengqi/kodi-metadata-tmdb-cli/utils"
+	"fmt"
+)
+
+// TvSeasonDetail 整季的详情，包含这一季所有分集的信息
+type TvSeasonDetail struct {
+	Id           int               `json:"id"`
+	AirDate      string            `json:"air_date"`
+	Name         string            `json:"name"`
+	Overview     string            `json:"overview"`
+	PosterPath   string            `json:"poster_path"`
+	SeasonNumber int               `json:"season_number"`
+	VoteAverage  float32           `json:"vote_average"`
+	Episodes     []TvEpisodeDetail `json:"episodes"`
+	Credits      *TvSeasonCredits  `json:"credits"`
+	Images       *TvImages         `json:"images"`
+	FromCache    bool              `json:"from_cache"`
+	Updated      bool              `json:"-"` // 分集补充了外部id，需要重新写入缓存
+}
+
+// TvSeasonCredits 这一季的演职人员，演员和分集的客串演员字段相同
+type TvSeasonCredits struct {
+	Cast []GuestStars `json:"cast"`
+	Crew []Crew       `json:"crew"`
+}
+
+func (t *tmdb) GetTvSeasonDetail(tvId, season int) (*TvSeasonDetail, error) {
+	utils.Logger.DebugF("get tv season detail from tmdb: %d %d", tvId, season)
+
+	if tvId <= 0 || season <= 0 {
+		return nil, nil
+	}
+
+	api := fmt.Sprintf(ApiTvSeason, tvId, season)
+	req := map[string]string{
+		"append_to_response":     "credits,images",
+		"include_image_language": "zh,en,null",
+	}
+
+	body, err := t.request(api, req)
+	if err != nil {
+		utils.Logger.ErrorF("read tmdb response: %s err: %v", api, err)
+		return nil, err
+	}
+
+	seasonResp := &TvSeasonDetail{}
+	err = json.Unmarshal(body, seasonResp)
+	if err != nil {
+		utils.Logger.ErrorF("parse tmdb response: %s err: %v", api, err)
+		return nil, err
+	}
+
+	t.localizeSeason(seasonResp, tvId)
+
+	return seasonResp, err
+}
+
+// GetEpisode 获取这一季中的单集，没有时返回nil
+func (d *TvSeasonDetail) GetEpisode(episode int) *TvEpisodeDetail {
+	if d == nil {
+		return nil
+	}
+
+	for i := range d.Episodes {
+		if d.Episodes[i].EpisodeNumber == episode && d.Episodes[i].Id > 0 {
+			detail := d.Episodes[i]
+			detail.FromCache = d.FromCache
+			return &detail
+		}
+	}
+
+	return nil
+}
+
+// SetEpisodeExternalIds 保存单独获取的分集外部id，下次从缓存读取时不再请求
+func (d *TvSeasonDetail) SetEpisodeExternalIds(episode int, ids *ExternalIds) {
+	if d == nil || ids == nil {
+		return
+	}
+
+	for i := range d.Episodes {
+		if d.Episodes[i].EpisodeNumber == episode {
+			d.Episodes[i].ExternalIds = ids
+			d.Updated = true
+		}
+	}
+}
+
+// KeepEpisodeExternalIds 重新获取整季后保留旧缓存中已经获取的分集外部id，避免每次刷新都逐集请求
+func (d *TvSeasonDetail) KeepEpisodeExternalIds(old *TvSeasonDetail) {
+	if d == nil || old == nil {
+		return
+	}
+
+	for i := range d.Episodes {
+		if d.Episodes[i].ExternalIds != nil {
+			continue
+		}
+		if episode := old.GetEpisode(d.Episodes[i].EpisodeNumber); episode != nil && episode.Id == d.Episodes[i].Id {
+			d.Episodes[i].ExternalIds = episode.ExternalIds
+		}
+	}
+}
+
+// LastAirDate 这一季最后一集的播出时间，用于判断缓存是否过期
+func (d *TvSeasonDetail) LastAirDate() string {
+	airDate := d.AirDate
+	for _, episode := range d.Episodes {
+		if episode.AirDate > airDate {
+			airDate = episode.AirDate
+		}
+	}
+	return airDate
+}
+
+// SaveToCache 保存整季详情到文件
+func (d *TvSeasonDetail) SaveToCache(file string) {
+	if d.Id == 0 || len(d.Episodes) == 0 {
+		return
+	}
+
+	utils.Logger.InfoF("save season detail to: %s", file)
+
+	bytes, err := json.MarshalIndent(d, "", "    ")
+	if err != nil {
+		utils.Logger.ErrorF("save to season, marshal err: %v", err)
+		return
+	}
+
+	if err = utils.WriteFile(utils.ActionWriteCache, file, bytes, 0644); err != nil {
+		utils.Logger.ErrorF("save to season file: %s err: %v", file, err)
+	}
+}
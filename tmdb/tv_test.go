@@ -1 +1,59 @@
 package tmdb
+
+import "testing"
+
+func TestGetTvDetail(t *testing.T) {
+	api := newReplayTmdb()
+
+	detail, err := api.GetTvDetail(1396)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.Id != 1396 || detail.Name != "绝命毒师" || detail.NumberOfSeasons != 5 || len(detail.Seasons) != 5 {
+		t.Errorf("GetTvDetail want 绝命毒师 with 5 seasons, give %+v", detail)
+	}
+	if detail.AggregateCredits == nil || len(detail.AggregateCredits.Cast) != 1 || detail.AggregateCredits.Cast[0].Name != "Bryan Cranston" {
+		t.Errorf("GetTvDetail want aggregate credits, give %+v", detail.AggregateCredits)
+	}
+	if detail.ExternalIds.GetImdbId() != "tt0903747" || detail.ExternalIds.GetTvdbId() != 81189 {
+		t.Errorf("GetTvDetail want external ids, give %+v", detail.ExternalIds)
+	}
+}
+
+func TestGetTvSeasonDetail(t *testing.T) {
+	api := newReplayTmdb()
+
+	detail, err := api.GetTvSeasonDetail(1396, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.SeasonNumber != 1 || len(detail.Episodes) != 7 || detail.LastAirDate() != "2008-03-09" {
+		t.Errorf("GetTvSeasonDetail want season 1 with 7 episodes, give %+v", detail)
+	}
+	if detail.Credits == nil || len(detail.Credits.Cast) != 1 || detail.Images == nil || len(detail.Images.Posters) != 1 {
+		t.Errorf("GetTvSeasonDetail want credits and images, give %+v %+v", detail.Credits, detail.Images)
+	}
+
+	episode := detail.GetEpisode(2)
+	if episode == nil || episode.Name != "猫在袋子里" || episode.StillPath != "/tjDNvbokPLtEnpFyFPyXMOd6Zr1.jpg" || len(episode.GuestStars) != 1 {
+		t.Errorf("GetEpisode(2) want 猫在袋子里, give %+v", episode)
+	}
+	if detail.GetEpisode(8) != nil {
+		t.Errorf("GetEpisode(8) want nil")
+	}
+
+	refreshed, _ := api.GetTvSeasonDetail(1396, 1)
+	detail.SetEpisodeExternalIds(1, &ExternalIds{ImdbId: "tt0959621", TvdbId: 349232})
+	refreshed.KeepEpisodeExternalIds(detail)
+	if ids := refreshed.GetEpisode(1).ExternalIds; ids == nil || ids.ImdbId != "tt0959621" {
+		t.Errorf("KeepEpisodeExternalIds want tt0959621, give %+v", ids)
+	}
+	if refreshed.GetEpisode(2).ExternalIds != nil {
+		t.Errorf("KeepEpisodeExternalIds episode 2 want nil")
+	}
+
+	var empty *TvSeasonDetail
+	if empty.GetEpisode(1) != nil {
+		t.Errorf("nil season GetEpisode want nil")
+	}
+}
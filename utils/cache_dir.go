@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 统一缓存目录下的分类
+const (
+	CacheKindMovies      = "movies"
+	CacheKindShows       = "shows"
+	CacheKindMusicVideos = "music_videos"
+)
+
+// CacheRoot 统一的刮削信息缓存目录，为空时使用每个条目下的 tmdb 目录
+var CacheRoot string
+
+// CacheItem 统一缓存目录中的 item.json，记录目录对应的条目路径和TMDB id，方便人工查找和清理
+type CacheItem struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	TmdbId int    `json:"tmdb_id,omitempty"`
+}
+
+// CacheDir 条目的缓存目录：设置了统一缓存目录时为 <cache_dir>/<kind>/<路径hash>，否则为 legacy
+func CacheDir(kind, path, legacy string) string {
+	if CacheRoot == "" {
+		return legacy
+	}
+	return centralCacheDir(kind, path)
+}
+
+func centralCacheDir(kind, path string) string {
+	sum := sha1.Sum([]byte(filepath.Clean(path)))
+	return filepath.Join(CacheRoot, kind, hex.EncodeToString(sum[:8]))
+}
+
+// SaveCacheItem 在统一缓存目录中记录条目的路径和TMDB id，tmdbId 为0时保留已经记录的id，没有使用统一缓存目录时不处理
+func SaveCacheItem(kind, path string, tmdbId int) {
+	if CacheRoot == "" {
+		return
+	}
+
+	file := filepath.Join(centralCacheDir(kind, path), "item.json")
+	item := &CacheItem{Kind: kind, Path: filepath.Clean(path), TmdbId: tmdbId}
+	old := &CacheItem{}
+	if bytes, err := os.ReadFile(file); err == nil && json.Unmarshal(bytes, old) == nil {
+		if item.TmdbId == 0 {
+			item.TmdbId = old.TmdbId
+		}
+		if *old == *item {
+			return
+		}
+	}
+
+	bytes, _ := json.MarshalIndent(item, "", "    ")
+	if err := WriteFile(ActionWriteCache, file, bytes, 0644); err != nil {
+		Logger.WarningF("save cache item: %s err: %v", file, err)
+	}
+}
+
+// MoveCacheDir 条目移动到新的路径后，统一缓存目录跟着移动，没有使用统一缓存目录时不处理
+func MoveCacheDir(kind, oldPath, newPath string) error {
+	if CacheRoot == "" {
+		return nil
+	}
+
+	oldDir, newDir := centralCacheDir(kind, oldPath), centralCacheDir(kind, newPath)
+	if oldDir == newDir || !FileExist(oldDir) {
+		return nil
+	}
+
+	if err := RemoveAll(newDir); err != nil {
+		return err
+	}
+	if err := Rename(oldDir, newDir); err != nil {
+		return err
+	}
+	SaveCacheItem(kind, newPath, 0)
+
+	return nil
+}
+
+// RelinkCacheDir 条目改名或者移动后按路径hash找不到原来的统一缓存目录，把记录的TMDB id相同、原路径已经不存在的缓存目录关联到新的路径，
+// 只有一个符合时才关联；原路径所在的媒体库根目录（roots）不存在或者为空（网盘没有挂载）时不算原路径不存在，
+// 新的缓存目录中已经有的文件保留，返回是否关联成功
+func RelinkCacheDir(kind, path string, tmdbId int, roots []string) bool {
+	if CacheRoot == "" || tmdbId <= 0 {
+		return false
+	}
+
+	orphan := findOrphanCacheDir(kind, path, tmdbId, roots)
+	if orphan == "" {
+		return false
+	}
+
+	// 演习模式下只记录，继续按没有缓存处理
+	target := centralCacheDir(kind, path)
+	if Planned(ActionRelinkCache, target, orphan) {
+		return false
+	}
+
+	if !FileExist(target) {
+		if err := Rename(orphan, target); err != nil {
+			Logger.WarningF("relink cache dir: %s to %s err: %v", orphan, target, err)
+			return false
+		}
+	} else {
+		entries, err := os.ReadDir(orphan)
+		if err != nil {
+			return false
+		}
+		for _, entry := range entries {
+			file := filepath.Join(target, entry.Name())
+			if FileExist(file) {
+				continue
+			}
+			if err = moveFile(filepath.Join(orphan, entry.Name()), file); err != nil {
+				Logger.WarningF("relink cache file: %s to %s err: %v", entry.Name(), target, err)
+				return false
+			}
+		}
+		_ = RemoveAll(orphan)
+	}
+
+	Logger.InfoF("relink cache dir: %s to %s", orphan, path)
+	SaveCacheItem(kind, path, tmdbId)
+	return true
+}
+
+// 查找记录的TMDB id相同、原路径已经不存在的缓存目录，没有或者有多个符合时返回空
+func findOrphanCacheDir(kind, path string, tmdbId int, roots []string) string {
+	entries, err := os.ReadDir(filepath.Join(CacheRoot, kind))
+	if err != nil {
+		return ""
+	}
+
+	target := centralCacheDir(kind, path)
+	found := make([]string, 0)
+	for _, entry := range entries {
+		dir := filepath.Join(CacheRoot, kind, entry.Name())
+		if !entry.IsDir() || dir == target {
+			continue
+		}
+
+		item := &CacheItem{}
+		bytes, err := os.ReadFile(filepath.Join(dir, "item.json"))
+		if err != nil || json.Unmarshal(bytes, item) != nil || item.TmdbId != tmdbId || item.Path == "" || FileExist(item.Path) {
+			continue
+		}
+		if !libraryOnline(InDirs(item.Path, roots)) {
+			continue
+		}
+
+		found = append(found, dir)
+	}
+
+	if len(found) != 1 {
+		return ""
+	}
+	return found[0]
+}
+
+// 媒体库根目录存在并且不为空，网盘没有挂载时挂载点一般是空目录
+func libraryOnline(root string) bool {
+	if root == "" {
+		return false
+	}
+
+	entries, err := os.ReadDir(root)
+	return err == nil && len(entries) > 0
+}
+
+// MigrateCacheDir 把 root 下各个条目的 tmdb 目录移动到统一缓存目录，每个 tmdb 目录处理完成后调用 fn
+// 所在目录作为条目的路径，单文件电影的缓存文件以视频文件名开头，按文件分开存放
+func MigrateCacheDir(kind, root string, fn func(name string, migrated bool, err error)) {
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fn(path, false, err)
+			return nil
+		}
+		if !d.IsDir() || path == filepath.Clean(CacheRoot) {
+			return nil
+		}
+		if d.Name() != "tmdb" {
+			return nil
+		}
+
+		migrated, err := migrateTmdbDir(kind, path)
+		fn(filepath.Dir(path), migrated, err)
+		return filepath.SkipDir
+	})
+}
+
+// 移动单个 tmdb 目录的内容，统一缓存目录中已经存在的文件保留，全部移走后删除 tmdb 目录
+func migrateTmdbDir(kind, dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+
+	parent := filepath.Dir(dir)
+	videos := make([]string, 0)
+	if kind == CacheKindMovies {
+		siblings, _ := os.ReadDir(parent)
+		for _, item := range siblings {
+			if !item.IsDir() && IsVideo(item.Name()) != "" {
+				videos = append(videos, item.Name())
+			}
+		}
+	}
+
+	moved := 0
+	for _, entry := range entries {
+		// 单文件电影：<文件名>.movie.json、<文件名>.override.json 等，更早的版本为 <不带后缀的文件名>/id.txt
+		owner := parent
+		for _, video := range videos {
+			if strings.HasPrefix(entry.Name(), video+".") || entry.Name() == strings.TrimSuffix(video, filepath.Ext(video)) {
+				owner = filepath.Join(parent, video)
+				break
+			}
+		}
+
+		target := filepath.Join(centralCacheDir(kind, owner), entry.Name())
+		if FileExist(target) {
+			continue
+		}
+		if err = MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return moved > 0, err
+		}
+		if err = moveFile(filepath.Join(dir, entry.Name()), target); err != nil {
+			return moved > 0, err
+		}
+		SaveCacheItem(kind, owner, 0)
+		moved++
+	}
+
+	if moved == len(entries) {
+		_ = Remove(dir)
+	}
+
+	return moved > 0, nil
+}
+
+// 移动文件或目录，统一缓存目录通常和媒体文件不在同一个设备上，重命名失败时复制后删除
+func moveFile(src, dst string) error {
+	if err := Rename(src, dst); err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if err = MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err = moveFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return Remove(src)
+	}
+
+	bytes, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err = WriteFile(ActionWriteCache, dst, bytes, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return Remove(src)
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheDir(t *testing.T) {
+	defer func(root string) { CacheRoot = root }(CacheRoot)
+
+	CacheRoot = ""
+	if give := CacheDir(CacheKindMovies, "/movies/a", "/movies/a/tmdb"); give != "/movies/a/tmdb" {
+		t.Errorf("CacheDir without cache root give %s", give)
+	}
+
+	CacheRoot = "/cache"
+	a := CacheDir(CacheKindMovies, "/movies/a", "/movies/a/tmdb")
+	if filepath.Dir(a) != "/cache/movies" || CacheDir(CacheKindMovies, "/movies/a/", "") != a {
+		t.Errorf("CacheDir with cache root give %s", a)
+	}
+	if CacheDir(CacheKindMovies, "/movies/b", "") == a {
+		t.Errorf("CacheDir want different dir for different path")
+	}
+	if give := CacheDir(CacheKindShows, "/movies/a", ""); filepath.Dir(give) != "/cache/shows" {
+		t.Errorf("CacheDir with kind shows give %s", give)
+	}
+}
+
+func TestMigrateCacheDir(t *testing.T) {
+	defer func(root string) { CacheRoot = root }(CacheRoot)
+
+	library := t.TempDir()
+	CacheRoot = t.TempDir()
+
+	// 电影目录和单文件电影
+	files := map[string]string{
+		"Fortress.2021/a.mkv":               "",
+		"Fortress.2021/tmdb/movie.json":     `{"id":42}`,
+		"Fortress.2021/tmdb/id.txt":         "42",
+		"Nope.2020.mkv":                     "",
+		"tmdb/Nope.2020.mkv.movie.json":     `{"id":7}`,
+		"tmdb/Nope.2020/id.txt":             "7",
+		"Other.2019.mkv":                    "",
+		"tmdb/Other.2019.mkv.override.json": `{"id":8}`,
+	}
+	for name, content := range files {
+		file := filepath.Join(library, name)
+		_ = os.MkdirAll(filepath.Dir(file), 0755)
+		_ = os.WriteFile(file, []byte(content), 0644)
+	}
+
+	migrated := make([]string, 0)
+	MigrateCacheDir(CacheKindMovies, library, func(name string, ok bool, err error) {
+		if err != nil {
+			t.Errorf("migrate %s err: %v", name, err)
+		}
+		if ok {
+			migrated = append(migrated, name)
+		}
+	})
+	if len(migrated) != 2 {
+		t.Errorf("migrate want 2 tmdb dirs, give %v", migrated)
+	}
+
+	want := []string{
+		filepath.Join(CacheDir(CacheKindMovies, filepath.Join(library, "Fortress.2021"), ""), "movie.json"),
+		filepath.Join(CacheDir(CacheKindMovies, filepath.Join(library, "Fortress.2021"), ""), "id.txt"),
+		filepath.Join(CacheDir(CacheKindMovies, filepath.Join(library, "Nope.2020.mkv"), ""), "Nope.2020.mkv.movie.json"),
+		filepath.Join(CacheDir(CacheKindMovies, filepath.Join(library, "Nope.2020.mkv"), ""), "Nope.2020", "id.txt"),
+		filepath.Join(CacheDir(CacheKindMovies, filepath.Join(library, "Other.2019.mkv"), ""), "Other.2019.mkv.override.json"),
+		filepath.Join(CacheDir(CacheKindMovies, filepath.Join(library, "Other.2019.mkv"), ""), "item.json"),
+	}
+	for _, file := range want {
+		if !FileExist(file) {
+			t.Errorf("migrated file not found: %s", file)
+		}
+	}
+	if FileExist(filepath.Join(library, "tmdb")) || FileExist(filepath.Join(library, "Fortress.2021", "tmdb")) {
+		t.Errorf("legacy tmdb dirs want removed")
+	}
+}
+
+func TestRelinkCacheDir(t *testing.T) {
+	defer func(root string) { CacheRoot = root }(CacheRoot)
+	if Logger == nil {
+		InitLogger(LogModeStdout, int(FATAL), "")
+	}
+
+	library := t.TempDir()
+	CacheRoot = t.TempDir()
+	save := func(path string, tmdbId int, files ...string) {
+		_ = os.MkdirAll(path, 0755)
+		_ = os.MkdirAll(CacheDir(CacheKindShows, path, ""), 0755)
+		for _, file := range files {
+			_ = os.WriteFile(filepath.Join(CacheDir(CacheKindShows, path, ""), file), []byte(file), 0644)
+		}
+		SaveCacheItem(CacheKindShows, path, tmdbId)
+	}
+
+	roots := []string{library}
+
+	// 原路径还存在的不会被关联
+	save(filepath.Join(library, "a", "Breaking.Bad"), 1396, "tv.json")
+	if RelinkCacheDir(CacheKindShows, filepath.Join(library, "b", "Breaking.Bad"), 1396, roots) {
+		t.Errorf("relink want false when origin path exists")
+	}
+
+	// 媒体库根目录不存在或者为空（网盘没有挂载）时原路径不算不存在
+	_ = os.RemoveAll(filepath.Join(library, "a"))
+	moved := filepath.Join(library, "b", "Breaking.Bad")
+	_ = os.MkdirAll(moved, 0755)
+	if RelinkCacheDir(CacheKindShows, moved, 1396, []string{filepath.Join(library, "offline")}) {
+		t.Errorf("relink want false when library root is offline")
+	}
+	if RelinkCacheDir(CacheKindShows, moved, 0, roots) {
+		t.Errorf("relink want false without tmdb id")
+	}
+
+	// 移动到其他目录后按TMDB id关联，整个目录移动过去
+	if !RelinkCacheDir(CacheKindShows, moved, 1396, roots) || !FileExist(filepath.Join(CacheDir(CacheKindShows, moved, ""), "tv.json")) {
+		t.Errorf("relink by tmdb id want tv.json moved")
+	}
+	if FileExist(CacheDir(CacheKindShows, filepath.Join(library, "a", "Breaking.Bad"), "")) {
+		t.Errorf("relinked cache dir want removed")
+	}
+
+	// 改名后按TMDB id关联，新目录中已有的文件保留
+	_ = os.RemoveAll(moved)
+	renamed := filepath.Join(library, "b", "绝命毒师")
+	save(renamed, 0, "override.json")
+	if RelinkCacheDir(CacheKindShows, renamed, 42, roots) {
+		t.Errorf("relink want false for other tmdb id")
+	}
+	if !RelinkCacheDir(CacheKindShows, renamed, 1396, roots) {
+		t.Fatalf("relink by tmdb id want true")
+	}
+	for _, file := range []string{"tv.json", "override.json"} {
+		if !FileExist(filepath.Join(CacheDir(CacheKindShows, renamed, ""), file)) {
+			t.Errorf("relink by tmdb id want %s", file)
+		}
+	}
+	if FileExist(CacheDir(CacheKindShows, moved, "")) {
+		t.Errorf("merged cache dir want removed")
+	}
+
+	CacheRoot = ""
+	if RelinkCacheDir(CacheKindShows, renamed, 1396, roots) {
+		t.Errorf("relink without cache root want false")
+	}
+}
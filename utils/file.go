@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 func IsDir(dir string) bool {
@@ -26,7 +28,23 @@ func FileExist(file string) bool {
 	return false
 }
 
+// InDirs 路径是否位于某个目录下（包括目录本身），返回匹配到的目录
+func InDirs(path string, dirs []string) string {
+	path = filepath.Clean(path)
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return dir
+		}
+	}
+	return ""
+}
+
 func CopyFile(dstName, srcName string) (writeen int64, err error) {
+	if Planned(ActionCopy, srcName, dstName) {
+		return 1, nil
+	}
+
 	src, err := os.Open(dstName)
 	if err != nil {
 		fmt.Println(err)
@@ -43,3 +61,51 @@ func CopyFile(dstName, srcName string) (writeen int64, err error) {
 
 	return io.Copy(dst, src)
 }
+
+// WriteFile 写入文件，演习模式下按 action 记录
+func WriteFile(action, file string, data []byte, perm os.FileMode) error {
+	if Planned(action, file, "") {
+		return nil
+	}
+	return os.WriteFile(file, data, perm)
+}
+
+// Mkdir 创建目录，演习模式下只记录
+func Mkdir(dir string, perm os.FileMode) error {
+	if Planned(ActionMkdir, dir, "") {
+		return nil
+	}
+	return os.Mkdir(dir, perm)
+}
+
+// MkdirAll 递归创建目录，演习模式下只记录
+func MkdirAll(dir string, perm os.FileMode) error {
+	if Planned(ActionMkdir, dir, "") {
+		return nil
+	}
+	return os.MkdirAll(dir, perm)
+}
+
+// Rename 移动文件或目录，演习模式下只记录
+func Rename(oldPath, newPath string) error {
+	if Planned(ActionMove, newPath, oldPath) {
+		return nil
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+// Remove 删除文件或空目录，演习模式下只记录
+func Remove(path string) error {
+	if Planned(ActionRemove, path, "") {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// RemoveAll 递归删除，演习模式下只记录
+func RemoveAll(path string) error {
+	if Planned(ActionRemove, path, "") {
+		return nil
+	}
+	return os.RemoveAll(path)
+}
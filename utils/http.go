@@ -17,3 +17,32 @@ func StringMapToQuery(m map[string]string) string {
 
 	return strings.TrimRight(s, "&")
 }
+
+// 日志中需要隐藏的参数
+var sensitiveParams = []string{"api_key", "access_token", "token", "password"}
+
+// RedactUrl 隐藏网址中的密钥和密码，用于输出日志
+func RedactUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "***")
+	}
+
+	query := u.Query()
+	redacted := false
+	for _, key := range sensitiveParams {
+		if query.Has(key) {
+			query.Set(key, "***")
+			redacted = true
+		}
+	}
+	if redacted {
+		u.RawQuery = query.Encode()
+	}
+
+	return strings.ReplaceAll(u.String(), url.QueryEscape("***"), "***")
+}
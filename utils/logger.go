@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,6 +19,9 @@ const (
 	FATAL
 )
 
+// 保留最近的警告和错误日志条数
+const recentSize = 100
+
 const (
 	LogModeStdout  = 1
 	LogModeLogfile = 2
@@ -36,10 +40,18 @@ var (
 )
 
 type logger struct {
-	level logLevel
-	lock  *sync.Mutex
-	file  *os.File
-	mode  int
+	level  logLevel
+	lock   *sync.Mutex
+	file   *os.File
+	mode   int
+	recent []*LogEntry // 最近的警告和错误日志，供状态接口查看
+}
+
+// LogEntry 单条日志
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
 }
 
 func InitLogger(mode, level int, logFile string) {
@@ -60,6 +72,32 @@ func InitLogger(mode, level int, logFile string) {
 	}
 }
 
+// Recent 最近的警告和错误日志，新的在前
+func (l *logger) Recent() []LogEntry {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	entries := make([]LogEntry, 0, len(l.recent))
+	for i := len(l.recent) - 1; i >= 0; i-- {
+		entries = append(entries, *l.recent[i])
+	}
+	return entries
+}
+
+// Close 刷新并关闭日志文件，退出前调用
+func (l *logger) Close() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.file == nil {
+		return
+	}
+
+	_ = l.file.Sync()
+	_ = l.file.Close()
+	l.file = nil
+}
+
 func (l *logger) Debug(v ...interface{}) {
 	l.print(DEBUG, v...)
 }
@@ -129,13 +167,20 @@ func (l *logger) printf(level logLevel, format string, v ...interface{}) {
 }
 
 func (l *logger) write(level logLevel, str string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if level >= WARNING {
+		l.recent = append(l.recent, &LogEntry{Time: time.Now(), Level: levelMap[level], Message: strings.TrimSpace(str)})
+		if len(l.recent) > recentSize {
+			l.recent = l.recent[len(l.recent)-recentSize:]
+		}
+	}
+
 	if l.file == nil || l.mode == LogModeStdout {
 		return
 	}
 
-	l.lock.Lock()
-	defer l.lock.Unlock()
-
 	// 结尾自动空格
 	if len(str) == 0 || str[len(str)-1] != '\n' {
 		str += "\n"
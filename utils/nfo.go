@@ -3,42 +3,138 @@ package utils
 import (
 	"encoding/xml"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
+// 已有NFO的处理策略
+const (
+	NfoOverwrite = "overwrite" // 直接覆盖
+	NfoBackup    = "backup"    // 不是同一个TMDB条目的NFO先备份为 .bak
+)
+
+// NfoIds 已有NFO中的各种id，TmdbType 为 movie 或 tv，从XML中读取时为空
+type NfoIds struct {
+	Tmdb     int
+	TmdbType string
+	Imdb     string
+	Tvdb     string
+}
+
+// Kodi 格式NFO中可能存放id的节点，不区分 movie、tvshow 等根节点
+type nfoIdXml struct {
+	Id       string `xml:"id"`
+	TmdbId   string `xml:"tmdbid"`
+	ImdbId   string `xml:"imdbid"`
+	TvdbId   string `xml:"tvdbid"`
+	UniqueId []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"uniqueid"`
+}
+
+var tmdbUrlMatch = regexp.MustCompile(`themoviedb\.org/(movie|tv)/([0-9]+)`)
+
 func SaveNfo(file string, v interface{}) error {
 	if file == "" {
 		return nil
 	}
 
+	if Planned(ActionWriteNfo, file, "") {
+		return nil
+	}
+
 	bytes, err := xml.MarshalIndent(v, "", "  ")
 	if err != nil {
 		Logger.WarningF("save nfo marshal err: %v", err)
 		return err
 	}
 
-	f, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	// 先写入临时文件再重命名，避免中断时留下不完整的NFO
+	tmpFile := file + ".tmp"
+	err = os.WriteFile(tmpFile, append([]byte(xml.Header), bytes...), 0644)
 	if err != nil {
-		Logger.WarningF("save nfo open file err: %s, %v", file, err)
+		Logger.WarningF("save nfo write err: %s, %v", file, err)
+		_ = os.Remove(tmpFile)
 		return err
 	}
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
-			Logger.WarningF("save nfo close file err: %v", err)
+
+	return os.Rename(tmpFile, file)
+}
+
+// ParseNfoIds 从已有的NFO中提取 TMDB、IMDb、TVDB id，支持Kodi格式的XML和包含网址的纯文本（发布组附带的NFO）
+func ParseNfoIds(content []byte) *NfoIds {
+	ids := &NfoIds{}
+
+	nfo := &nfoIdXml{}
+	if xml.Unmarshal(content, nfo) == nil {
+		for _, item := range nfo.UniqueId {
+			value := strings.TrimSpace(item.Value)
+			switch strings.ToLower(item.Type) {
+			case "tmdb":
+				ids.Tmdb, _ = strconv.Atoi(value)
+			case "imdb":
+				ids.Imdb = MatchImdbId(value)
+			case "tvdb":
+				ids.Tvdb = value
+			}
 		}
-	}(f)
 
-	_, err = f.Write([]byte(xml.Header))
-	if err != nil {
-		Logger.WarningF("save nfo write err: %v", err)
-		return err
+		if ids.Tmdb == 0 {
+			ids.Tmdb, _ = strconv.Atoi(strings.TrimSpace(nfo.TmdbId))
+		}
+		if ids.Imdb == "" {
+			ids.Imdb = MatchImdbId(nfo.ImdbId)
+		}
+		if ids.Imdb == "" {
+			ids.Imdb = MatchImdbId(nfo.Id) // <id> 在不同版本的Kodi中可能是IMDb或TVDB id，只认IMDb
+		}
+		if ids.Tvdb == "" {
+			ids.Tvdb = strings.TrimSpace(nfo.TvdbId)
+		}
+		if _, err := strconv.Atoi(ids.Tvdb); err != nil {
+			ids.Tvdb = ""
+		}
 	}
 
-	_, err = f.Write(bytes)
+	// 纯文本或XML后面附带的网址
+	text := string(content)
+	if find := tmdbUrlMatch.FindStringSubmatch(text); ids.Tmdb == 0 && len(find) == 3 {
+		ids.Tmdb, _ = strconv.Atoi(find[2])
+		ids.TmdbType = find[1]
+	}
+	if ids.Imdb == "" {
+		ids.Imdb = MatchImdbId(text)
+	}
+	if ids.Tvdb == "" {
+		ids.Tvdb = MatchTvdbId(text)
+	}
+
+	return ids
+}
+
+// ForeignNfo 已有的NFO是否不是当前TMDB条目写入的，比如发布组附带的NFO或者之前识别错误写入的
+func ForeignNfo(file string, tmdbId int) bool {
+	content, err := os.ReadFile(file)
 	if err != nil {
-		Logger.WarningF("save nfo write err: %v", err)
-		return err
+		return false
+	}
+
+	return ParseNfoIds(content).Tmdb != tmdbId
+}
+
+// BackupNfo 已有的NFO不是当前TMDB条目写入的时重命名为 .bak，返回是否备份
+func BackupNfo(file string, tmdbId int) bool {
+	if !ForeignNfo(file, tmdbId) {
+		return false
+	}
+
+	Logger.InfoF("backup existing nfo: %s", file)
+	if err := Rename(file, file+".bak"); err != nil {
+		Logger.WarningF("backup existing nfo: %s err: %v", file, err)
+		return false
 	}
 
-	return nil
+	return true
 }
@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestParseNfoIds(t *testing.T) {
+	cases := map[string]NfoIds{
+		`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<movie>
+  <title>钢铁侠</title>
+  <id>1726</id>
+  <uniqueid default="true" type="tmdb">1726</uniqueid>
+  <uniqueid type="imdb">tt0371746</uniqueid>
+</movie>`: {Tmdb: 1726, Imdb: "tt0371746"},
+		`<tvshow>
+  <title>Breaking Bad</title>
+  <id>81189</id>
+  <uniqueid type="tvdb" default="true">81189</uniqueid>
+</tvshow>
+https://www.themoviedb.org/tv/1396-breaking-bad`: {Tmdb: 1396, TmdbType: "tv", Tvdb: "81189"},
+		`<movie><imdbid>tt0371746</imdbid><tmdbid>1726</tmdbid></movie>`: {Tmdb: 1726, Imdb: "tt0371746"},
+		`<movie><id>tt0371746</id></movie>`:                              {Imdb: "tt0371746"},
+		`   ___  Iron.Man.2008.1080p.BluRay.x264-GROUP  ___
+ IMDb ..........: https://www.imdb.com/title/tt0371746/
+ TMDb ..........: https://www.themoviedb.org/movie/1726-iron-man`: {Tmdb: 1726, TmdbType: "movie", Imdb: "tt0371746"},
+		`Source: BluRay   Size: 8.74 GiB`: {},
+	}
+
+	for content, want := range cases {
+		give := ParseNfoIds([]byte(content))
+		if *give != want {
+			t.Errorf("ParseNfoIds(%s) give: %+v, want %+v", content, *give, want)
+		}
+	}
+}
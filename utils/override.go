@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 手动指定的媒体类型
+const (
+	MediaMovie = "movie"
+	MediaTv    = "tv"
+)
+
+// Override 手动指定的刮削信息，每个条目一个 tmdb/override.json，代替 id.txt、season.txt、group.txt、part.txt
+type Override struct {
+	Id            int    `json:"id,omitempty"`             // TMDB id
+	ImdbId        string `json:"imdb_id,omitempty"`        // IMDb id，没有TMDB id时通过它查找
+	TvdbId        string `json:"tvdb_id,omitempty"`        // TVDB id，没有TMDB id时通过它查找
+	MediaType     string `json:"media_type,omitempty"`     // movie 或 tv，和所在媒体库不一致时跳过
+	Season        int    `json:"season,omitempty"`         // 第几季
+	GroupId       string `json:"group_id,omitempty"`       // TMDB 剧集组id
+	PartMode      int    `json:"part_mode,omitempty"`      // 分卷模式: 0不使用分卷, 1-自动, 2以上为手动指定分卷数量
+	Language      string `json:"language,omitempty"`       // 请求TMDB使用的语言，比如 en-US，可以用逗号分隔多个按顺序回退，为空时使用媒体库或配置的语言
+	Title         string `json:"title,omitempty"`          // 搜索使用的标题，代替从文件名解析的标题
+	Year          int    `json:"year,omitempty"`           // 搜索使用的年份
+	EpisodeOffset int    `json:"episode_offset,omitempty"` // 集数偏移，比如文件从E13开始而TMDB从E01开始时填 -12
+	Ignore        bool   `json:"ignore,omitempty"`         // 跳过这个条目
+}
+
+// LegacyOverride 旧版本使用的单独文本文件，为空的不读取
+type LegacyOverride struct {
+	IdFiles    []string // 可能有多个位置，使用第一个存在的
+	SeasonFile string
+	GroupFile  string
+	PartFile   string
+}
+
+// ReadOverride 读取 override.json，文件不存在或格式错误时返回nil
+func ReadOverride(file string) *Override {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Logger.WarningF("read override file: %s err: %v", file, err)
+		}
+		return nil
+	}
+
+	override := &Override{}
+	if err = json.Unmarshal(bytes, override); err != nil {
+		Logger.WarningF("parse override file: %s err: %v", file, err)
+		return nil
+	}
+
+	return override
+}
+
+// SaveOverride 保存 override.json
+func SaveOverride(file string, override *Override) error {
+	bytes, err := json.MarshalIndent(override, "", "    ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(ActionWriteOverride, file, bytes, 0664)
+}
+
+// Read 读取旧的文本文件，一个都不存在时返回nil
+// id.txt 里可以写TMDB id，也可以写IMDb id（tt0903747）或TVDB id（tvdb-81189）
+func (l LegacyOverride) Read() *Override {
+	override := &Override{}
+	found := false
+
+	for _, file := range l.IdFiles {
+		if content, ok := readLegacyFile(file); ok {
+			override.Id, _ = strconv.Atoi(content)
+			override.ImdbId = MatchImdbId(content)
+			override.TvdbId = MatchTvdbId(content)
+			found = true
+			break
+		}
+	}
+	if content, ok := readLegacyFile(l.SeasonFile); ok {
+		override.Season, _ = strconv.Atoi(content)
+		found = true
+	}
+	if content, ok := readLegacyFile(l.GroupFile); ok {
+		override.GroupId = content
+		found = true
+	}
+	if content, ok := readLegacyFile(l.PartFile); ok {
+		override.PartMode, _ = strconv.Atoi(content)
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+	return override
+}
+
+// Files 已经存在的旧文本文件
+func (l LegacyOverride) Files() []string {
+	files := make([]string, 0)
+	for _, file := range append(append([]string{}, l.IdFiles...), l.SeasonFile, l.GroupFile, l.PartFile) {
+		if file != "" && FileExist(file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// LoadOverride 优先读取 override.json，不存在时兼容读取旧的文本文件
+// 旧版本把搜索到的id也写入 id.txt，override.json 没有指定id时仍然读取，migrate 合并后删除
+func LoadOverride(file string, legacy LegacyOverride) *Override {
+	override := ReadOverride(file)
+	if override == nil {
+		return legacy.Read()
+	}
+
+	if override.Id == 0 && override.ImdbId == "" && override.TvdbId == "" {
+		if ids := (LegacyOverride{IdFiles: legacy.IdFiles}).Read(); ids != nil {
+			override.Id, override.ImdbId, override.TvdbId = ids.Id, ids.ImdbId, ids.TvdbId
+		}
+	}
+
+	return override
+}
+
+// MigrateOverride 把旧的文本文件合并成 override.json 并删除旧文件，已经有 override.json 或没有旧文件时返回false
+func MigrateOverride(file string, legacy LegacyOverride) (bool, error) {
+	if FileExist(file) {
+		return false, nil
+	}
+
+	override := legacy.Read()
+	if override == nil {
+		return false, nil
+	}
+
+	if err := SaveOverride(file, override); err != nil {
+		return false, err
+	}
+	for _, item := range legacy.Files() {
+		if err := Remove(item); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+func readLegacyFile(file string) (string, bool) {
+	if file == "" {
+		return "", false
+	}
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Logger.WarningF("read specially file: %s err: %v", file, err)
+		}
+		return "", false
+	}
+
+	return strings.Trim(string(bytes), "\r\n "), true
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOverride(t *testing.T) {
+	dir := t.TempDir()
+	legacy := LegacyOverride{
+		IdFiles:    []string{filepath.Join(dir, "id.txt"), filepath.Join(dir, "old", "id.txt")},
+		SeasonFile: filepath.Join(dir, "season.txt"),
+		GroupFile:  filepath.Join(dir, "group.txt"),
+		PartFile:   filepath.Join(dir, "part.txt"),
+	}
+	file := filepath.Join(dir, "override.json")
+
+	if give := LoadOverride(file, legacy); give != nil {
+		t.Errorf("LoadOverride without files want nil, give %+v", give)
+	}
+
+	_ = os.Mkdir(filepath.Join(dir, "old"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "old", "id.txt"), []byte("tt0903747\n"), 0644)
+	_ = os.WriteFile(legacy.SeasonFile, []byte("2\n"), 0644)
+	_ = os.WriteFile(legacy.GroupFile, []byte("5b11ab6d0e0a267aee012a27"), 0644)
+	want := Override{ImdbId: "tt0903747", Season: 2, GroupId: "5b11ab6d0e0a267aee012a27"}
+	if give := LoadOverride(file, legacy); give == nil || *give != want {
+		t.Errorf("LoadOverride legacy want %+v, give %+v", want, give)
+	}
+
+	// override.json 优先，没有指定id时仍然读取 id.txt
+	_ = os.WriteFile(legacy.IdFiles[0], []byte("1396"), 0644)
+	_ = os.WriteFile(file, []byte(`{"season": 3, "language": "en-US", "episode_offset": -12}`), 0644)
+	want = Override{Id: 1396, Season: 3, Language: "en-US", EpisodeOffset: -12}
+	if give := LoadOverride(file, legacy); give == nil || *give != want {
+		t.Errorf("LoadOverride override.json want %+v, give %+v", want, give)
+	}
+}
+
+func TestMigrateOverride(t *testing.T) {
+	dir := t.TempDir()
+	legacy := LegacyOverride{
+		IdFiles:    []string{filepath.Join(dir, "id.txt")},
+		SeasonFile: filepath.Join(dir, "season.txt"),
+		PartFile:   filepath.Join(dir, "part.txt"),
+	}
+	file := filepath.Join(dir, "override.json")
+
+	if migrated, err := MigrateOverride(file, legacy); migrated || err != nil {
+		t.Errorf("MigrateOverride without legacy files want false, give %v %v", migrated, err)
+	}
+
+	_ = os.WriteFile(legacy.IdFiles[0], []byte("1396"), 0644)
+	_ = os.WriteFile(legacy.PartFile, []byte("2"), 0644)
+	if migrated, err := MigrateOverride(file, legacy); !migrated || err != nil {
+		t.Fatalf("MigrateOverride want true, give %v %v", migrated, err)
+	}
+	if files := legacy.Files(); len(files) != 0 {
+		t.Errorf("legacy files want removed, give %v", files)
+	}
+
+	want := Override{Id: 1396, PartMode: 2}
+	if give := ReadOverride(file); give == nil || *give != want {
+		t.Errorf("ReadOverride want %+v, give %+v", want, give)
+	}
+
+	if migrated, _ := MigrateOverride(file, legacy); migrated {
+		t.Errorf("MigrateOverride with override.json want false")
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+)
+
+// 演习模式下记录的操作类型
+const (
+	ActionWriteNfo      = "write_nfo"
+	ActionWriteCache    = "write_cache"
+	ActionWriteOverride = "write_override" // 手动指定的 override.json
+	ActionWriteProbe    = "write_probe"    // ffprobe 结果缓存
+	ActionWriteMarker   = "write_marker"   // expire 命令的缓存过期标记
+	ActionRelinkCache   = "relink_cache"   // 改名、移动后关联原来的统一缓存目录
+	ActionDownload      = "download"
+	ActionDrawThumb     = "draw_thumb"
+	ActionCopy          = "copy"
+	ActionMkdir         = "mkdir"
+	ActionMove          = "move"
+	ActionRemove        = "remove"
+	ActionWebDAVRemove  = "webdav_remove"
+)
+
+// DryRun 演习模式：正常解析名字和请求TMDB，但所有文件修改和WebDAV删除只记录到 Plan 而不执行
+var DryRun bool
+
+// Plan 演习模式下记录的计划操作
+var Plan = &plan{
+	lock:    &sync.Mutex{},
+	Actions: make([]*PlanAction, 0),
+	exist:   make(map[PlanAction]struct{}, 0),
+}
+
+type plan struct {
+	lock    *sync.Mutex
+	Actions []*PlanAction
+	exist   map[PlanAction]struct{}
+}
+
+type PlanAction struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`             // 被修改的文件或目录，移动时为目标路径
+	Source string `json:"source,omitempty"` // 来源：下载的网址或移动前的路径
+}
+
+// Planned 演习模式下记录操作并返回true，调用方应跳过实际的修改
+func Planned(action, path, source string) bool {
+	if !DryRun {
+		return false
+	}
+
+	Plan.Add(action, path, source)
+	return true
+}
+
+// Add 添加计划操作，重复的操作只记录一次
+func (p *plan) Add(action, path, source string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	item := PlanAction{Action: action, Path: path, Source: source}
+	if _, ok := p.exist[item]; ok {
+		return
+	}
+
+	p.exist[item] = struct{}{}
+	p.Actions = append(p.Actions, &item)
+	Logger.InfoF("dry run %s: %s %s", action, path, source)
+}
+
+// Print 输出计划操作，format 支持 table 和 json
+func (p *plan) Print(w io.Writer, format string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if format == "json" {
+		bytes, err := json.MarshalIndent(p.Actions, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(bytes))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ACTION\tPATH\tSOURCE")
+	for _, item := range p.Actions {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", item.Action, item.Path, item.Source)
+	}
+	return tw.Flush()
+}
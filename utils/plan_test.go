@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanWriteAction(t *testing.T) {
+	if Logger == nil {
+		InitLogger(LogModeStdout, int(FATAL), "")
+	}
+	defer func() { DryRun = false }()
+	DryRun = true
+
+	file := filepath.Join(t.TempDir(), "override.json")
+	if err := SaveOverride(file, &Override{Id: 1396}); err != nil {
+		t.Fatal(err)
+	}
+	if FileExist(file) {
+		t.Errorf("dry run want no override.json written")
+	}
+
+	found := false
+	for _, item := range Plan.Actions {
+		if item.Path == file {
+			found = item.Action == ActionWriteOverride
+		}
+	}
+	if !found {
+		t.Errorf("dry run want %s planned for %s", ActionWriteOverride, file)
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Summary 单次扫描的处理结果汇总
+type Summary struct {
+	lock    *sync.Mutex
+	Scraped []string         `json:"scraped"` // 写入了新的NFO
+	Skipped []string         `json:"skipped"` // 缓存有效且NFO已存在，无需处理
+	Failed  []*SummaryFailed `json:"failed"`  // 处理失败
+}
+
+type SummaryFailed struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func NewSummary() *Summary {
+	return &Summary{
+		lock:    &sync.Mutex{},
+		Scraped: make([]string, 0),
+		Skipped: make([]string, 0),
+		Failed:  make([]*SummaryFailed, 0),
+	}
+}
+
+// Add 记录单个条目的处理结果，err 不为空时记为失败
+func (s *Summary) Add(name string, scraped bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err != nil {
+		s.Failed = append(s.Failed, &SummaryFailed{Name: name, Reason: err.Error()})
+		return
+	}
+
+	if scraped {
+		s.Scraped = append(s.Scraped, name)
+	} else {
+		s.Skipped = append(s.Skipped, name)
+	}
+}
+
+// HasFailed 是否存在处理失败的条目
+func (s *Summary) HasFailed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.Failed) > 0
+}
+
+// ExitCode 单次运行的退出码，存在失败的条目时为1
+func (s *Summary) ExitCode() int {
+	if s.HasFailed() {
+		return 1
+	}
+	return 0
+}
+
+// Print 输出汇总信息
+func (s *Summary) Print(w io.Writer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, item := range s.Scraped {
+		_, _ = fmt.Fprintf(w, "scraped  %s\n", item)
+	}
+	for _, item := range s.Failed {
+		_, _ = fmt.Fprintf(w, "failed   %s: %s\n", item.Name, item.Reason)
+	}
+	_, _ = fmt.Fprintf(w, "scraped: %d, skipped: %d, failed: %d\n", len(s.Scraped), len(s.Skipped), len(s.Failed))
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSummaryExitCode(t *testing.T) {
+	summary := NewSummary()
+	summary.Add("/movies/a", true, nil)
+	summary.Add("/movies/b", false, nil)
+	if summary.ExitCode() != 0 {
+		t.Errorf("ExitCode without failed want 0, give %d", summary.ExitCode())
+	}
+
+	summary.Add("/movies/c", false, errors.New("save movie nfo err: permission denied"))
+	summary.Add("/movies/d", true, errors.New("not found"))
+	if summary.ExitCode() != 1 {
+		t.Errorf("ExitCode with failed want 1, give %d", summary.ExitCode())
+	}
+
+	buf := &bytes.Buffer{}
+	summary.Print(buf)
+	if !strings.Contains(buf.String(), "scraped: 1, skipped: 1, failed: 2\n") ||
+		!strings.Contains(buf.String(), "failed   /movies/c: save movie nfo err: permission denied") {
+		t.Errorf("Print give %s", buf.String())
+	}
+}
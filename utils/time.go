@@ -1,21 +1,12 @@
 package utils
 
 import (
+	"os"
 	"time"
 )
 
-// CacheExpire 判断缓存到期，1年以上的永久缓存，一年到半年的一礼拜，半年内的3天
-// TODO 可配置
-func CacheExpire(modTime, airTime time.Time) bool {
-	airSub := time.Now().Sub(airTime)
-	if airSub.Hours() >= 24*365 {
-		return false
-	}
-
-	cacheSub := time.Now().Sub(modTime)
-	if airSub.Hours() >= 24*180 && cacheSub.Hours() > 24*7 {
-		return false
-	}
-
-	return cacheSub.Hours() > 24*3
+// ForceExpired 手动标记过期：标记文件比缓存新时缓存过期，重新缓存后自动失效
+func ForceExpired(markerFile string, modTime time.Time) bool {
+	info, err := os.Stat(markerFile)
+	return err == nil && info.ModTime().After(modTime)
 }
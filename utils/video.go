@@ -133,6 +133,8 @@ var (
 	partMatch          *regexp.Regexp
 	numberMatch        *regexp.Regexp
 	subtitleMatch      *regexp.Regexp
+	imdbIdMatch        *regexp.Regexp
+	tvdbIdMatch        *regexp.Regexp
 )
 
 func init() {
@@ -173,6 +175,8 @@ func init() {
 	partMatch, _ = regexp.Compile("(:?.|-|_| |@)[pP]art([0-9])(:?.|-|_| |@)")
 	numberMatch, _ = regexp.Compile("([0-9]+).+$")
 	subtitleMatch, _ = regexp.Compile(`(.*)\.(srt|ass|ssa)$`)
+	imdbIdMatch, _ = regexp.Compile(`(?:^|[^a-zA-Z0-9])(tt[0-9]{7,10})(?:[^0-9]|$)`)
+	tvdbIdMatch, _ = regexp.Compile(`(?i)(?:tvdb(?:id)?[-_=:> ]*|thetvdb\.com/.*?[?&]id=)([0-9]+)`)
 }
 
 // IsCollection 是否是合集，如S01-S03季
@@ -481,3 +485,21 @@ func MatchSubtitle(name string) bool {
 	}
 	return true
 }
+
+// MatchImdbId 匹配IMDb id：Movie.2008.tt0371746、[imdbid-tt0371746]、imdb.com/title/tt0371746
+func MatchImdbId(name string) string {
+	find := imdbIdMatch.FindStringSubmatch(name)
+	if len(find) == 2 {
+		return find[1]
+	}
+	return ""
+}
+
+// MatchTvdbId 匹配TVDB id：{tvdb-81189}、[tvdbid=81189]、thetvdb.com/?tab=series&id=81189
+func MatchTvdbId(name string) string {
+	find := tvdbIdMatch.FindStringSubmatch(name)
+	if len(find) == 2 {
+		return find[1]
+	}
+	return ""
+}
@@ -243,3 +243,39 @@ func TestIsCollection(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchImdbId(t *testing.T) {
+	cases := map[string]string{
+		"Iron.Man.2008.tt0371746.1080p.BluRay.x264":         "tt0371746",
+		"钢铁侠 (2008) [imdbid-tt0371746]":                     "tt0371746",
+		"https://www.imdb.com/title/tt0371746/":             "tt0371746",
+		"Breaking.Bad.S01.{imdb-tt0903747}":                 "tt0903747",
+		"Fortress.2021.BluRay.1080p.AVC.DTS-HD.MA5.1-MTeam": "",
+		"Scott.Pilgrim.2010.1080p.Outtt1234567.mkv":         "",
+		"Movie.2020.tt12345":                                "",
+	}
+
+	for name, want := range cases {
+		give := MatchImdbId(name)
+		if give != want {
+			t.Errorf("MatchImdbId(%s) give: %s, want %s", name, give, want)
+		}
+	}
+}
+
+func TestMatchTvdbId(t *testing.T) {
+	cases := map[string]string{
+		"Breaking Bad (2008) {tvdb-81189}":              "81189",
+		"Breaking Bad [tvdbid=81189]":                   "81189",
+		"http://thetvdb.com/?tab=series&id=81189&lid=7": "81189",
+		"<tvdbid>81189</tvdbid>":                        "81189",
+		"Breaking.Bad.S01.1080p.BluRay.x264-tt0903747":  "",
+	}
+
+	for name, want := range cases {
+		give := MatchTvdbId(name)
+		if give != want {
+			t.Errorf("MatchTvdbId(%s) give: %s, want %s", name, give, want)
+		}
+	}
+}
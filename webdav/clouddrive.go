@@ -43,12 +43,18 @@ func InitWebDAV(config *config.WebDAVConfig) {
 
 // 通过webdav方式删除电影文件夹
 func RemoveMovie(movieName string) error {
+	if utils.Planned(utils.ActionWebDAVRemove, webDAVMoviesDir+"/"+movieName, "") {
+		return nil
+	}
 	err := client.RemoveAll(webDAVMoviesDir + "/" + movieName)
 	return err
 }
 
 // 通过webdav方式删除剧集文件夹
 func RemoveShow(showName string) error {
+	if utils.Planned(utils.ActionWebDAVRemove, webDAVShowsDir+"/"+showName, "") {
+		return nil
+	}
 	err := client.RemoveAll(webDAVShowsDir + "/" + showName)
 	return err
 }